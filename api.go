@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/journal"
+	"github.com/modood/cts/strategy"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// api serve the status and control of running bots in JSON, requests
+	// which change bots need the bearer token
+	api struct {
+		token   string
+		started time.Time
+	}
+
+	// apiError is an error of a request, whose status is not 500
+	apiError struct {
+		code int
+		msg  string
+	}
+
+	// botStatus is the state of a bot
+	botStatus struct {
+		Name     string         `json:"name"`
+		Symbol   string         `json:"symbol"`
+		Strategy string         `json:"strategy"`
+		Paused   bool           `json:"paused"`
+		Halted   bool           `json:"halted"` // by the risk manager for the rest of the day
+		Failures uint64         `json:"failures"`
+		Signal   *journal.Entry `json:"signal"` // the last one, null if none yet
+	}
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	// controlTimeout bound a control action, see detached
+	controlTimeout = time.Minute
+)
+
+func (e *apiError) Error() string { return e.msg }
+
+// newAPI return the api, whose uptime starts now
+func newAPI(token string) *api {
+	return &api{token: token, started: time.Now()}
+}
+
+// handler return endpoints under /api/
+func (a *api) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", a.get(a.status))
+	mux.HandleFunc("/api/balances", a.get(each(func(s exchange.Symbol) (interface{}, error) {
+		r := map[string]*exchange.Balance{}
+		for _, c := range []string{s.BaseCurrency(), s.QuoteCurrency()} {
+			b, err := s.Balance(c)
+			if err != nil {
+				return nil, errors.Wrap(err, util.FuncName())
+			}
+			r[c] = b
+		}
+		return r, nil
+	})))
+	mux.HandleFunc("/api/orders", a.get(each(func(s exchange.Symbol) (interface{}, error) {
+		os, err := s.OpenOrders()
+		if err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		return append([]exchange.Order{}, os...), nil
+	})))
+	mux.HandleFunc("/api/loans", a.get(each(func(s exchange.Symbol) (interface{}, error) {
+		ls, err := s.Loans()
+		if err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		return append([]exchange.Loan{}, ls...), nil
+	})))
+	mux.HandleFunc("/api/errors", a.get(func(*http.Request) (interface{}, error) {
+		return recent.list(), nil
+	}))
+	mux.HandleFunc("/api/pause", a.post(func(r *http.Request) (interface{}, error) {
+		return control(r, func(name string) (string, error) { return pause(name, true) })
+	}))
+	mux.HandleFunc("/api/resume", a.post(func(r *http.Request) (interface{}, error) {
+		return control(r, func(name string) (string, error) { return pause(name, false) })
+	}))
+	mux.HandleFunc("/api/flatten", a.post(func(r *http.Request) (interface{}, error) {
+		return control(r, func(name string) (string, error) {
+			ctx, cancel := detached()
+			defer cancel()
+			return flatten(ctx, name, "api")
+		})
+	}))
+	mux.HandleFunc("/api/signal", a.post(func(r *http.Request) (interface{}, error) {
+		return control(r, func(name string) (string, error) {
+			ctx, cancel := detached()
+			defer cancel()
+			return force(ctx, name, strings.ToLower(r.FormValue("signal")))
+		})
+	}))
+	return mux
+}
+
+// status return uptime and states of all bots
+func (a *api) status(*http.Request) (interface{}, error) {
+	var bs []botStatus
+	for _, v := range bots {
+		st := botStatus{
+			Name:     v.name,
+			Symbol:   v.symbol,
+			Strategy: v.strategy,
+			Paused:   atomic.LoadInt32(&v.paused) != 0,
+			Halted:   guard != nil && guard.Halted(v.symbol),
+			Failures: atomic.LoadUint64(&v.failures),
+		}
+		if e, ok := v.lastSignal(); ok {
+			st.Signal = &e
+		}
+		bs = append(bs, st)
+	}
+
+	return map[string]interface{}{
+		"started": a.started,
+		"uptime":  time.Since(a.started).Truncate(time.Second).String(),
+		"venue":   venue.Name(),
+		"bots":    bs,
+	}, nil
+}
+
+// control run a command on the bot or symbol of the bot parameter, all bots
+// if it is empty
+func control(r *http.Request, cmd func(name string) (string, error)) (interface{}, error) {
+	name := strings.ToLower(r.FormValue("bot"))
+	if _, err := match(name); err != nil {
+		return nil, &apiError{code: http.StatusNotFound, msg: errors.Cause(err).Error()}
+	}
+	msg, err := cmd(name)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	log.Printf("api: %s %s", r.URL.Path, name)
+	return map[string]string{"result": msg}, nil
+}
+
+// detached return a context of a control action, which is not cancelled with
+// its request, e.g., when the client disconnects or the server is closed, so
+// that a position is never left half closed, but times out by controlTimeout
+func detached() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), controlTimeout)
+}
+
+// force trade bots of a name or symbol, all if it is empty, by a signal as
+// if their strategies gave it. bots which are not paused follow their
+// strategies again at the next poll.
+func force(ctx context.Context, name, signal string) (string, error) {
+	var sig uint8
+	ok := false
+	for _, v := range strategy.Signals() {
+		if strategy.SignalName(v) == signal {
+			sig, ok = v, true
+		}
+	}
+	if !ok {
+		return "", &apiError{code: http.StatusBadRequest, msg: "unknown signal: " + signal}
+	}
+
+	bs, err := match(name)
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+	var lines []string
+	for _, b := range bs {
+		e := records.Append(journal.Entry{
+			Kind:     journal.Signal,
+			Bot:      b.name,
+			Symbol:   b.symbol,
+			Strategy: "api",
+			Signal:   signal,
+		})
+		if e != nil {
+			log.Println(e)
+		}
+
+		b.mu.Lock()
+		err = b.exec(ctx, sig)
+		b.mu.Unlock()
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+		lines = append(lines, b.name+"："+signal)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// each return a handler which reports every symbol of bots by its name
+func each(f func(s exchange.Symbol) (interface{}, error)) func(*http.Request) (interface{}, error) {
+	return func(req *http.Request) (interface{}, error) {
+		r := map[string]interface{}{}
+		for _, symbol := range symbols(bots) {
+			s, err := venue.Symbol(req.Context(), symbol)
+			if err != nil {
+				return nil, errors.Wrap(err, util.FuncName())
+			}
+			if r[symbol], err = f(s); err != nil {
+				return nil, errors.Wrap(err, util.FuncName())
+			}
+		}
+		return r, nil
+	}
+}
+
+func (a *api) get(f func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			reply(w, nil, &apiError{code: http.StatusMethodNotAllowed, msg: "method not allowed"})
+			return
+		}
+		v, err := f(r)
+		reply(w, v, err)
+	}
+}
+
+func (a *api) post(f func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			reply(w, nil, &apiError{code: http.StatusMethodNotAllowed, msg: "method not allowed"})
+			return
+		}
+		auth := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(auth, []byte("Bearer "+a.token)) != 1 {
+			reply(w, nil, &apiError{code: http.StatusUnauthorized, msg: "unauthorized"})
+			return
+		}
+		v, err := f(r)
+		reply(w, v, err)
+	}
+}
+
+// reply write v in JSON, or an error as {"error": "..."}
+func reply(w http.ResponseWriter, v interface{}, err error) {
+	code := http.StatusOK
+	if err != nil {
+		code = http.StatusInternalServerError
+		if e, ok := errors.Cause(err).(*apiError); ok {
+			code = e.code
+		} else {
+			log.Println(err)
+		}
+		v = map[string]string{"error": util.Redact(errors.Cause(err).Error())}
+	}
+
+	bs, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if _, err = w.Write(append(bs, '\n')); err != nil {
+		log.Println(err)
+	}
+}
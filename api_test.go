@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/huobi"
+	"github.com/modood/cts/sim"
+	"github.com/modood/cts/strategy"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPI(t *testing.T) {
+	Convey("should report and control bots", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Fee = 0
+		e.Leverage = 3
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+
+		venue = e
+		defer func() { venue = fakeExchange{} }()
+		strategies = map[string]strategy.Strategy{"fake": fakeStrategy{}}
+		defer func() { strategies = strategy.Strategies() }()
+		bots = []*bot{{name: "doge", symbol: "doge_usdt", strategy: "fake"}}
+		defer func() { bots = nil }()
+
+		h := newAPI("t0ken").handler()
+		do := func(method, url, token string) (int, string) {
+			req := httptest.NewRequest(method, url, nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			return w.Code, w.Body.String()
+		}
+
+		code, body := do("GET", "/api/status", "")
+		c.So(code, ShouldEqual, http.StatusOK)
+		c.So(body, ShouldContainSubstring, `"name":"doge"`)
+		c.So(body, ShouldContainSubstring, `"signal":null`)
+
+		c.So(bots[0].step(ctx), ShouldBeNil)
+		_, body = do("GET", "/api/status", "")
+		c.So(body, ShouldContainSubstring, `"signal":"rise"`)
+		c.So(body, ShouldContainSubstring, `"uptime":"0s"`)
+
+		code, body = do("GET", "/api/balances", "")
+		c.So(code, ShouldEqual, http.StatusOK)
+		c.So(body, ShouldContainSubstring, `"doge_usdt":{"doge":{"trade":50`)
+
+		_, body = do("GET", "/api/orders", "")
+		c.So(body, ShouldEqual, "{\"doge_usdt\":[]}\n")
+
+		code, _ = do("POST", "/api/pause", "")
+		c.So(code, ShouldEqual, http.StatusUnauthorized)
+		code, _ = do("POST", "/api/pause", "wrong")
+		c.So(code, ShouldEqual, http.StatusUnauthorized)
+		code, _ = do("GET", "/api/pause", "t0ken")
+		c.So(code, ShouldEqual, http.StatusMethodNotAllowed)
+		code, body = do("POST", "/api/pause?bot=xrp", "t0ken")
+		c.So(code, ShouldEqual, http.StatusNotFound)
+		c.So(body, ShouldContainSubstring, `"error":"no bot or symbol`)
+
+		code, body = do("POST", "/api/pause?bot=doge", "t0ken")
+		c.So(code, ShouldEqual, http.StatusOK)
+		c.So(body, ShouldContainSubstring, `"result":"已暂停：doge"`)
+		c.So(bots[0].paused, ShouldEqual, 1)
+
+		code, _ = do("POST", "/api/signal?signal=up", "t0ken")
+		c.So(code, ShouldEqual, http.StatusBadRequest)
+		code, _ = do("POST", "/api/signal?signal=fall", "t0ken")
+		c.So(code, ShouldEqual, http.StatusOK)
+		_, body = do("GET", "/api/balances", "")
+		c.So(body, ShouldContainSubstring, `"doge":{"trade":0,`)
+
+		code, body = do("POST", "/api/flatten", "t0ken")
+		c.So(code, ShouldEqual, http.StatusOK)
+		c.So(body, ShouldContainSubstring, "负债 0.00000000")
+		_, body = do("GET", "/api/loans", "")
+		c.So(body, ShouldEqual, "{\"doge_usdt\":[]}\n")
+
+		bots[0].handle(errors.New("boom"))
+		_, body = do("GET", "/api/errors", "")
+		c.So(strings.Count(body, `"bot":"doge"`), ShouldBeGreaterThan, 0)
+		c.So(body, ShouldContainSubstring, `"error":"boom"`)
+
+		util.AddSecret("api-secret")
+		bots[0].handle(errors.New("sign: api-secret"))
+		_, body = do("GET", "/api/errors", "")
+		c.So(body, ShouldNotContainSubstring, "api-secret")
+		c.So(body, ShouldContainSubstring, "sign: "+util.Redacted)
+	})
+}
+
+func TestAPIDetached(t *testing.T) {
+	Convey("should finish control actions whose requests are gone", t, func(c C) {
+		srv := newMock(5)
+		defer srv.Close()
+		srv.AddKey("key", "secret")
+		srv.Deposit("key", "doge_usdt", "doge", 10000)
+
+		venue = huobi.Exchange{Client: huobi.NewClient(srv.URL, "key", "secret", nil, nil)}
+		defer func() { venue = fakeExchange{} }()
+		bots = []*bot{{name: "doge", symbol: "doge_usdt", strategy: "fake"}}
+		defer func() { bots = nil }()
+
+		// the client has disconnected
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		req := httptest.NewRequest("POST", "/api/flatten", nil).WithContext(cctx)
+		req.Header.Set("Authorization", "Bearer t0ken")
+		w := httptest.NewRecorder()
+		newAPI("t0ken").handler().ServeHTTP(w, req)
+		c.So(w.Code, ShouldEqual, http.StatusOK)
+		c.So(srv.Balance("key", "doge_usdt", "doge"), ShouldBeLessThan, 0.001)
+	})
+}
+
+func TestFailureLog(t *testing.T) {
+	Convey("should keep the latest errors", t, func(c C) {
+		l := &failureLog{max: 2}
+		for _, v := range []string{"a", "b", "c"} {
+			l.add(failure{Error: v})
+		}
+		fs := l.list()
+		c.So(len(fs), ShouldEqual, 2)
+		c.So(fs[0].Error, ShouldEqual, "c")
+		c.So(fs[1].Error, ShouldEqual, "b")
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/modood/cts/backtest"
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/history"
+	"github.com/modood/cts/risk"
+	"github.com/modood/cts/strategy"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var (
+	errNoData = errors.New("no market data, usage: cts backtest [options] <file or directory>...")
+)
+
+func backtestCommand() cli.Command {
+	return cli.Command{
+		Name:      "backtest",
+		Usage:     "replay recorded market data through a strategy offline",
+		ArgsUsage: "<file or directory>...",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "symbol",
+				Value: "doge_usdt",
+				Usage: "symbol name, quote symbol should be usdt(e.g., btc_usdt, xrp_usdt, etc.)",
+			},
+			cli.StringFlag{
+				Name:  "strategy",
+				Usage: "strategy name. available: " + strings.Join(strategy.Available(), ", "),
+			},
+			cli.Float64Flag{
+				Name:  "capital",
+				Value: 1000,
+				Usage: "initial balance of quote currency",
+			},
+			cli.Float64Flag{
+				Name:  "fee",
+				Value: 0.002,
+				Usage: "taker fee rate",
+			},
+			cli.Float64Flag{
+				Name:  "interest",
+				Value: 0.00098,
+				Usage: "daily interest rate of loans",
+			},
+			cli.Float64Flag{
+				Name:  "leverage",
+				Value: 3,
+				Usage: "max position value / equity when a bull or bear signal borrows",
+			},
+			cli.StringFlag{
+				Name:  "sizing",
+				Value: "allin",
+				Usage: "position sizing: allin, fixed:<quote>, fraction:<ratio> or vol:<annual target>[:<window>]",
+			},
+			cli.Float64Flag{
+				Name:  "max-leverage",
+				Usage: "max position value / equity of sizing, no limit if 0, vol sizing needs it",
+			},
+			cli.DurationFlag{
+				Name:  "interval",
+				Value: time.Second * 5,
+				Usage: "poll interval of the recorded data, by which vol sizing is annualized",
+			},
+			cli.Float64Flag{
+				Name:  "stop-loss",
+				Usage: "close a position which loses this fraction of its entry price, disabled if 0",
+			},
+			cli.Float64Flag{
+				Name:  "trailing-stop",
+				Usage: "close a position which retreats this fraction from its best price, disabled if 0",
+			},
+			cli.Float64Flag{
+				Name:  "take-profit",
+				Usage: "close a position which gains this fraction of its entry price, disabled if 0",
+			},
+			cli.Float64Flag{
+				Name:  "max-daily-loss",
+				Usage: "close positions and halt trading for the day when equity loses this fraction, disabled if 0",
+			},
+		},
+		Action: backtestAction,
+	}
+}
+
+func backtestAction(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return errors.Wrap(errNoData, util.FuncName())
+	}
+
+	sz, err := exchange.ParseSizer(c.String("sizing"), c.Float64("max-leverage"), c.Duration("interval"))
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	rm := risk.NewManager(c.Float64("stop-loss"), c.Float64("trailing-stop"),
+		c.Float64("take-profit"), c.Float64("max-daily-loss"))
+	if !rm.Enabled() {
+		rm = nil
+	}
+
+	snaps, err := history.Load(c.Args()...)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	// strategies log every signal, which is useless when replaying
+	w := log.Writer()
+	log.SetOutput(ioutil.Discard)
+	r, err := backtest.Run(snaps, backtest.Config{
+		Symbol:   c.String("symbol"),
+		Strategy: c.String("strategy"),
+		Capital:  c.Float64("capital"),
+		Fee:      c.Float64("fee"),
+		Leverage: c.Float64("leverage"),
+		Interest: c.Float64("interest"),
+		Sizer:    sz,
+		Risk:     rm,
+	})
+	log.SetOutput(w)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	fmt.Println(r)
+	return nil
+}
@@ -0,0 +1,191 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/history"
+	"github.com/modood/cts/pnl"
+	"github.com/modood/cts/risk"
+	"github.com/modood/cts/sim"
+	"github.com/modood/cts/strategy"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Config ...
+	Config struct {
+		Symbol   string  // e.g., doge_usdt
+		Strategy string  // strategy name
+		Capital  float64 // initial quote currency
+		Fee      float64 // taker fee rate
+		Leverage float64 // max position value / equity
+		Interest float64 // daily interest rate of loans
+
+		Sizer exchange.Sizer // position sizing, all in if nil
+		Risk  *risk.Manager  // no risk control if nil
+	}
+
+	// Report ...
+	Report struct {
+		Symbol      string
+		Strategy    string
+		Start       time.Time
+		End         time.Time
+		Snapshots   int
+		Skipped     int // snapshots without price of the symbol
+		Initial     float64
+		Final       float64
+		Return      float64 // total return, 0.1 means 10%
+		MaxDrawdown float64 // 0.1 means 10%
+		Trades      int
+		Closed      int // FIFO lots closed, see pnl.Position
+		Wins        int // lots closed with profit
+		WinRate     float64
+		Fees        float64 // in quote currency
+	}
+)
+
+var (
+	errNoSnapshot      = errors.New("no snapshot")
+	errUnknownStrategy = errors.New("unknown strategy")
+	errInvalidCapital  = errors.New("capital should be greater than 0")
+)
+
+// Run replay snapshots through a strategy and trade on a simulated exchange
+func Run(snaps []history.Snapshot, c Config) (*Report, error) {
+	if len(snaps) == 0 {
+		return nil, errors.Wrap(errNoSnapshot, util.FuncName())
+	}
+	if c.Capital <= 0 {
+		return nil, errors.Wrap(errInvalidCapital, util.FuncName())
+	}
+
+	feed := history.NewReplay(snaps)
+	s, ok := strategy.NewStrategies(feed)[c.Strategy]
+	if !ok {
+		err := fmt.Errorf("%v: %s", errUnknownStrategy, c.Strategy)
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	se := sim.NewExchange(feed.Ticker)
+	se.Fee = c.Fee
+	se.Interest = c.Interest
+	se.Now = func() time.Time {
+		if s, err := feed.Current(); err == nil {
+			return s.Time
+		}
+		return snaps[len(snaps)-1].Time
+	}
+	if c.Leverage > 0 {
+		se.Leverage = c.Leverage
+	}
+	if c.Risk != nil && c.Risk.Now == nil {
+		c.Risk.Now = se.Now
+	}
+
+	sym, err := se.Symbol(context.Background(), c.Symbol)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	if err = se.Deposit(c.Symbol, sym.QuoteCurrency(), c.Capital); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	acc := sym.(*sim.Symbol)
+
+	r := Report{
+		Symbol:   c.Symbol,
+		Strategy: c.Strategy,
+		Start:    snaps[0].Time,
+		End:      snaps[len(snaps)-1].Time,
+		Initial:  c.Capital,
+		Final:    c.Capital,
+	}
+
+	book := pnl.NewBook()
+	peak := c.Capital
+	for i := range snaps {
+		feed.Seek(i)
+		r.Snapshots++
+
+		eq, err := acc.Equity()
+		if err != nil {
+			// the symbol was not listed or recorded at this moment
+			r.Skipped++
+			continue
+		}
+
+		sig, err := s.Signal()
+		if err != nil {
+			r.Skipped++
+			continue
+		}
+
+		n := len(acc.Orders())
+		if c.Risk != nil {
+			if _, err = c.Risk.Check(sym); err != nil {
+				return nil, errors.Wrap(err, util.FuncName())
+			}
+		}
+		if c.Risk == nil || c.Risk.Allowed(sym.Name(), sig) {
+			if err = exchange.Apply(sym, sig, c.Sizer); err != nil {
+				return nil, errors.Wrap(err, util.FuncName())
+			}
+		}
+		if orders := acc.Orders(); len(orders) > n {
+			for _, v := range orders[n:] {
+				r.Trades++
+				buy := v.Type == "buy-market"
+				if buy {
+					r.Fees += v.FilledFees * v.Price
+				} else {
+					r.Fees += v.FilledFees
+				}
+				if v.FilledAmount > 0 {
+					book.Fill(c.Symbol, se.Now(), buy, v.FilledAmount, v.FilledCashAmount, v.FilledFees)
+				}
+			}
+			if e, err := acc.Equity(); err == nil {
+				eq = e
+			}
+		}
+
+		if eq > peak {
+			peak = eq
+		}
+		if dd := (peak - eq) / peak; dd > r.MaxDrawdown {
+			r.MaxDrawdown = dd
+		}
+		r.Final = eq
+	}
+
+	r.Return = r.Final/r.Initial - 1
+	if p, ok := book.Positions[c.Symbol]; ok && p.Closed > 0 {
+		r.Closed, r.Wins = p.Closed, p.Wins
+		r.WinRate = float64(r.Wins) / float64(r.Closed)
+	}
+
+	return &r, nil
+}
+
+// String format report as plain text
+func (r *Report) String() string {
+	lines := []string{
+		fmt.Sprintf("策略：%s", r.Strategy),
+		fmt.Sprintf("品种：%s", r.Symbol),
+		fmt.Sprintf("区间：%s ~ %s", r.Start.Format("2006-01-02 15:04:05"), r.End.Format("2006-01-02 15:04:05")),
+		fmt.Sprintf("快照：%d (skipped: %d)", r.Snapshots, r.Skipped),
+		fmt.Sprintf("本金：%.4f", r.Initial),
+		fmt.Sprintf("净值：%.4f", r.Final),
+		fmt.Sprintf("收益：%.2f%%", r.Return*100),
+		fmt.Sprintf("回撤：%.2f%%", r.MaxDrawdown*100),
+		fmt.Sprintf("交易：%d", r.Trades),
+		fmt.Sprintf("胜率：%.2f%% (%d/%d)", r.WinRate*100, r.Wins, r.Closed),
+		fmt.Sprintf("手续费：%.4f", r.Fees),
+	}
+	return strings.Join(lines, "\n")
+}
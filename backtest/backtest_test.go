@@ -0,0 +1,75 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/history"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func snapshot(t time.Time, rise int, doge, xrp float64, price float64) history.Snapshot {
+	m := map[string]*gateio.Pair{
+		"doge_usdt": {PercentChange: doge, Last: price},
+		"xrp_usdt":  {PercentChange: xrp, Last: 1},
+	}
+	for i := 0; i < 100; i++ {
+		p := &gateio.Pair{PercentChange: -1}
+		if i < rise {
+			p.PercentChange = 1
+		}
+		m[string(rune('a'+i%26))+string(rune('a'+i/26))+"_usdt"] = p
+	}
+	return history.Snapshot{Time: t, Tickers: m}
+}
+
+func TestRun(t *testing.T) {
+	Convey("should replay snapshots and report", t, func(c C) {
+		t0 := time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)
+		snaps := []history.Snapshot{
+			snapshot(t0, 70, 1, 1, 1),                       // rise: buy
+			snapshot(t0.Add(5*time.Second), 50, 1, 1, 2),    // none: hold
+			snapshot(t0.Add(10*time.Second), 30, -1, -1, 1), // fall: sell
+			snapshot(t0.Add(15*time.Second), 50, 1, 1, 1),   // none
+		}
+
+		r, err := Run(snaps, Config{Symbol: "doge_usdt", Strategy: "ripdog", Capital: 100})
+		c.So(err, ShouldBeNil)
+		c.So(r.Snapshots, ShouldEqual, 4)
+		c.So(r.Trades, ShouldEqual, 2)
+		c.So(r.Final, ShouldAlmostEqual, 100)
+		c.So(r.MaxDrawdown, ShouldAlmostEqual, 0.5)
+		c.So(r.Return, ShouldAlmostEqual, 0)
+		c.So(r.String(), ShouldContainSubstring, "ripdog")
+
+		c.So(r.Closed, ShouldEqual, 1)
+		c.So(r.Wins, ShouldEqual, 0)
+
+		_, err = Run(snaps, Config{Symbol: "doge_usdt", Strategy: "unknown", Capital: 100})
+		c.So(err, ShouldNotBeNil)
+
+		_, err = Run(nil, Config{Symbol: "doge_usdt", Strategy: "ripdog", Capital: 100})
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestWinRate(t *testing.T) {
+	Convey("should count wins of closed lots", t, func(c C) {
+		t0 := time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)
+		snaps := []history.Snapshot{
+			snapshot(t0, 70, 1, 1, 1),                       // rise: buy at 1
+			snapshot(t0.Add(5*time.Second), 30, -1, -1, 2),  // fall: sell at 2
+			snapshot(t0.Add(10*time.Second), 70, 1, 1, 2),   // rise: buy at 2
+			snapshot(t0.Add(15*time.Second), 30, -1, -1, 1), // fall: sell at 1
+		}
+
+		r, err := Run(snaps, Config{Symbol: "doge_usdt", Strategy: "ripdog", Capital: 100})
+		c.So(err, ShouldBeNil)
+		c.So(r.Trades, ShouldEqual, 4)
+		c.So(r.Closed, ShouldEqual, 2)
+		c.So(r.Wins, ShouldEqual, 1)
+		c.So(r.WinRate, ShouldAlmostEqual, 0.5)
+		c.So(r.String(), ShouldContainSubstring, "胜率：50.00% (1/2)")
+	})
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/modood/cts/config"
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/journal"
+	"github.com/modood/cts/strategy"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// bot trade a symbol following a strategy in its own goroutine
+	bot struct {
+		name     string
+		symbol   string
+		strategy string
+		sizer    exchange.Sizer // all in if nil
+
+		failures uint64       // errors since the last report
+		paused   int32        // signals are ignored if not 0 but risk rules are not, see the pause command
+		mu       sync.Mutex   // held by a trade, commands of the symbol wait for it
+		last     atomic.Value // journal.Entry of the last signal
+	}
+
+	// failure is an error of a bot
+	failure struct {
+		Time  time.Time `json:"time"`
+		Bot   string    `json:"bot"`
+		Error string    `json:"error"`
+	}
+
+	// failureLog keep the latest errors of all bots
+	failureLog struct {
+		mu    sync.Mutex
+		max   int
+		items []failure
+	}
+)
+
+// recent is the latest errors of bots
+var recent = &failureLog{max: 50}
+
+// newBots return bots of config
+func newBots(cfg *config.Config) ([]*bot, error) {
+	var r []*bot
+	for _, v := range cfg.AllBots() {
+		sz, err := exchange.ParseSizer(v.Sizing, v.MaxLeverage, cfg.Interval)
+		if err != nil {
+			err = fmt.Errorf("%s: %v", v.Name, err)
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		r = append(r, &bot{
+			name:     v.Name,
+			symbol:   v.Symbol,
+			strategy: v.Strategy,
+			sizer:    sz,
+		})
+	}
+	return r, nil
+}
+
+// run trade every interval until ctx is done. a trade in progress is not
+// cancelled by ctx, its requests are sent within another context which is
+// cancelled only if the trade is still running timeout after ctx is done, so
+// that it is not cut between borrowing, trading and repaying.
+func (b *bot) run(ctx context.Context, interval, timeout time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	work, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		select {
+		case <-time.After(timeout):
+		case <-work.Done():
+		}
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		// both may be ready, never start a trade after ctx is done
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.mu.Lock()
+		err := b.step(work)
+		b.mu.Unlock()
+		if err != nil {
+			b.handle(err)
+		}
+	}
+}
+
+// step trade once, or only check risk rules if it is paused, a panic is
+// recovered as an error so that other bots keep running
+func (b *bot) step(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	if atomic.LoadInt32(&b.paused) != 0 {
+		if err = b.protect(ctx); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		return nil
+	}
+
+	sig, inputs, err := explain(b.strategy)
+	r := journal.Entry{
+		Time:     time.Now(),
+		Kind:     journal.Signal,
+		Bot:      b.name,
+		Symbol:   b.symbol,
+		Strategy: b.strategy,
+		Signal:   strategy.SignalName(sig),
+		Inputs:   inputs,
+	}
+	if err != nil {
+		// the last signal is served by the api without auth
+		r.Error = util.Redact(err.Error())
+	}
+	b.last.Store(r)
+	if e := records.Append(r); e != nil {
+		log.Println(e)
+	}
+	if err != nil {
+		// the position is still guarded without signals
+		if e := b.protect(ctx); e != nil {
+			b.handle(e)
+		}
+		return errors.Wrap(err, util.FuncName())
+	}
+	meters.signals.Inc(b.name, r.Signal)
+
+	err = b.exec(ctx, sig)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	meters.lastCycle.Set(float64(time.Now().Unix()), b.name)
+	return nil
+}
+
+func (b *bot) exec(ctx context.Context, signal uint8) error {
+	s, err := venue.Symbol(ctx, b.symbol)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	t := track(s, b.name, b.symbol)
+
+	allowed := true
+	if guard != nil {
+		if _, err = guard.Check(t); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		allowed = guard.Allowed(s.Name(), signal)
+	}
+
+	if allowed {
+		if err = exchange.Apply(t, signal, b.sizer); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+	if err = measure(s, b.symbol); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// protect check risk rules of the symbol, which may flatten its position,
+// and measure it
+func (b *bot) protect(ctx context.Context) error {
+	s, err := venue.Symbol(ctx, b.symbol)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if guard != nil {
+		if _, err = guard.Check(track(s, b.name, b.symbol)); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+	if err = measure(s, b.symbol); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+func (b *bot) handle(err error) {
+	atomic.AddUint64(&b.failures, 1)
+	meters.errors.Inc(b.name)
+	// errors are served by the api without auth
+	recent.add(failure{Time: time.Now(), Bot: b.name, Error: util.Redact(err.Error())})
+	log.Println(b.name+":", err)
+}
+
+// lastSignal return the last signal, false if there is none yet
+func (b *bot) lastSignal() (journal.Entry, bool) {
+	e, ok := b.last.Load().(journal.Entry)
+	return e, ok
+}
+
+func (l *failureLog) add(f failure) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.items = append(l.items, f)
+	if len(l.items) > l.max {
+		l.items = l.items[len(l.items)-l.max:]
+	}
+}
+
+// list return errors from the latest
+func (l *failureLog) list() []failure {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := make([]failure, len(l.items))
+	for i, v := range l.items {
+		r[len(r)-1-i] = v
+	}
+	return r
+}
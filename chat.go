@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/modood/cts/dingtalk"
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/notify"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+const chatHelp = `命令：
+status：机器人状态
+balance：余额与净值
+pause [机器人|品种]：暂停交易，风控仍生效，默认全部
+resume [机器人|品种]：恢复交易，默认全部
+flatten [机器人|品种]：撤单、平仓、还款并暂停，默认全部
+cancel all：撤销全部挂单`
+
+// chat answer commands which mention the dingtalk outgoing robot, only users
+// of the whitelist are allowed
+type chat struct {
+	users map[string]bool // staff ids or sender ids
+	mu    sync.Mutex      // commands run one by one
+}
+
+var (
+	errNoBot = errors.New("no bot or symbol of the name")
+)
+
+// newChat return a chat which allows users by staff id or sender id
+func newChat(users []string) *chat {
+	ch := &chat{users: map[string]bool{}}
+	for _, v := range users {
+		ch.users[v] = true
+	}
+	return ch
+}
+
+// handle run a command and return the reply
+func (ch *chat) handle(in *dingtalk.Incoming) string {
+	who := in.SenderNick
+	if !ch.users[in.SenderStaffID] && !ch.users[in.SenderID] {
+		log.Printf("chat: %s (%s) is not allowed", who, in.SenderStaffID)
+		return "无权限：" + who
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	fields := strings.Fields(strings.ToLower(in.Text.Content))
+	if len(fields) == 0 {
+		return chatHelp
+	}
+	cmd, arg := fields[0], strings.Join(fields[1:], " ")
+	log.Printf("chat: %s: %s %s", who, cmd, arg)
+
+	ctx, cancel := detached()
+	defer cancel()
+	var r string
+	var err error
+	switch cmd {
+	case "status":
+		return status()
+	case "balance":
+		r, err = balance(ctx)
+	case "pause", "resume":
+		r, err = pause(arg, cmd == "pause")
+	case "flatten":
+		r, err = flatten(ctx, arg, who)
+	case "cancel":
+		if arg != "all" {
+			return chatHelp
+		}
+		r, err = cancelAll(ctx, who)
+	default:
+		return chatHelp
+	}
+	if err != nil {
+		return "失败：" + errors.Cause(err).Error()
+	}
+	if cmd != "balance" {
+		alerts.Post(notify.Trade, fmt.Sprintf("%s：%s %s\n%s", who, cmd, arg, r), false)
+	}
+	return r
+}
+
+// status return states of all bots
+func status() string {
+	lines := []string{"机器人："}
+	for _, v := range bots {
+		state := "运行中"
+		if atomic.LoadInt32(&v.paused) != 0 {
+			state = "已暂停"
+		}
+		if guard != nil && guard.Halted(v.symbol) {
+			state += "（风控停止）"
+		}
+		lines = append(lines, fmt.Sprintf("  %s：%s，品种 %s，策略 %s，错误 %d",
+			v.name, state, v.symbol, v.strategy, atomic.LoadUint64(&v.failures)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// balance return balances of symbols of all bots, and the account report
+func balance(ctx context.Context) (string, error) {
+	var lines []string
+	for _, symbol := range symbols(bots) {
+		s, err := venue.Symbol(ctx, symbol)
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+		state, err := exchange.State(s)
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+		lines = append(lines, "品种："+symbol, state)
+	}
+
+	acct, err := accountReport(ctx, false)
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+	return strings.Join(append(lines, acct), "\n"), nil
+}
+
+// pause pause or resume bots of a name or symbol, all if it is empty
+func pause(name string, paused bool) (string, error) {
+	bs, err := match(name)
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+
+	var v int32
+	state := "已恢复"
+	if paused {
+		v, state = 1, "已暂停"
+	}
+	var names []string
+	for _, b := range bs {
+		atomic.StoreInt32(&b.paused, v)
+		names = append(names, b.name)
+	}
+	return state + "：" + strings.Join(names, ", "), nil
+}
+
+// flatten pause bots of a name or symbol, all if it is empty, then flatten
+// and repay their symbols
+func flatten(ctx context.Context, name, who string) (string, error) {
+	bs, err := match(name)
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+	if _, err = pause(name, true); err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+
+	r, err := exit(ctx, symbols(bs), exchange.ExitFlatten, who)
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+	return r + "\n已暂停，发送 resume 恢复交易", nil
+}
+
+// cancelAll cancel open orders of symbols of all bots
+func cancelAll(ctx context.Context, who string) (string, error) {
+	r, err := exit(ctx, symbols(bots), exchange.ExitCancel, who)
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+	return r, nil
+}
+
+// exit leave symbols by an exit policy and return their states, trades of
+// bots of the symbols are waited for
+func exit(ctx context.Context, ss []string, policy, who string) (string, error) {
+	var lines []string
+	for _, symbol := range ss {
+		s, err := venue.Symbol(ctx, symbol)
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+		s = track(s, "chat:"+who, symbol)
+
+		unlock := lock(symbol)
+		err = exchange.Exit(s, policy)
+		unlock()
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+
+		state, err := exchange.State(s)
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+		lines = append(lines, "品种："+symbol, state)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// lock wait for trades of bots of a symbol, and hold them until unlock
+func lock(symbol string) (unlock func()) {
+	var held []*bot
+	for _, v := range bots {
+		if v.symbol == symbol {
+			v.mu.Lock()
+			held = append(held, v)
+		}
+	}
+	return func() {
+		for _, v := range held {
+			v.mu.Unlock()
+		}
+	}
+}
+
+// match return bots of a name or symbol, all if it is empty
+func match(name string) ([]*bot, error) {
+	if name == "" {
+		return bots, nil
+	}
+	var r []*bot
+	for _, v := range bots {
+		if strings.ToLower(v.name) == name || v.symbol == name {
+			r = append(r, v)
+		}
+	}
+	if len(r) == 0 {
+		err := fmt.Errorf("%v: %s", errNoBot, name)
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return r, nil
+}
+
+// symbols return unique symbols of bots
+func symbols(bs []*bot) []string {
+	var r []string
+	seen := map[string]bool{}
+	for _, v := range bs {
+		if !seen[v.symbol] {
+			seen[v.symbol] = true
+			r = append(r, v.symbol)
+		}
+	}
+	return r
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/modood/cts/dingtalk"
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/sim"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChat(t *testing.T) {
+	Convey("should run commands of whitelisted users", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Fee = 0
+		e.Leverage = 3
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(s.Borrow("usdt", 50), ShouldBeNil)
+
+		venue = e
+		defer func() { venue = fakeExchange{} }()
+		defer func(f func() (float64, error)) { usdtCNY = f }(usdtCNY)
+		usdtCNY = func() (float64, error) { return 6.5, nil }
+		bots = []*bot{
+			{name: "doge", symbol: "doge_usdt", strategy: "ripdog"},
+			{name: "doge2", symbol: "doge_usdt", strategy: "ripdog"},
+		}
+		defer func() { bots = nil }()
+
+		ch := newChat([]string{"0123"})
+		say := func(text string) string {
+			return ch.handle(&dingtalk.Incoming{
+				Text:          dingtalk.Text{Content: text},
+				SenderNick:    "modood",
+				SenderStaffID: "0123",
+			})
+		}
+
+		r := ch.handle(&dingtalk.Incoming{Text: dingtalk.Text{Content: "flatten"}, SenderNick: "eve"})
+		c.So(r, ShouldEqual, "无权限：eve")
+		c.So(say("help"), ShouldEqual, chatHelp)
+		c.So(say("cancel"), ShouldEqual, chatHelp)
+
+		c.So(say("pause DOGE"), ShouldEqual, "已暂停：doge")
+		c.So(say("status"), ShouldContainSubstring, "doge：已暂停，品种 doge_usdt")
+		c.So(say("status"), ShouldContainSubstring, "doge2：运行中")
+		c.So(say("resume"), ShouldEqual, "已恢复：doge, doge2")
+		c.So(say("pause xrp_usdt"), ShouldStartWith, "失败：no bot or symbol")
+
+		c.So(say(" balance "), ShouldContainSubstring, "负债 50.00000000")
+		c.So(say("cancel all"), ShouldStartWith, "品种：doge_usdt\n")
+
+		r = say("flatten doge_usdt")
+		c.So(r, ShouldContainSubstring, "usdt：可用 100.00000000，冻结 0.00000000，负债 0.00000000")
+		c.So(r, ShouldEndWith, "发送 resume 恢复交易")
+		c.So(bots[0].paused, ShouldEqual, 1)
+		c.So(bots[1].paused, ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/modood/cts/config"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// loadConfig load the config file and override it by flags which are set
+func loadConfig(c *cli.Context) (*config.Config, error) {
+	cfg, err := config.Load(c.String("config"))
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	strs := map[string]*string{
+		"symbol":         &cfg.Symbol,
+		"strategy":       &cfg.Strategy,
+		"key":            &cfg.Huobi.Key,
+		"secret":         &cfg.Huobi.Secret,
+		"dingtoken":      &cfg.DingTalk.Token,
+		"pending":        &cfg.Pending,
+		"journal":        &cfg.Journal,
+		"sizing":         &cfg.Sizing,
+		"exit-policy":    &cfg.Shutdown.Policy,
+		"chat-listen":    &cfg.Chat.Listen,
+		"api-listen":     &cfg.API.Listen,
+		"metrics-listen": &cfg.Metrics.Listen,
+		"risk-state":     &cfg.Risk.State,
+	}
+	for k, v := range strs {
+		if c.IsSet(k) {
+			*v = c.String(k)
+		}
+	}
+
+	floats := map[string]*float64{
+		"capital":        &cfg.Capital,
+		"max-leverage":   &cfg.MaxLeverage,
+		"stop-loss":      &cfg.Risk.StopLoss,
+		"trailing-stop":  &cfg.Risk.TrailingStop,
+		"take-profit":    &cfg.Risk.TakeProfit,
+		"max-daily-loss": &cfg.Risk.MaxDailyLoss,
+	}
+	for k, v := range floats {
+		if c.IsSet(k) {
+			*v = c.Float64(k)
+		}
+	}
+
+	if c.IsSet("shutdown-timeout") {
+		cfg.Shutdown.Timeout = c.Duration("shutdown-timeout")
+	}
+
+	if c.IsSet("paper") {
+		cfg.Paper = c.Bool("paper")
+	}
+
+	if err = cfg.ResolveSecrets(); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return cfg, nil
+}
@@ -0,0 +1,477 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mitchellh/mapstructure"
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/notify"
+	"github.com/modood/cts/secret"
+	"github.com/modood/cts/strategy"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron"
+)
+
+// EnvPrefix is the prefix of environment variables which override the config
+// file, e.g., CTS_SYMBOL, CTS_HUOBI_KEY, CTS_RISK_STOP_LOSS and
+// CTS_STRATEGIES_RIPDOG_RISE
+const EnvPrefix = "CTS_"
+
+type (
+	// Config is the configuration of the cts command
+	Config struct {
+		Symbol      string        `mapstructure:"symbol"`
+		Strategy    string        `mapstructure:"strategy"`
+		Interval    time.Duration `mapstructure:"interval"` // poll interval of strategy signals
+		Schedule    string        `mapstructure:"schedule"` // cron spec of dingtalk reports
+		Timezone    string        `mapstructure:"timezone"`
+		Pending     string        `mapstructure:"pending"` // file of unconfirmed orders
+		Journal     string        `mapstructure:"journal"` // file of signals, orders and loans, disabled if empty
+		Paper       bool          `mapstructure:"paper"`
+		Capital     float64       `mapstructure:"capital"` // initial quote currency of paper trading
+		Sizing      string        `mapstructure:"sizing"`
+		MaxLeverage float64       `mapstructure:"max-leverage"`
+
+		Huobi    Huobi    `mapstructure:"huobi"`
+		DingTalk DingTalk `mapstructure:"dingtalk"`
+		Telegram Telegram `mapstructure:"telegram"`
+		Slack    Slack    `mapstructure:"slack"`
+		SMTP     SMTP     `mapstructure:"smtp"`
+		Webhook  Webhook  `mapstructure:"webhook"`
+		Keystore Keystore `mapstructure:"keystore"`
+		Risk     Risk     `mapstructure:"risk"`
+		Shutdown Shutdown `mapstructure:"shutdown"`
+		Chat     Chat     `mapstructure:"chat"`
+		API      API      `mapstructure:"api"`
+		Metrics  Metrics  `mapstructure:"metrics"`
+
+		// parameters by strategy name
+		Strategies map[string]map[string]interface{} `mapstructure:"strategies"`
+
+		// bots run concurrently, only the top level symbol and strategy run
+		// if it is empty
+		Bots []Bot `mapstructure:"bots"`
+	}
+
+	// Bot trade a symbol following a strategy
+	Bot struct {
+		Name        string  `mapstructure:"name"` // symbol/strategy if empty
+		Symbol      string  `mapstructure:"symbol"`
+		Strategy    string  `mapstructure:"strategy"`
+		Sizing      string  `mapstructure:"sizing"`       // the top level one if empty
+		MaxLeverage float64 `mapstructure:"max-leverage"` // the top level one if 0
+	}
+
+	// Huobi is the api key of huobi, values may be secret references, see
+	// secret.Resolve
+	Huobi struct {
+		Key    string `mapstructure:"key"`
+		Secret string `mapstructure:"secret"`
+	}
+
+	// DingTalk is the group chat robot of dingtalk, the token may be a
+	// secret reference. notifiers are enabled if they are configured, and
+	// receive events of notify.Events, all if empty.
+	DingTalk struct {
+		Token   string   `mapstructure:"token"`
+		Secret  string   `mapstructure:"secret"`  // of the "加签" security setting, unsigned if empty
+		Format  string   `mapstructure:"format"`  // text or markdown
+		Mobiles []string `mapstructure:"mobiles"` // mentioned by urgent messages instead of everyone
+		Events  []string `mapstructure:"events"`
+	}
+
+	// Telegram is a telegram bot which sends to a chat, the token may be a
+	// secret reference
+	Telegram struct {
+		Token  string   `mapstructure:"token"`
+		ChatID string   `mapstructure:"chat-id"`
+		Events []string `mapstructure:"events"`
+	}
+
+	// Slack is an incoming webhook of slack, which may be a secret reference
+	Slack struct {
+		Webhook string   `mapstructure:"webhook"`
+		Events  []string `mapstructure:"events"`
+	}
+
+	// SMTP is an email server, the password may be a secret reference
+	SMTP struct {
+		Addr     string   `mapstructure:"addr"` // host:port
+		Username string   `mapstructure:"username"`
+		Password string   `mapstructure:"password"`
+		From     string   `mapstructure:"from"`
+		To       []string `mapstructure:"to"`
+		Events   []string `mapstructure:"events"`
+	}
+
+	// Webhook receive messages as JSON, the url may be a secret reference
+	Webhook struct {
+		URL    string   `mapstructure:"url"`
+		Events []string `mapstructure:"events"`
+	}
+
+	// Keystore is the encrypted file of secrets referred by keystore:<name>
+	Keystore struct {
+		File       string `mapstructure:"file"`
+		Passphrase string `mapstructure:"passphrase"` // env:<name> or file:<path> is recommended
+	}
+
+	// Risk is the rules of risk manager, fractions and disabled if 0.
+	// MaxDailyLoss applies to every symbol, not to the whole account.
+	Risk struct {
+		StopLoss     float64 `mapstructure:"stop-loss"`
+		TrailingStop float64 `mapstructure:"trailing-stop"`
+		TakeProfit   float64 `mapstructure:"take-profit"`
+		MaxDailyLoss float64 `mapstructure:"max-daily-loss"`
+		State        string  `mapstructure:"state"` // file of entry prices and halts of symbols, kept across restarts
+	}
+
+	// Shutdown is how to stop on SIGINT or SIGTERM, the current trade is
+	// waited for at most Timeout, then every symbol is left by Policy, see
+	// exchange.Exit
+	Shutdown struct {
+		Timeout time.Duration `mapstructure:"timeout"`
+		Policy  string        `mapstructure:"policy"`
+	}
+
+	// Chat is the callback of a dingtalk outgoing robot, which receives
+	// commands of users in the whitelist. it is disabled if Listen is empty,
+	// the secret is the AppSecret of the robot and may be a secret reference.
+	Chat struct {
+		Listen string   `mapstructure:"listen"` // host:port
+		Path   string   `mapstructure:"path"`
+		Secret string   `mapstructure:"secret"`
+		Users  []string `mapstructure:"users"` // staff ids or sender ids
+	}
+
+	// API is the HTTP server of status and control of running bots, it is
+	// disabled if Listen is empty. requests which change bots need the
+	// bearer token, which may be a secret reference.
+	API struct {
+		Listen string `mapstructure:"listen"` // host:port, the same one of chat is shared
+		Token  string `mapstructure:"token"`
+	}
+
+	// Metrics is the Prometheus endpoint /metrics, it is disabled if Listen
+	// is empty
+	Metrics struct {
+		Listen string `mapstructure:"listen"` // host:port, the same one of chat or api is shared
+	}
+)
+
+var (
+	errPassphraseInKeystore = errors.New("passphrase of keystore can not be in the keystore")
+)
+
+// Default return the default configuration
+func Default() *Config {
+	return &Config{
+		Interval: time.Second * 5,
+		Schedule: "0 0 7-23,0 * * *",
+		Timezone: "Asia/Chongqing",
+		Pending:  ".cts-pending.json",
+		Journal:  ".cts-journal.jsonl",
+		Capital:  1000,
+		Sizing:   "allin",
+		DingTalk: DingTalk{Format: "text"},
+		Keystore: Keystore{
+			File:       ".cts-keystore",
+			Passphrase: secret.Env + "CTS_KEYSTORE_PASSPHRASE",
+		},
+		Risk: Risk{State: ".cts-risk.json"},
+		Shutdown: Shutdown{
+			Timeout: time.Second * 30,
+			Policy:  exchange.ExitNone,
+		},
+		Chat: Chat{Path: "/dingtalk"},
+	}
+}
+
+// ResolveSecrets replace secret references of credentials by their values,
+// the keystore is opened only if it is referred
+func (c *Config) ResolveSecrets() error {
+	var ks *secret.Store
+	open := func() (*secret.Store, error) {
+		if ks != nil {
+			return ks, nil
+		}
+		if strings.HasPrefix(c.Keystore.Passphrase, secret.Keystore) {
+			return nil, errors.Wrap(errPassphraseInKeystore, util.FuncName())
+		}
+		p, err := secret.Resolve(c.Keystore.Passphrase, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		if ks, err = secret.Open(c.Keystore.File, p); err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		return ks, nil
+	}
+
+	for _, v := range []*string{&c.Huobi.Key, &c.Huobi.Secret, &c.DingTalk.Token, &c.DingTalk.Secret,
+		&c.Telegram.Token, &c.Slack.Webhook, &c.SMTP.Password, &c.Webhook.URL, &c.Chat.Secret, &c.API.Token} {
+		if *v == "" {
+			continue
+		}
+		s, err := secret.Resolve(*v, open)
+		if err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		*v = s
+	}
+	return nil
+}
+
+// AllBots return bots to run, empty fields are filled by the top level ones
+func (c *Config) AllBots() []Bot {
+	bs := c.Bots
+	if len(bs) == 0 {
+		bs = []Bot{{Symbol: c.Symbol, Strategy: c.Strategy}}
+	}
+
+	r := make([]Bot, len(bs))
+	for i, v := range bs {
+		if v.Symbol == "" {
+			v.Symbol = c.Symbol
+		}
+		if v.Strategy == "" {
+			v.Strategy = c.Strategy
+		}
+		if v.Sizing == "" {
+			v.Sizing = c.Sizing
+		}
+		if v.MaxLeverage == 0 {
+			v.MaxLeverage = c.MaxLeverage
+		}
+		if v.Name == "" {
+			v.Name = v.Symbol + "/" + v.Strategy
+		}
+		r[i] = v
+	}
+	return r
+}
+
+// Load read a TOML config file over the default configuration, then
+// override it by environment variables. the file is optional if name is
+// empty. unknown keys are errors.
+func Load(name string) (*Config, error) {
+	m := map[string]interface{}{}
+	if name != "" {
+		if _, err := toml.DecodeFile(name, &m); err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+	}
+
+	if err := env(m, os.Environ()); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	c := Default()
+	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           c,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	if err = d.Decode(m); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	return c, nil
+}
+
+// Validate check the configuration, all problems are reported at once
+func (c *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, a...))
+		}
+	}
+
+	ss := strategy.Strategies()
+	names := map[string]bool{}
+	for _, b := range c.AllBots() {
+		check(len(strings.Split(b.Symbol, "_")) == 2,
+			"%s: symbol should be like doge_usdt: %q", b.Name, b.Symbol)
+		_, ok := ss[b.Strategy]
+		check(ok, "%s: unknown strategy %q, available: %s",
+			b.Name, b.Strategy, strings.Join(strategy.Available(), ", "))
+		_, err := exchange.ParseSizer(b.Sizing, b.MaxLeverage, c.Interval)
+		check(err == nil, "%s: %v", b.Name, errors.Cause(err))
+		check(b.MaxLeverage >= 0, "%s: max-leverage should not be negative: %v", b.Name, b.MaxLeverage)
+		check(!names[b.Name], "duplicate bot name: %s", b.Name)
+		names[b.Name] = true
+	}
+	if err := strategy.Configure(ss, c.Strategies); err != nil {
+		check(false, "strategies: %v", errors.Cause(err))
+	}
+
+	check(c.Interval > 0, "interval should be greater than 0: %s", c.Interval)
+	_, err := cron.Parse(c.Schedule)
+	check(c.Schedule != "" && err == nil, "invalid schedule %q: %v", c.Schedule, err)
+	_, err = time.LoadLocation(c.Timezone)
+	check(err == nil, "invalid timezone %q: %v", c.Timezone, err)
+
+	if c.Paper {
+		check(c.Capital > 0, "capital should be greater than 0: %v", c.Capital)
+	} else {
+		check(c.Huobi.Key != "" && c.Huobi.Secret != "",
+			"huobi key and secret are required unless paper trading")
+	}
+
+	for k, v := range map[string]float64{
+		"stop-loss":      c.Risk.StopLoss,
+		"trailing-stop":  c.Risk.TrailingStop,
+		"take-profit":    c.Risk.TakeProfit,
+		"max-daily-loss": c.Risk.MaxDailyLoss,
+	} {
+		check(v >= 0 && (v < 1 || k == "take-profit"), "risk.%s should be a fraction: %v", k, v)
+	}
+
+	for k, v := range map[string][]string{
+		"dingtalk": c.DingTalk.Events,
+		"telegram": c.Telegram.Events,
+		"slack":    c.Slack.Events,
+		"smtp":     c.SMTP.Events,
+		"webhook":  c.Webhook.Events,
+	} {
+		err := notify.CheckEvents(v)
+		check(err == nil, "%s.events: %v", k, errors.Cause(err))
+	}
+	check(c.DingTalk.Format == "text" || c.DingTalk.Format == "markdown",
+		"dingtalk.format should be text or markdown: %q", c.DingTalk.Format)
+	check(c.Telegram.Token == "" || c.Telegram.ChatID != "", "telegram.chat-id is required")
+	check(c.SMTP.Addr == "" || (c.SMTP.From != "" && len(c.SMTP.To) != 0),
+		"smtp.from and smtp.to are required")
+
+	check(c.Shutdown.Timeout > 0, "shutdown.timeout should be greater than 0: %s", c.Shutdown.Timeout)
+	ok := false
+	for _, v := range exchange.ExitPolicies() {
+		ok = ok || v == c.Shutdown.Policy
+	}
+	check(ok, "unknown shutdown.policy %q, available: %s",
+		c.Shutdown.Policy, strings.Join(exchange.ExitPolicies(), ", "))
+
+	if c.Chat.Listen != "" {
+		check(c.Chat.Secret != "", "chat.secret is required")
+		check(len(c.Chat.Users) != 0, "chat.users is required")
+		check(strings.HasPrefix(c.Chat.Path, "/"), "chat.path should start with /: %q", c.Chat.Path)
+	}
+	check(c.API.Listen == "" || c.API.Token != "", "api.token is required")
+
+	if len(errs) != 0 {
+		err = fmt.Errorf("invalid config:\n  %s", strings.Join(errs, "\n  "))
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// env set values of environment variables into m, a variable is the path of
+// a key in upper case, where dots and dashes are underscores. a list is
+// separated by commas, e.g., CTS_DINGTALK_EVENTS=trade,error, and arrays of
+// tables, i.e., bots, can not be set.
+func env(m map[string]interface{}, environ []string) error {
+	vars := map[string]string{}
+	for _, v := range environ {
+		if i := strings.Index(v, "="); i > 0 && strings.HasPrefix(v, EnvPrefix) {
+			vars[v[:i]] = v[i+1:]
+		}
+	}
+
+	for p, list := range paths("", reflect.TypeOf(Config{})) {
+		v, ok := vars[envName(p)]
+		if !ok {
+			continue
+		}
+		var x interface{} = v
+		if list {
+			x = split(v)
+		}
+		if err := set(m, p, x); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+
+	// strategy parameters are unknown here, e.g., CTS_STRATEGIES_RIPDOG_RISE
+	prefix := EnvPrefix + "STRATEGIES_"
+	for k, v := range vars {
+		n := strings.SplitN(strings.TrimPrefix(k, prefix), "_", 2)
+		if !strings.HasPrefix(k, prefix) || len(n) != 2 {
+			continue
+		}
+		p := "strategies." + strings.ToLower(n[0]) + "." +
+			strings.ToLower(strings.Replace(n[1], "_", "-", -1))
+		if err := set(m, p, v); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+	return nil
+}
+
+// paths return dotted keys of all scalar fields and lists of scalars of a
+// struct type, and whether they are lists
+func paths(prefix string, t reflect.Type) map[string]bool {
+	r := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		k := prefix + f.Tag.Get("mapstructure")
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			for p, list := range paths(k+".", f.Type) {
+				r[p] = list
+			}
+		case reflect.Slice:
+			if e := f.Type.Elem().Kind(); e != reflect.Struct && e != reflect.Map && e != reflect.Slice {
+				r[k] = true
+			}
+		case reflect.Map:
+		default:
+			r[k] = false
+		}
+	}
+	return r
+}
+
+// split return items of a comma separated list, empty ones are ignored
+func split(s string) []string {
+	r := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+func envName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+}
+
+// set the value of a dotted key in m, tables on the path are created
+func set(m map[string]interface{}, path string, v interface{}) error {
+	ks := strings.Split(path, ".")
+	t := m
+	for _, k := range ks[:len(ks)-1] {
+		x, ok := t[k]
+		if !ok {
+			x = map[string]interface{}{}
+			t[k] = x
+		}
+		if t, ok = x.(map[string]interface{}); !ok {
+			err := fmt.Errorf("%s is not a table", k)
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+	t[ks[len(ks)-1]] = v
+	return nil
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoad(t *testing.T) {
+	Convey("should load the config file and environment variables", t, func(c C) {
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		name := filepath.Join(dir, "cts.toml")
+		c.So(ioutil.WriteFile(name, []byte(`
+symbol = "doge_usdt"
+strategy = "ripdog"
+interval = "10s"
+paper = true
+
+[risk]
+stop-loss = 0.05
+
+[shutdown]
+policy = "flatten"
+
+[strategies.ripdog]
+rise = 70
+`), 0600), ShouldBeNil)
+
+		os.Setenv("CTS_SYMBOL", "xrp_usdt")
+		os.Setenv("CTS_RISK_MAX_DAILY_LOSS", "0.1")
+		os.Setenv("CTS_STRATEGIES_RIPDOG_CHANGE", "3")
+		defer os.Unsetenv("CTS_SYMBOL")
+		defer os.Unsetenv("CTS_RISK_MAX_DAILY_LOSS")
+		defer os.Unsetenv("CTS_STRATEGIES_RIPDOG_CHANGE")
+
+		cfg, err := Load(name)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Symbol, ShouldEqual, "xrp_usdt")
+		c.So(cfg.Interval, ShouldEqual, time.Second*10)
+		c.So(cfg.Schedule, ShouldEqual, Default().Schedule)
+		c.So(cfg.Capital, ShouldEqual, 1000)
+		c.So(cfg.Risk.StopLoss, ShouldEqual, 0.05)
+		c.So(cfg.Risk.MaxDailyLoss, ShouldEqual, 0.1)
+		c.So(cfg.Risk.State, ShouldEqual, ".cts-risk.json")
+		c.So(cfg.Shutdown.Policy, ShouldEqual, "flatten")
+		c.So(cfg.Shutdown.Timeout, ShouldEqual, time.Second*30)
+		c.So(cfg.Strategies["ripdog"], ShouldResemble, map[string]interface{}{"rise": int64(70), "change": "3"})
+		c.So(cfg.Validate(), ShouldBeNil)
+
+		c.So(ioutil.WriteFile(name, []byte("unknown = 1"), 0600), ShouldBeNil)
+		_, err = Load(name)
+		c.So(err, ShouldNotBeNil)
+
+		_, err = Load(filepath.Join(dir, "none.toml"))
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestLoadTOML(t *testing.T) {
+	Convey("should load any valid TOML and lists of environment variables", t, func(c C) {
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		name := filepath.Join(dir, "cts.toml")
+		c.So(ioutil.WriteFile(name, []byte(`
+"symbol" = "doge_usdt"
+strategy = "ripdog"
+risk = { stop-loss = 0.05, take-profit = 0.1 }
+
+[dingtalk]
+token = "a\tb\u00e9"
+events = [
+  "trade",
+  "error", # comment
+]
+
+[smtp]
+to = ['a@example.com', "b@example.com"]
+`), 0600), ShouldBeNil)
+
+		os.Setenv("CTS_SMTP_TO", "c@example.com, d@example.com,")
+		os.Setenv("CTS_CHAT_USERS", "u1,u2")
+		defer os.Unsetenv("CTS_SMTP_TO")
+		defer os.Unsetenv("CTS_CHAT_USERS")
+
+		cfg, err := Load(name)
+		c.So(err, ShouldBeNil)
+		c.So(cfg.Symbol, ShouldEqual, "doge_usdt")
+		c.So(cfg.Risk.StopLoss, ShouldEqual, 0.05)
+		c.So(cfg.Risk.TakeProfit, ShouldEqual, 0.1)
+		c.So(cfg.DingTalk.Token, ShouldEqual, "a\tb\u00e9")
+		c.So(cfg.DingTalk.Events, ShouldResemble, []string{"trade", "error"})
+		c.So(cfg.SMTP.To, ShouldResemble, []string{"c@example.com", "d@example.com"})
+		c.So(cfg.Chat.Users, ShouldResemble, []string{"u1", "u2"})
+
+		c.So(ioutil.WriteFile(name, []byte("a = \"unclosed"), 0600), ShouldBeNil)
+		_, err = Load(name)
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	Convey("should report all problems", t, func(c C) {
+		cfg := Default()
+		cfg.Symbol = "doge"
+		cfg.Strategy = "xxx"
+		cfg.Schedule = "0 0"
+		cfg.Timezone = "Mars/Olympus"
+		cfg.Sizing = "fixed:-1"
+		cfg.Risk.StopLoss = 2
+		cfg.Shutdown.Policy = "sell"
+		cfg.Slack.Events = []string{"trades"}
+		cfg.Telegram.Token = "123:abc"
+		cfg.DingTalk.Format = "html"
+		cfg.Chat.Listen = ":8090"
+		cfg.API.Listen = ":8091"
+		cfg.Strategies = map[string]map[string]interface{}{"ripdog": {"xxx": 1}}
+
+		err := cfg.Validate()
+		c.So(err, ShouldNotBeNil)
+		for _, v := range []string{"symbol", "unknown strategy", "strategies", "schedule",
+			"timezone", "huobi key", "sizing", "risk.stop-loss",
+			"shutdown.policy", "slack.events", "telegram.chat-id",
+			"dingtalk.format", "chat.secret", "chat.users", "api.token"} {
+			c.So(err.Error(), ShouldContainSubstring, v)
+		}
+	})
+}
+
+func TestResolveSecrets(t *testing.T) {
+	Convey("should resolve references of credentials", t, func(c C) {
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		name := filepath.Join(dir, "token")
+		c.So(ioutil.WriteFile(name, []byte("dingtalk-token\n"), 0600), ShouldBeNil)
+		os.Setenv("CTS_TEST_HUOBI_SECRET", "huobi-secret")
+		defer os.Unsetenv("CTS_TEST_HUOBI_SECRET")
+
+		cfg := Default()
+		cfg.Huobi.Key = "huobi-key"
+		cfg.Huobi.Secret = "env:CTS_TEST_HUOBI_SECRET"
+		cfg.DingTalk.Token = "file:" + name
+		c.So(cfg.ResolveSecrets(), ShouldBeNil)
+		c.So(cfg.Huobi.Secret, ShouldEqual, "huobi-secret")
+		c.So(cfg.DingTalk.Token, ShouldEqual, "dingtalk-token")
+
+		cfg.Huobi.Secret = "keystore:huobi"
+		cfg.Keystore.Passphrase = "keystore:passphrase"
+		c.So(cfg.ResolveSecrets(), ShouldNotBeNil)
+	})
+}
+
+func TestAllBots(t *testing.T) {
+	Convey("should fill bots by the top level config", t, func(c C) {
+		cfg := Default()
+		cfg.Symbol = "doge_usdt"
+		cfg.Strategy = "ripdog"
+		cfg.Paper = true
+		c.So(cfg.AllBots(), ShouldResemble, []Bot{
+			{Name: "doge_usdt/ripdog", Symbol: "doge_usdt", Strategy: "ripdog", Sizing: "allin"},
+		})
+
+		cfg.Bots = []Bot{
+			{Symbol: "xrp_usdt", Sizing: "fraction:0.5"},
+			{Name: "doge", MaxLeverage: 2},
+		}
+		c.So(cfg.AllBots(), ShouldResemble, []Bot{
+			{Name: "xrp_usdt/ripdog", Symbol: "xrp_usdt", Strategy: "ripdog", Sizing: "fraction:0.5"},
+			{Name: "doge", Symbol: "doge_usdt", Strategy: "ripdog", Sizing: "allin", MaxLeverage: 2},
+		})
+		c.So(cfg.Validate(), ShouldBeNil)
+
+		cfg.Bots = append(cfg.Bots, Bot{Name: "doge", Symbol: "btc", Strategy: "x"})
+		err := cfg.Validate()
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "duplicate bot name: doge")
+		c.So(err.Error(), ShouldContainSubstring, `doge: symbol should be like doge_usdt: "btc"`)
+	})
+}
@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	ossignal "os/signal"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/modood/cts/dingtalk"
+	"github.com/modood/cts/exchange"
 	"github.com/modood/cts/gateio"
 	"github.com/modood/cts/huobi"
+	"github.com/modood/cts/journal"
+	"github.com/modood/cts/notify"
+	"github.com/modood/cts/risk"
+	"github.com/modood/cts/sim"
 	"github.com/modood/cts/strategy"
 	"github.com/modood/cts/util"
 	"github.com/pkg/errors"
@@ -20,7 +28,14 @@ import (
 
 var (
 	strategies = strategy.Strategies()
-	count      uint64
+	bots       []*bot
+
+	venue  exchange.Exchange // huobi.Exchange of the account, or paper trading
+	quotes = gateio.NewClient("", nil)
+	guard  *risk.Manager // no risk control if nil
+
+	records *journal.Journal // no journal if nil
+	alerts  *notify.Router   // only logs if nil
 )
 
 func init() {
@@ -32,12 +47,20 @@ func init() {
 }
 
 func main() {
+	// secrets are registered when they are loaded
+	log.SetOutput(util.RedactWriter(os.Stderr))
+
 	app := cli.NewApp()
 	app.Name = "cts"
 	app.Usage = "the coin trading strategy"
 	app.Version = "0.0.1"
 	app.Author = "modood - https://github.com/modood"
 	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "TOML config file, flags and CTS_* environment variables override it",
+			EnvVar: "CTS_CONFIG",
+		},
 		cli.StringFlag{
 			Name:  "symbol",
 			Usage: "symbol name, quote symbol should be usdt(e.g., btc_usdt, xrp_usdt, etc.)",
@@ -48,60 +71,207 @@ func main() {
 		},
 		cli.StringFlag{
 			Name:  "key",
-			Usage: "your huobi api key",
+			Usage: "your huobi api key, or a reference: env:<name>, file:<path> or keystore:<name>",
 		},
 		cli.StringFlag{
 			Name:  "secret",
-			Usage: "your huobi api secret",
+			Usage: "reference of your huobi api secret: env:<name>, file:<path> or keystore:<name>, a plain secret is visible in ps",
 		},
 		cli.StringFlag{
 			Name:  "dingtoken",
-			Usage: "your access token of dingtalk group chat robot",
+			Usage: "reference of your access token of dingtalk group chat robot, like --secret",
+		},
+		cli.StringFlag{
+			Name:  "pending",
+			Usage: "file of unconfirmed orders, which are checked before placing again after restart (default: .cts-pending.json)",
+		},
+		cli.StringFlag{
+			Name:  "journal",
+			Usage: "file of signals, orders and loans, see the journal command, disabled if empty (default: .cts-journal.jsonl)",
+		},
+		cli.BoolFlag{
+			Name:  "paper",
+			Usage: "paper trading, send orders to a simulated account instead of huobi, journaled apart, e.g., .cts-journal.paper.jsonl",
+		},
+		cli.Float64Flag{
+			Name:  "capital",
+			Usage: "initial balance of quote currency in paper trading (default: 1000)",
+		},
+		cli.StringFlag{
+			Name:  "sizing",
+			Usage: "position sizing: allin, fixed:<quote>, fraction:<ratio> or vol:<annual target>[:<window>] (default: allin)",
+		},
+		cli.Float64Flag{
+			Name:  "max-leverage",
+			Usage: "max position value / equity of sizing, no limit if 0, vol sizing needs it",
+		},
+		cli.Float64Flag{
+			Name:  "stop-loss",
+			Usage: "close a position which loses this fraction of its entry price, e.g., 0.05, disabled if 0",
+		},
+		cli.Float64Flag{
+			Name:  "trailing-stop",
+			Usage: "close a position which retreats this fraction from its best price, disabled if 0",
+		},
+		cli.Float64Flag{
+			Name:  "take-profit",
+			Usage: "close a position which gains this fraction of its entry price, disabled if 0",
+		},
+		cli.Float64Flag{
+			Name:  "max-daily-loss",
+			Usage: "close the position of a symbol and halt its trading for the day when its equity, not of the whole account, loses this fraction, disabled if 0",
+		},
+		cli.StringFlag{
+			Name:  "risk-state",
+			Usage: "file of entry prices and halts of symbols, which are kept for risk rules after restart (default: .cts-risk.json)",
+		},
+		cli.DurationFlag{
+			Name:  "shutdown-timeout",
+			Usage: "max time to wait for trades in progress on SIGINT or SIGTERM (default: 30s)",
+		},
+		cli.StringFlag{
+			Name:  "chat-listen",
+			Usage: "address of the callback of a dingtalk outgoing robot which receives commands, e.g., :8090, disabled if empty",
+		},
+		cli.StringFlag{
+			Name:  "api-listen",
+			Usage: "address of the HTTP API of status and control, e.g., 127.0.0.1:8091, disabled if empty",
+		},
+		cli.StringFlag{
+			Name:  "metrics-listen",
+			Usage: "address of the Prometheus endpoint /metrics, e.g., :9100, disabled if empty",
+		},
+		cli.StringFlag{
+			Name:  "exit-policy",
+			Usage: "what to do with symbols on exit: " + strings.Join(exchange.ExitPolicies(), ", ") + " (default: none)",
 		},
 	}
 	app.Action = action
+	app.Commands = []cli.Command{
+		backtestCommand(),
+		recordCommand(),
+		keystoreCommand(),
+		journalCommand(),
+	}
 	if err := app.Run(os.Args); err != nil {
 		log.Fatalln(err)
 	}
 }
 
 func action(c *cli.Context) error {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
 	log.Println("running...")
 
-	huobi.Init(c.String("key"), c.String("secret"))
-	dingtalk.Init(c.String("dingtoken"))
-	symbol := c.String("symbol")
-	stra := c.String("strategy")
+	if time.Local, err = time.LoadLocation(cfg.Timezone); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
 
-	// cron job
-	cr := schedule()
-	cr.Start()
+	// all bots share market data fetched once in a poll interval
+	quotes.Observe = observe("gateio")
+	feed := strategy.NewCache(cfg.Interval/2, quotes)
+	strategies = strategy.NewStrategies(feed)
+	if err = strategy.Configure(strategies, cfg.Strategies); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if bots, err = newBots(cfg); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	account := huobi.NewClient("", cfg.Huobi.Key, cfg.Huobi.Secret, nil, nil)
+	if err = account.SetPendingFile(cfg.Pending); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	alerts = newNotifier(cfg)
+	account.Notify = func(text string) { alerts.Post(notify.Trade, text, true) }
+	account.Observe = observe("huobi")
+	venue = huobi.Exchange{Client: account}
 
-	for {
-		time.Sleep(time.Second * 5)
+	if cfg.Journal != "" {
+		name := cfg.Journal
+		if cfg.Paper {
+			// simulated trades are not mixed with the real ones
+			name = paperJournal(name)
+		}
+		if records, err = journal.Open(name); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		defer records.Close()
+	}
 
-		sig, err := signal(stra)
-		if err != nil {
-			handle(err)
-			continue
+	guard = risk.NewManager(cfg.Risk.StopLoss, cfg.Risk.TrailingStop,
+		cfg.Risk.TakeProfit, cfg.Risk.MaxDailyLoss)
+	if !guard.Enabled() {
+		guard = nil
+	} else {
+		guard.Notify = func(text string) { alerts.Post(notify.Error, text, true) }
+		// positions of paper trading are not real
+		if !cfg.Paper {
+			if err = guard.SetStateFile(cfg.Risk.State); err != nil {
+				return errors.Wrap(err, util.FuncName())
+			}
 		}
+	}
 
-		err = exec(sig, symbol)
+	if cfg.Paper {
+		var symbols []string
+		for _, v := range bots {
+			symbols = append(symbols, v.symbol)
+		}
+		e, err := newPaper(context.Background(), symbols, cfg.Capital, feed.Ticker, venue)
 		if err != nil {
-			handle(err)
-			continue
+			return errors.Wrap(err, util.FuncName())
 		}
+		venue = e
+		log.Println("paper trading...")
 	}
-}
 
-func signal(str string) (uint8, error) {
-	s, ok := strategies[str]
-	if !ok {
-		err := fmt.Errorf("unknown strategy: %s", str)
-		return strategy.SigNone, errors.Wrap(err, util.FuncName())
+	// cron job
+	cr := schedule(cfg.Schedule)
+	cr.Start()
+
+	quit := make(chan os.Signal, 1)
+	ossignal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	ctx, stop := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, v := range bots {
+		log.Println("bot:", v.name)
+		wg.Add(1)
+		go func(b *bot) {
+			defer wg.Done()
+			b.run(ctx, cfg.Interval, cfg.Shutdown.Timeout)
+		}(v)
 	}
 
-	sig, err := s.Signal()
+	srvs := serve(cfg)
+	for _, v := range srvs {
+		log.Println("listening:", v.Addr)
+	}
+
+	sig := <-quit
+	log.Println("stopping...", sig)
+	cr.Stop()
+	for _, v := range srvs {
+		// commands must not trade while leaving
+		if err = v.Close(); err != nil {
+			log.Println(err)
+		}
+	}
+	stop()
+
+	err = shutdown(&wg, quit, cfg.Shutdown)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	log.Println("stopped")
+	return nil
+}
+
+func signal(str string) (uint8, error) {
+	sig, _, err := explain(str)
 	if err != nil {
 		return strategy.SigNone, errors.Wrap(err, util.FuncName())
 	}
@@ -109,64 +279,69 @@ func signal(str string) (uint8, error) {
 	return sig, nil
 }
 
-func exec(signal uint8, symbol string) error {
-	s, err := huobi.NewSymbol(symbol)
-	if err != nil {
-		return errors.Wrap(err, util.FuncName())
+// explain return the signal of a strategy and its inputs, which are nil
+// unless the strategy is a strategy.Explainer
+func explain(str string) (uint8, map[string]float64, error) {
+	s, ok := strategies[str]
+	if !ok {
+		err := fmt.Errorf("unknown strategy: %s", str)
+		return strategy.SigNone, nil, errors.Wrap(err, util.FuncName())
 	}
 
-	switch signal {
-	case strategy.SigRise:
-		err = s.AllIn("BUY", false)
-	case strategy.SigFall:
-		err = s.AllIn("SELL", false)
-	case strategy.SigBull:
-		err = s.AllIn("BUY", true)
-	case strategy.SigBear:
-		err = s.AllIn("SELL", true)
-	case strategy.SigNone:
-		fallthrough
-	default:
-		// do nothing
+	if e, ok := s.(strategy.Explainer); ok {
+		sig, inputs, err := e.Explain()
+		if err != nil {
+			return strategy.SigNone, nil, errors.Wrap(err, util.FuncName())
+		}
+		return sig, inputs, nil
 	}
+
+	sig, err := s.Signal()
 	if err != nil {
-		return errors.Wrap(err, util.FuncName())
+		return strategy.SigNone, nil, errors.Wrap(err, util.FuncName())
 	}
-	return nil
-}
 
-func handle(err error) {
-	atomic.AddUint64(&count, 1)
-	log.Println(err)
+	return sig, nil, nil
 }
 
-func schedule() *cron.Cron {
+func schedule(spec string) *cron.Cron {
 	c := cron.New()
-	err := c.AddFunc("0 0 7-23,0 * * *", func() {
-		rise, fall, err := gateio.Trend()
+	err := c.AddFunc(spec, func() {
+		ctx := context.Background()
+		rise, fall, err := quotes.Trend(ctx)
 		if err != nil {
-			e := dingtalk.Push(err.Error(), false)
-			if e != nil {
-				log.Println(e, err)
-			}
+			alerts.Post(notify.Error, err.Error(), false)
 			return
 		}
 
+		var count uint64
+		var lines []string
+		for _, v := range bots {
+			n := atomic.SwapUint64(&v.failures, 0)
+			count += n
+			lines = append(lines, fmt.Sprintf("  %s: %d", v.name, n))
+		}
+
 		msg := fmt.Sprintf("%s\n监控：%d Error(s)\n行情：%d↑, %d↓",
-			time.Now().Format("2006-01-02 15:04:05"),
-			atomic.LoadUint64(&count), rise, fall)
-		atomic.StoreUint64(&count, 0)
+			time.Now().Format("2006-01-02 15:04:05"), count, rise, fall)
+		if len(bots) > 1 {
+			msg = strings.Replace(msg, "\n行情", "\n"+strings.Join(lines, "\n")+"\n行情", 1)
+		}
 
-		err = dingtalk.Push(msg, false)
+		acct, err := accountReport(ctx, true)
 		if err != nil {
-			log.Println(err)
+			acct = err.Error()
+		}
+		msg += "\n" + acct
+
+		if e, ok := venue.(*sim.Exchange); ok {
+			msg += "\n" + paperReport(ctx, e)
 		}
+
+		alerts.Post(notify.Report, msg, false)
 	})
 	if err != nil {
-		e := dingtalk.Push(err.Error(), false)
-		if e != nil {
-			log.Println(e, err)
-		}
+		alerts.Post(notify.Error, err.Error(), false)
 	}
 
 	return c
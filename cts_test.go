@@ -1,41 +1,486 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/modood/cts/config"
+	"github.com/modood/cts/dingtalk"
+	"github.com/modood/cts/exchange"
 	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/huobi"
+	"github.com/modood/cts/journal"
+	"github.com/modood/cts/mock"
+	"github.com/modood/cts/notify"
+	"github.com/modood/cts/risk"
+	"github.com/modood/cts/sim"
 	"github.com/modood/cts/strategy"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+var ctx = context.Background()
+
+// newMock return a mock server where 67 of usdt pairs rise, and doge_usdt
+// and xrp_usdt change by percent
+func newMock(percent float64) *mock.Server {
+	srv := mock.NewServer()
+	setMarket(srv, percent)
+	return srv
+}
+
+// setMarket set tickers of the mock server, so that ripdog signals bull if
+// percent > 4.4, or bear if percent < -4.4
+func setMarket(srv *mock.Server, percent float64) {
+	for i := 0; i < 67; i++ {
+		srv.SetTicker(fmt.Sprintf("coin%d_usdt", i), mock.Ticker{Last: 1, PercentChange: percent})
+	}
+	srv.SetTicker("doge_usdt", mock.Ticker{Last: 0.002, PercentChange: percent})
+	srv.SetTicker("xrp_usdt", mock.Ticker{Last: 0.5, PercentChange: percent})
+}
+
 func TestSignal(t *testing.T) {
 	Convey("should refresh balance cache unsuccessfully", t, func(c C) {
+		srv := newMock(5)
+		defer srv.Close()
+		defer func(m map[string]strategy.Strategy) { strategies = m }(strategies)
+		strategies = strategy.NewStrategies(strategy.NewLive(gateio.NewClient(srv.URL, nil)))
+
 		sl := strategy.Available()
 
 		for _, v := range sl {
 			sig, err := signal(v)
-			So(err, ShouldBeNil)
-			So(strategy.Signals(), ShouldContain, sig)
+			c.So(err, ShouldBeNil)
+			c.So(strategy.Signals(), ShouldContain, sig)
 		}
 
 		sig, err := signal("xxxxxx")
-		So(err, ShouldNotBeNil)
-		So(sig, ShouldEqual, strategy.SigNone)
+		c.So(err, ShouldNotBeNil)
+		c.So(sig, ShouldEqual, strategy.SigNone)
 
 	})
 }
 
+func TestEndToEnd(t *testing.T) {
+	Convey("should trade signals of gateio on huobi and notify with no network", t, func(c C) {
+		srv := newMock(5)
+		defer srv.Close()
+		srv.AddKey("key", "secret")
+		srv.Deposit("key", "xrp_usdt", "usdt", 100)
+		srv.AddRobot("token", "robot-secret")
+
+		defer func(m map[string]strategy.Strategy, e exchange.Exchange, r *notify.Router) {
+			strategies, venue, alerts = m, e, r
+		}(strategies, venue, alerts)
+		strategies = strategy.NewStrategies(strategy.NewCache(0, gateio.NewClient(srv.URL, nil)))
+		alerts = notify.NewRouter()
+		alerts.Add(notify.DingTalk{
+			Client: dingtalk.NewClient(srv.URL+"/robot/send", "token", "robot-secret", nil, nil),
+		}, notify.Trade)
+		account := huobi.NewClient(srv.URL, "key", "secret", nil, nil)
+		account.Notify = func(text string) { alerts.Post(notify.Trade, text, true) }
+		venue = huobi.Exchange{Client: account}
+
+		// bull: borrow 2x and buy
+		// another symbol than other tests, whose meters are shared
+		b := &bot{name: "xrp", symbol: "xrp_usdt", strategy: "ripdog"}
+		c.So(b.step(ctx), ShouldBeNil)
+		c.So(srv.Debt("key", "xrp_usdt", "usdt"), ShouldEqual, 200)
+		c.So(srv.Balance("key", "xrp_usdt", "usdt"), ShouldEqual, 0)
+		c.So(srv.Balance("key", "xrp_usdt", "xrp"), ShouldAlmostEqual, 600*0.998)
+
+		os := srv.Orders("key")
+		c.So(os, ShouldHaveLength, 1)
+		c.So(os[0].Type, ShouldEqual, "buy-market")
+		c.So(os[0].State, ShouldEqual, "filled")
+
+		ms := srv.Messages()
+		c.So(ms, ShouldHaveLength, 2)
+		c.So(ms[0].Text, ShouldContainSubstring, "类型：borrow")
+		c.So(ms[1].Text, ShouldContainSubstring, "类型：buy")
+
+		// bear: sell all and repay
+		setMarket(srv, -5)
+		c.So(b.step(ctx), ShouldBeNil)
+		c.So(srv.Debt("key", "xrp_usdt", "usdt"), ShouldEqual, 0)
+		c.So(srv.Balance("key", "xrp_usdt", "xrp"), ShouldBeLessThan, 0.001)
+		c.So(srv.Balance("key", "xrp_usdt", "usdt"), ShouldAlmostEqual, 598.8*0.5*0.998-200, 0.001)
+		c.So(srv.Orders("key"), ShouldHaveLength, 2)
+		c.So(srv.Messages(), ShouldHaveLength, 4)
+	})
+}
+
+type (
+	fakeExchange struct{}
+	fakeSymbol   struct{ exchange.Symbol }
+)
+
+func (fakeExchange) Name() string                              { return "fake" }
+func (fakeExchange) Symbols(context.Context) ([]string, error) { return []string{"doge_usdt"}, nil }
+func (fakeExchange) Symbol(_ context.Context, name string) (exchange.Symbol, error) {
+	if name != "doge_usdt" {
+		return nil, errors.New("unsupported symbol")
+	}
+	return fakeSymbol{}, nil
+}
+
+func (fakeSymbol) BaseCurrency() string    { return "doge" }
+func (fakeSymbol) QuoteCurrency() string   { return "usdt" }
+func (fakeSymbol) CancelAll() error        { return errors.New("unauthorized") }
+func (fakeSymbol) Price() (float64, error) { return 0.002, nil }
+func (fakeSymbol) Balance(string) (*exchange.Balance, error) {
+	return &exchange.Balance{}, nil
+}
+
 func TestExec(t *testing.T) {
 	Convey("should refresh balance cache unsuccessfully", t, func(c C) {
-		gateio.Init("apikey", "secretkey")
+		venue = fakeExchange{}
+		b := &bot{name: "doge", symbol: "doge_usdt"}
 		var err error
-		err = exec(strategy.SigRise, "doge_usdt")
-		So(err, ShouldNotBeNil)
+		err = b.exec(ctx, strategy.SigRise)
+		c.So(err, ShouldNotBeNil)
+
+		err = b.exec(ctx, strategy.SigFall)
+		c.So(err, ShouldNotBeNil)
+
+		err = b.exec(ctx, strategy.SigNone)
+		c.So(err, ShouldBeNil)
+
+		err = (&bot{symbol: "abc_def"}).exec(ctx, strategy.SigNone)
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+type failStrategy struct{}
+
+func (failStrategy) Name() string           { return "fail" }
+func (failStrategy) Signal() (uint8, error) { return strategy.SigNone, errors.New("no ticker") }
+
+func TestProtect(t *testing.T) {
+	Convey("should stop loss of a paused bot", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Fee = 0
+		e.Leverage = 3
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		defer func(e exchange.Exchange, m *risk.Manager) { venue, guard = e, m }(venue, guard)
+		venue = e
+		guard = risk.NewManager(0.1, 0, 0, 0)
+		strategies = map[string]strategy.Strategy{"fake": fakeStrategy{}, "fail": failStrategy{}}
+		defer func() { strategies = strategy.Strategies() }()
+
+		b := &bot{name: "doge", symbol: "doge_usdt", strategy: "fake"}
+		c.So(b.step(ctx), ShouldBeNil)
+		pos, _, _, err := exchange.Position(s)
+		c.So(err, ShouldBeNil)
+		c.So(pos, ShouldBeGreaterThan, 0)
+
+		bots = []*bot{b}
+		defer func() { bots = nil }()
+		_, err = pause("doge", true)
+		c.So(err, ShouldBeNil)
+		c.So(b.step(ctx), ShouldBeNil)
+		c.So(guard.Status("dogeusdt").Entry, ShouldEqual, 2)
+
+		p.Last, p.HighestBid = 1.7, 1.7
+		c.So(b.step(ctx), ShouldBeNil)
+		pos, _, _, err = exchange.Position(s)
+		c.So(err, ShouldBeNil)
+		c.So(pos, ShouldEqual, 0)
+	})
+
+	Convey("should stop loss when the strategy fails", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Fee = 0
+		e.Leverage = 3
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		defer func(e exchange.Exchange, m *risk.Manager) { venue, guard = e, m }(venue, guard)
+		venue = e
+		guard = risk.NewManager(0.1, 0, 0, 0)
+		strategies = map[string]strategy.Strategy{"fake": fakeStrategy{}, "fail": failStrategy{}}
+		defer func() { strategies = strategy.Strategies() }()
+
+		b := &bot{name: "doge", symbol: "doge_usdt", strategy: "fake"}
+		c.So(b.step(ctx), ShouldBeNil)
+
+		b.strategy = "fail"
+		c.So(b.step(ctx), ShouldNotBeNil)
+		c.So(guard.Status("dogeusdt").Entry, ShouldEqual, 2)
+
+		p.Last, p.HighestBid = 1.7, 1.7
+		c.So(b.step(ctx), ShouldNotBeNil)
+		pos, _, _, err := exchange.Position(s)
+		c.So(err, ShouldBeNil)
+		c.So(pos, ShouldEqual, 0)
+	})
+}
+
+type panicSymbol struct{ fakeSymbol }
+
+func (panicSymbol) CancelAll() error { panic("boom") }
+
+type panicExchange struct{ fakeExchange }
+
+func (panicExchange) Symbol(context.Context, string) (exchange.Symbol, error) {
+	return panicSymbol{}, nil
+}
+
+func TestBotStep(t *testing.T) {
+	Convey("should recover a panic of a bot as an error", t, func(c C) {
+		venue = panicExchange{}
+		defer func() { venue = fakeExchange{} }()
+		strategies = map[string]strategy.Strategy{"fake": fakeStrategy{}}
+		defer func() { strategies = strategy.Strategies() }()
+
+		b := &bot{name: "doge", symbol: "doge_usdt", strategy: "fake"}
+		err := b.step(ctx)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "panic: boom")
+
+		b.handle(err)
+		c.So(b.failures, ShouldEqual, 1)
+	})
+
+	Convey("should record signals and orders of a bot", t, func(c C) {
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "journal")
+
+		records, err = journal.Open(name)
+		c.So(err, ShouldBeNil)
+		defer func() { records = nil }()
+
+		venue = panicExchange{}
+		defer func() { venue = fakeExchange{} }()
+		strategies = map[string]strategy.Strategy{"fake": fakeStrategy{}}
+		defer func() { strategies = strategy.Strategies() }()
+
+		b := &bot{name: "doge", symbol: "doge_usdt", strategy: "fake"}
+		c.So(b.step(ctx), ShouldNotBeNil)
+		c.So(records.Close(), ShouldBeNil)
+
+		es, err := journal.Read(name, journal.Filter{})
+		c.So(err, ShouldBeNil)
+		c.So(len(es), ShouldEqual, 1)
+		c.So(es[0].Kind, ShouldEqual, journal.Signal)
+		c.So(es[0].Bot, ShouldEqual, "doge")
+		c.So(es[0].Signal, ShouldEqual, "rise")
+	})
+}
+
+func TestParseTime(t *testing.T) {
+	Convey("should parse dates and RFC3339 times", t, func(c C) {
+		v, err := parseTime("")
+		c.So(err, ShouldBeNil)
+		c.So(v.IsZero(), ShouldBeTrue)
+
+		v, err = parseTime("2018-03-01")
+		c.So(err, ShouldBeNil)
+		c.So(v.Equal(time.Date(2018, 3, 1, 0, 0, 0, 0, time.Local)), ShouldBeTrue)
+
+		v, err = parseTime("2018-03-01T08:00:00Z")
+		c.So(err, ShouldBeNil)
+		c.So(v.Equal(time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)), ShouldBeTrue)
+
+		_, err = parseTime("yesterday")
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+type fakeStrategy struct{}
+
+func (fakeStrategy) Name() string           { return "fake" }
+func (fakeStrategy) Signal() (uint8, error) { return strategy.SigRise, nil }
+
+func TestBotRun(t *testing.T) {
+	Convey("should stop running when stop is called", t, func(c C) {
+		venue = fakeExchange{}
+		strategies = map[string]strategy.Strategy{"fake": fakeStrategy{}}
+		defer func() { strategies = strategy.Strategies() }()
+
+		b := &bot{name: "doge", symbol: "doge_usdt", strategy: "fake"}
+		ctx, stop := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			b.run(ctx, time.Millisecond, time.Second)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 20)
+		stop()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			c.So("bot is still running", ShouldBeEmpty)
+		}
+		c.So(b.failures, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("should finish the cycle in progress when stop is called", t, func(c C) {
+		srv := newMock(5)
+		defer srv.Close()
+		srv.AddKey("key", "secret")
+		srv.Inject("/v1/common/symbols", mock.Fault{Delay: time.Millisecond * 200, Times: 1})
+
+		defer func(e exchange.Exchange) { venue = e }(venue)
+		venue = huobi.Exchange{Client: huobi.NewClient(srv.URL, "key", "secret", nil, nil)}
+		strategies = map[string]strategy.Strategy{"fake": fakeStrategy{}}
+		defer func() { strategies = strategy.Strategies() }()
+
+		b := &bot{name: "doge", symbol: "doge_usdt", strategy: "fake"}
+		ctx, stop := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			b.run(ctx, time.Millisecond*10, time.Second)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 50)
+		stop()
+		select {
+		case <-done:
+		case <-time.After(time.Second * 2):
+			c.So("bot is still running", ShouldBeEmpty)
+		}
+		c.So(b.failures, ShouldEqual, 0)
+		c.So(srv.Requests("/v1/margin/accounts/balance"), ShouldBeGreaterThan, 0)
+	})
+
+	Convey("should cancel the cycle in progress timeout after stop is called", t, func(c C) {
+		srv := newMock(5)
+		defer srv.Close()
+		srv.AddKey("key", "secret")
+		srv.Inject("/v1/common/symbols", mock.Fault{Delay: time.Hour})
+
+		defer func(e exchange.Exchange) { venue = e }(venue)
+		venue = huobi.Exchange{Client: huobi.NewClient(srv.URL, "key", "secret", nil, nil)}
+		strategies = map[string]strategy.Strategy{"fake": fakeStrategy{}}
+		defer func() { strategies = strategy.Strategies() }()
+
+		b := &bot{name: "doge", symbol: "doge_usdt", strategy: "fake"}
+		ctx, stop := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			b.run(ctx, time.Millisecond, time.Millisecond*50)
+			close(done)
+		}()
+
+		time.Sleep(time.Millisecond * 50)
+		stop()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			c.So("the cycle is still running", ShouldBeEmpty)
+		}
+		c.So(b.failures, ShouldEqual, 1)
+	})
+}
+
+func TestPaperJournal(t *testing.T) {
+	Convey("should journal paper trading apart", t, func(c C) {
+		c.So(paperJournal(".cts-journal.jsonl"), ShouldEqual, ".cts-journal.paper.jsonl")
+		c.So(paperJournal("/var/cts/journal"), ShouldEqual, "/var/cts/journal.paper")
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	Convey("should leave symbols following the exit policy", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Leverage = 3
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(s.Borrow("usdt", 50), ShouldBeNil)
+
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "journal")
+		records, err = journal.Open(name)
+		c.So(err, ShouldBeNil)
+		defer func() { records = nil }()
+
+		venue = e
+		defer func() { venue = fakeExchange{} }()
+		bots = []*bot{{name: "doge1", symbol: "doge_usdt"}, {name: "doge2", symbol: "doge_usdt"}}
+		defer func() { bots = nil }()
+
+		msg := leave(ctx, exchange.ExitNone)
+		c.So(msg, ShouldContainSubstring, "负债 50.00000000")
+
+		msg = leave(ctx, exchange.ExitRepay)
+		c.So(msg, ShouldStartWith, "品种：doge_usdt\n")
+		c.So(msg, ShouldContainSubstring, "usdt：可用 100.00000000，冻结 0.00000000，负债 0.00000000")
+		c.So(msg, ShouldNotContainSubstring, "退出失败")
+
+		// the exit belongs to none of the bots sharing the symbol
+		c.So(records.Close(), ShouldBeNil)
+		es, err := journal.Read(name, journal.Filter{Kinds: []string{journal.Repay}})
+		c.So(err, ShouldBeNil)
+		c.So(es, ShouldHaveLength, 1)
+		c.So(es[0].Bot, ShouldEqual, "shutdown")
+	})
+
+	Convey("should wait for trades in progress before leaving", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Leverage = 3
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(s.Borrow("usdt", 50), ShouldBeNil)
+
+		venue = e
+		defer func() { venue = fakeExchange{} }()
+		b := &bot{symbol: "doge_usdt"}
+		bots = []*bot{b}
+		defer func() { bots = nil }()
+
+		// a trade in progress
+		b.mu.Lock()
+		done := make(chan string)
+		go func() { done <- leave(ctx, exchange.ExitRepay) }()
+
+		select {
+		case <-done:
+			c.So("left during a trade", ShouldBeEmpty)
+		case <-time.After(time.Millisecond * 50):
+		}
+		bal, err := s.Balance("usdt")
+		c.So(err, ShouldBeNil)
+		c.So(bal.Loan, ShouldEqual, 50)
+
+		b.mu.Unlock()
+		msg := <-done
+		c.So(msg, ShouldNotContainSubstring, "退出失败")
+		bal, err = s.Balance("usdt")
+		c.So(err, ShouldBeNil)
+		c.So(bal.Loan, ShouldEqual, 0)
+	})
 
-		err = exec(strategy.SigFall, "doge_usdt")
-		So(err, ShouldNotBeNil)
+	Convey("should stop at once by another signal", t, func(c C) {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		defer wg.Done()
 
-		err = exec(strategy.SigNone, "doge_usdt")
-		So(err, ShouldBeNil)
+		quit := make(chan os.Signal, 1)
+		quit <- os.Interrupt
+		err := shutdown(&wg, quit, config.Shutdown{Timeout: time.Hour})
+		c.So(err, ShouldNotBeNil)
 	})
 }
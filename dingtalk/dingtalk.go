@@ -2,76 +2,186 @@ package dingtalk
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
-	"io/ioutil"
-	"log"
-	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/modood/cts/transport"
 	"github.com/modood/cts/util"
 	"github.com/pkg/errors"
 )
 
-var (
-	token string
+// Message types
+const (
+	TypeText       = "text"
+	TypeMarkdown   = "markdown"
+	TypeActionCard = "actionCard"
 )
 
-// Init init access token of dingtalk group chat robot
-func Init(accessToken string) {
-	token = accessToken
-}
+type (
+	// Message is a message of the group chat robot, only the field of its
+	// type is set
+	Message struct {
+		Type       string      `json:"msgtype"`
+		Text       *Text       `json:"text,omitempty"`
+		Markdown   *Markdown   `json:"markdown,omitempty"`
+		ActionCard *ActionCard `json:"actionCard,omitempty"`
+		At         *At         `json:"at,omitempty"`
+	}
+
+	// Text ...
+	Text struct {
+		Content string `json:"content"`
+	}
 
-// Push send notification
-func Push(text string, isAtAll bool) error {
-	client := &http.Client{Timeout: time.Duration(time.Second * 3)}
+	// Markdown ...
+	Markdown struct {
+		Title string `json:"title"` // shown in the conversation list
+		Text  string `json:"text"`
+	}
+
+	// ActionCard is a card with a single button, or buttons if SingleURL is
+	// empty
+	ActionCard struct {
+		Title          string   `json:"title"`
+		Text           string   `json:"text"` // markdown
+		SingleTitle    string   `json:"singleTitle,omitempty"`
+		SingleURL      string   `json:"singleURL,omitempty"`
+		BtnOrientation string   `json:"btnOrientation,omitempty"` // 0: vertical, 1: horizontal
+		Buttons        []Button `json:"btns,omitempty"`
+	}
 
-	url := "https://oapi.dingtalk.com/robot/send?access_token=" + token
+	// Button ...
+	Button struct {
+		Title     string `json:"title"`
+		ActionURL string `json:"actionURL"`
+	}
 
-	if isAtAll {
-		text += "\n"
+	// At mention members by mobiles, or everyone
+	At struct {
+		AtMobiles []string `json:"atMobiles"`
+		IsAtAll   bool     `json:"isAtAll"`
 	}
+)
+
+// DefaultURL is the webhook of group chat robots
+const DefaultURL = "https://oapi.dingtalk.com/robot/send"
+
+// Client send messages by a group chat robot
+type Client struct {
+	BaseURL string // webhook of robots
+	Token   string // access token of the robot
+	Secret  string // of the "加签" security setting, unsigned if empty
+	HTTP    *http.Client
+	Now     func() time.Time
+
+	transport *transport.Client
+}
+
+// requestTimeout is how long a message is tried to send at most
+var requestTimeout = time.Second * 10
 
-	params := []byte(`{
-		"msgtype": "text",
-		"text": {
-			"content": "` + text + `"
+// NewClient return a client of the robot of token, baseURL is DefaultURL if
+// empty, hc is http.DefaultClient if nil and now is time.Now if nil
+func NewClient(baseURL, token, secret string, hc *http.Client, now func() time.Time) *Client {
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &Client{
+		BaseURL: baseURL,
+		Token:   token,
+		Secret:  secret,
+		HTTP:    hc,
+		Now:     now,
+		// a robot can send 20 messages per minute
+		transport: &transport.Client{
+			Timeout:  time.Second * 3,
+			Attempts: 3,
+			Backoff:  transport.Backoff{Base: time.Millisecond * 200, Max: time.Second},
+			Limiter:  transport.NewLimiter(20.0/60, 20),
 		},
-		"at": {
-			"atMobiles": [],
-			"isAtAll": ` + strconv.FormatBool(isAtAll) + `
-		}
-	}`)
+	}
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(params))
+// Push send a text notification
+func (c *Client) Push(ctx context.Context, text string, isAtAll bool) error {
+	err := c.Send(ctx, Message{
+		Type: TypeText,
+		Text: &Text{Content: text},
+		At:   &At{AtMobiles: []string{}, IsAtAll: isAtAll},
+	})
 	if err != nil {
 		return errors.Wrap(err, util.FuncName())
 	}
+	return nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// PushMarkdown send a markdown notification, mentioned mobiles are appended
+// to the text, which is required to highlight them
+func (c *Client) PushMarkdown(ctx context.Context, title, text string, at At) error {
+	if at.AtMobiles == nil {
+		at.AtMobiles = []string{}
+	}
+	err := c.Send(ctx, Message{
+		Type:     TypeMarkdown,
+		Markdown: &Markdown{Title: title, Text: text + mention(at.AtMobiles)},
+		At:       &at,
+	})
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
 
-	var retry int
-t:
-	resp, err := client.Do(req)
+// PushActionCard send an action card
+func (c *Client) PushActionCard(ctx context.Context, card ActionCard) error {
+	err := c.Send(ctx, Message{Type: TypeActionCard, ActionCard: &card})
 	if err != nil {
-		if err, ok := err.(net.Error); (ok && err.Timeout()) ||
-			strings.Contains(err.Error(), "connection reset by peer") {
-			if retry++; retry < 3 {
-				goto t
-			}
-		}
 		return errors.Wrap(err, util.FuncName())
 	}
+	return nil
+}
 
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
+// Send send a message, secrets in it are redacted
+func (c *Client) Send(ctx context.Context, m Message) error {
+	switch {
+	case m.Text != nil:
+		m.Text.Content = util.Redact(m.Text.Content)
+	case m.Markdown != nil:
+		m.Markdown.Text = util.Redact(m.Markdown.Text)
+	case m.ActionCard != nil:
+		m.ActionCard.Text = util.Redact(m.ActionCard.Text)
+	}
+
+	params, err := json.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
 
-	bs, err := ioutil.ReadAll(resp.Body)
+	tc := *c.transport
+	tc.HTTP = c.HTTP
+
+	// a duplicate notification is better than a lost one
+	resp, err := tc.Do(ctx, &transport.Request{
+		Method:     "POST",
+		URL:        c.webhook(c.Now()),
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       params,
+		Idempotent: true,
+	})
 	if err != nil {
 		return errors.Wrap(err, util.FuncName())
 	}
@@ -81,15 +191,69 @@ t:
 		Message string `json:"errmsg"`
 	}{}
 
-	err = json.Unmarshal(bs, &r)
+	err = json.Unmarshal(resp.Body, &r)
 	if err != nil {
 		return errors.Wrap(err, util.FuncName())
 	}
 
 	if r.Code != 0 || r.Message != "ok" {
-		err = errors.New(string(bs))
+		err = errors.New(string(resp.Body))
 		return errors.Wrap(err, util.FuncName())
 	}
 
 	return nil
 }
+
+// webhook return the url of the robot, which is signed at now if there is a
+// secret
+func (c *Client) webhook(now time.Time) string {
+	u := c.BaseURL + "?access_token=" + url.QueryEscape(c.Token)
+	if c.Secret == "" {
+		return u
+	}
+
+	ts := strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	return u + "&timestamp=" + ts + "&sign=" + url.QueryEscape(sign(ts, c.Secret))
+}
+
+// sign return base64 of HmacSHA256 of "timestamp\nsecret" by secret
+func sign(timestamp, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func mention(mobiles []string) string {
+	if len(mobiles) == 0 {
+		return ""
+	}
+	return "\n\n@" + strings.Join(mobiles, " @")
+}
+
+// Table return markdown of a notification text: the first line is the title,
+// lines of "name：value" are rows of tables, and others are paragraphs
+func Table(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	var b bytes.Buffer
+	b.WriteString("#### " + lines[0] + "\n")
+
+	inTable := false
+	for _, v := range lines[1:] {
+		kv := strings.SplitN(strings.TrimSpace(v), "：", 2)
+		if len(kv) != 2 {
+			inTable = false
+			b.WriteString("\n" + strings.TrimSpace(v) + "\n")
+			continue
+		}
+		if !inTable {
+			b.WriteString("\n| 项目 | 内容 |\n| --- | --- |\n")
+			inTable = true
+		}
+		b.WriteString("| " + cell(kv[0]) + " | " + cell(kv[1]) + " |\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func cell(s string) string {
+	return strings.Replace(strings.TrimSpace(s), "|", "\\|", -1)
+}
@@ -1,23 +1,95 @@
 package dingtalk
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-func TestInit(t *testing.T) {
-	Convey("should init successfully", t, func() {
-		So(token, ShouldEqual, "")
-		Init("accesstoken")
-		So(token, ShouldEqual, "accesstoken")
+func TestNewClient(t *testing.T) {
+	Convey("should create a client of the robot", t, func(c C) {
+		cl := NewClient("", "accesstoken", "", nil, nil)
+		c.So(cl.BaseURL, ShouldEqual, DefaultURL)
+		c.So(cl.Token, ShouldEqual, "accesstoken")
+		c.So(cl.Now, ShouldNotBeNil)
 	})
 }
 
 func TestPush(t *testing.T) {
-	Convey("should push unsuccessfully", t, func() {
-		Init("accesstoken")
-		err := Push("Hello robot")
-		So(err, ShouldNotBeNil)
+	Convey("should push unsuccessfully", t, func(c C) {
+		cl := NewClient("http://127.0.0.1:1/robot/send", "accesstoken", "", nil, nil)
+		err := cl.Push(context.Background(), "Hello robot", false)
+		c.So(err, ShouldNotBeNil)
+	})
+
+	Convey("should push messages as valid JSON", t, func(c C) {
+		var query url.Values
+		var m map[string]interface{}
+		reply := `{"errcode":0,"errmsg":"ok"}`
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			bs, _ := ioutil.ReadAll(r.Body)
+			m = nil
+			c.So(json.Unmarshal(bs, &m), ShouldBeNil)
+			w.Write([]byte(reply))
+		}))
+		defer ts.Close()
+
+		ctx := context.Background()
+		cl := NewClient(ts.URL, "accesstoken", "", ts.Client(), nil)
+		c.So(cl.Push(ctx, "error: \"quoted\"\nnext line", true), ShouldBeNil)
+		c.So(query.Get("access_token"), ShouldEqual, "accesstoken")
+		c.So(query.Get("sign"), ShouldEqual, "")
+		c.So(m["msgtype"], ShouldEqual, TypeText)
+		c.So(m["text"], ShouldResemble, map[string]interface{}{"content": "error: \"quoted\"\nnext line"})
+		c.So(m["at"].(map[string]interface{})["isAtAll"], ShouldEqual, true)
+
+		cl.Secret = "SECxxx"
+		c.So(cl.PushMarkdown(ctx, "report", "#### report", At{AtMobiles: []string{"13800000000"}}), ShouldBeNil)
+		c.So(query.Get("timestamp"), ShouldNotBeEmpty)
+		c.So(query.Get("sign"), ShouldEqual, sign(query.Get("timestamp"), "SECxxx"))
+		c.So(m["markdown"], ShouldResemble, map[string]interface{}{
+			"title": "report",
+			"text":  "#### report\n\n@13800000000",
+		})
+
+		c.So(cl.PushActionCard(ctx, ActionCard{Title: "stop", Text: "stopped", SingleTitle: "detail",
+			SingleURL: "https://example.com"}), ShouldBeNil)
+		c.So(m["msgtype"], ShouldEqual, TypeActionCard)
+		c.So(m["actionCard"].(map[string]interface{})["singleURL"], ShouldEqual, "https://example.com")
+
+		reply = `{"errcode":310000,"errmsg":"sign not match"}`
+		err := cl.Push(ctx, "hello", false)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "sign not match")
+	})
+}
+
+func TestSign(t *testing.T) {
+	Convey("should sign by HmacSHA256 of timestamp and secret", t, func(c C) {
+		// echo -ne "1577000000000\nSECabc" | openssl dgst -sha256 -hmac SECabc -binary | base64
+		c.So(sign("1577000000000", "SECabc"), ShouldEqual, "7GpJpzn1QbzWPzb28Rn8n5kqQ+bZnFJ5q6yAXgyepM4=")
+
+		cl := NewClient("", "accesstoken", "SECabc", nil, nil)
+		u := cl.webhook(time.Unix(1577000000, 0))
+		c.So(u, ShouldEqual, "https://oapi.dingtalk.com/robot/send?access_token=accesstoken"+
+			"&timestamp=1577000000000&sign=7GpJpzn1QbzWPzb28Rn8n5kqQ%2BbZnFJ5q6yAXgyepM4%3D")
+	})
+}
+
+func TestTable(t *testing.T) {
+	Convey("should format a notification as markdown tables", t, func(c C) {
+		md := Table("2018-03-01 08:00:00\n类型：borrow\n品种：dogeusdt\n  doge/ripdog: 1\n净值：100 | 1")
+		c.So(md, ShouldEqual, "#### 2018-03-01 08:00:00\n"+
+			"\n| 项目 | 内容 |\n| --- | --- |\n| 类型 | borrow |\n| 品种 | dogeusdt |\n"+
+			"\ndoge/ripdog: 1\n"+
+			"\n| 项目 | 内容 |\n| --- | --- |\n| 净值 | 100 \\| 1 |")
 	})
 }
@@ -0,0 +1,105 @@
+package dingtalk
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Incoming is a message which mentions the outgoing robot
+	Incoming struct {
+		MsgType           string `json:"msgtype"`
+		Text              Text   `json:"text"`
+		MsgID             string `json:"msgId"`
+		ConversationID    string `json:"conversationId"`
+		ConversationTitle string `json:"conversationTitle"`
+		SenderID          string `json:"senderId"`
+		SenderNick        string `json:"senderNick"`
+		SenderStaffID     string `json:"senderStaffId"`
+		IsAdmin           bool   `json:"isAdmin"`
+	}
+)
+
+// SignTTL is the max age of the timestamp of a callback
+const SignTTL = time.Hour
+
+var (
+	errNoSignature = errors.New("no timestamp or sign of the outgoing robot")
+	errSignature   = errors.New("invalid sign of the outgoing robot")
+	errExpired     = errors.New("expired timestamp of the outgoing robot")
+)
+
+// Verify check the timestamp and sign headers of an outgoing robot callback,
+// the sign is base64 of HmacSHA256 of "timestamp\nsecret" by the app secret
+func Verify(timestamp, signature, secret string, now time.Time) error {
+	if timestamp == "" || signature == "" {
+		return errors.Wrap(errNoSignature, util.FuncName())
+	}
+
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Wrap(errSignature, util.FuncName())
+	}
+	t := time.Unix(0, ms*int64(time.Millisecond))
+	if d := now.Sub(t); d > SignTTL || d < -SignTTL {
+		return errors.Wrap(errExpired, util.FuncName())
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(sign(timestamp, secret))) {
+		return errors.Wrap(errSignature, util.FuncName())
+	}
+	return nil
+}
+
+// Handler return the http handler of outgoing robot callbacks, which are
+// verified by the app secret. the reply of handle is sent back to the same
+// conversation as a text message.
+func Handler(secret string, handle func(in *Incoming) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		err := Verify(r.Header.Get("timestamp"), r.Header.Get("sign"), secret, time.Now())
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		bs, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var in Incoming
+		if err = json.Unmarshal(bs, &in); err != nil {
+			http.Error(w, fmt.Sprintf("invalid message: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		reply, err := json.Marshal(Message{
+			Type: TypeText,
+			Text: &Text{Content: util.Redact(handle(&in))},
+			At:   &At{AtMobiles: []string{}},
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err = w.Write(reply); err != nil {
+			log.Println(err)
+		}
+	})
+}
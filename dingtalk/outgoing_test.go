@@ -0,0 +1,67 @@
+package dingtalk
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerify(t *testing.T) {
+	Convey("should verify the sign of an outgoing robot callback", t, func(c C) {
+		now := time.Unix(1577000000, 0)
+		sig := "7GpJpzn1QbzWPzb28Rn8n5kqQ+bZnFJ5q6yAXgyepM4="
+
+		c.So(Verify("1577000000000", sig, "SECabc", now), ShouldBeNil)
+		c.So(Verify("1577000000000", sig, "SECabc", now.Add(time.Minute*59)), ShouldBeNil)
+		c.So(Verify("1577000000000", sig, "SECabd", now), ShouldNotBeNil)
+		c.So(Verify("1577000000000", sig, "SECabc", now.Add(time.Hour*2)), ShouldNotBeNil)
+		c.So(Verify("1577000000001", sig, "SECabc", now), ShouldNotBeNil)
+		c.So(Verify("yesterday", sig, "SECabc", now), ShouldNotBeNil)
+		c.So(Verify("", "", "SECabc", now), ShouldNotBeNil)
+	})
+}
+
+func TestHandler(t *testing.T) {
+	Convey("should reply to verified callbacks", t, func(c C) {
+		var got *Incoming
+		h := Handler("SECabc", func(in *Incoming) string {
+			got = in
+			return "pong"
+		})
+
+		ts := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		body := `{"msgtype":"text","text":{"content":" ping"},"senderNick":"modood","senderStaffId":"0123"}`
+		req := httptest.NewRequest("POST", "/dingtalk", strings.NewReader(body))
+		req.Header.Set("timestamp", ts)
+		req.Header.Set("sign", sign(ts, "SECabc"))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		c.So(w.Code, ShouldEqual, http.StatusOK)
+		c.So(got.Text.Content, ShouldEqual, " ping")
+		c.So(got.SenderStaffID, ShouldEqual, "0123")
+		var m Message
+		c.So(json.Unmarshal(w.Body.Bytes(), &m), ShouldBeNil)
+		c.So(m.Type, ShouldEqual, TypeText)
+		c.So(m.Text.Content, ShouldEqual, "pong")
+
+		got = nil
+		req = httptest.NewRequest("POST", "/dingtalk", strings.NewReader(body))
+		req.Header.Set("timestamp", ts)
+		req.Header.Set("sign", sign(ts, "SECxyz"))
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		c.So(w.Code, ShouldEqual, http.StatusForbidden)
+		c.So(got, ShouldBeNil)
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/dingtalk", nil))
+		c.So(w.Code, ShouldEqual, http.StatusMethodNotAllowed)
+	})
+}
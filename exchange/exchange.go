@@ -0,0 +1,223 @@
+package exchange
+
+import (
+	"context"
+	"strings"
+
+	"github.com/modood/cts/strategy"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// Trade commands
+const (
+	Buy  = "BUY"
+	Sell = "SELL"
+)
+
+type (
+	// Exchange is a trading venue which supports margin trading, requests
+	// of a symbol are sent within the context it is got by
+	Exchange interface {
+		Name() string
+		Symbols(ctx context.Context) ([]string, error)
+		Symbol(ctx context.Context, name string) (Symbol, error)
+	}
+
+	// Symbol is a margin trading pair of an exchange
+	Symbol interface {
+		Name() string
+		BaseCurrency() string
+		QuoteCurrency() string
+
+		Price() (float64, error)
+		Balance(currency string) (*Balance, error)
+		Limit() (*Limit, error)
+
+		Trade(cmd string, amount float64) (*Fill, error)
+		Order(ID uint64) (*Order, error)
+		OpenOrders() ([]Order, error)
+		Cancel(ID uint64) error
+		CancelAll() error
+
+		Loans() ([]Loan, error)
+		Borrow(currency string, amount float64) error
+		Repay(currency string, amount float64) error // repay debt of currency up to amount
+	}
+
+	// RiskRater is a symbol which reports the risk rate of its margin
+	// account, which is assets / debts. the position is liquidated if it is
+	// too low, e.g., 1.1 of huobi.
+	RiskRater interface {
+		RiskRate() (float64, error)
+	}
+
+	// Balance ...
+	Balance struct {
+		Trade         float64 `json:"trade"`
+		Frozen        float64 `json:"frozen"`
+		LoanAvailable float64 `json:"loan_available"`
+		Loan          float64 `json:"loan"`
+		Interest      float64 `json:"interest"`
+	}
+
+	// Limit ...
+	Limit struct {
+		BuyGT  float64
+		BuyLT  float64
+		SellGT float64
+		SellLT float64
+	}
+
+	// Order ...
+	Order struct {
+		ID               uint64  `json:"id"`
+		Symbol           string  `json:"symbol"`
+		Type             string  `json:"type"`
+		State            string  `json:"state"`
+		Amount           float64 `json:"amount"`
+		Price            float64 `json:"price"`
+		FilledAmount     float64 `json:"filled_amount"`
+		FilledCashAmount float64 `json:"filled_cash_amount"`
+		FilledFees       float64 `json:"filled_fees"`
+	}
+
+	// Fill is the final result of an order
+	Fill struct {
+		OrderID          uint64
+		Type             string
+		State            string
+		Amount           float64 // quote currency for buy-market, otherwise base currency
+		FilledAmount     float64 // base currency
+		FilledCashAmount float64 // quote currency
+		Fees             float64 // in the received currency
+		Price            float64 // average price
+	}
+
+	// Loan is an accruing borrow order
+	Loan struct {
+		ID       uint64  `json:"id"`
+		Currency string  `json:"currency"`
+		Amount   float64 `json:"amount"`
+		Interest float64 `json:"interest"`
+	}
+)
+
+var (
+	errUnkownTradeType = errors.New("unknown trade type, it should be `BUY` or `SELL`")
+)
+
+// AllIn trade all balance of a symbol, borrow as much as possible first if isMargin
+func AllIn(s Symbol, cmd string, isMargin bool) error {
+	bc, qc := s.BaseCurrency(), s.QuoteCurrency()
+	switch cmd {
+	case Buy: // do nothing
+	case Sell:
+		bc, qc = qc, bc
+	default:
+		return errors.Wrap(errUnkownTradeType, util.FuncName())
+	}
+
+	err := s.CancelAll()
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+t:
+	b, err := s.Balance(qc)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if isMargin && b.LoanAvailable > 0 {
+		ls, err := s.Loans()
+		if err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		if len(ls) == 0 {
+			err = s.Borrow(qc, b.LoanAvailable)
+			if err != nil {
+				return errors.Wrap(err, util.FuncName())
+			}
+			goto t
+		}
+	}
+
+	// check trade amount limit
+	l, err := s.Limit()
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if cmd == Buy {
+		if b.Trade < l.BuyGT {
+			return nil
+		} else if b.Trade > l.BuyLT {
+			b.Trade = l.BuyLT
+		}
+	}
+	if cmd == Sell {
+		if b.Trade < l.SellGT {
+			return nil
+		} else if b.Trade > l.SellLT {
+			b.Trade = l.SellLT
+		}
+	}
+
+	f, err := s.Trade(cmd, b.Trade)
+	if f == nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	// repay with what was really received, even if it is partially filled
+	if e := s.Repay(bc, f.Received()); e != nil {
+		if err == nil {
+			err = e
+		} else {
+			err = errors.Wrap(err, e.Error())
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	return nil
+}
+
+// Apply trade a symbol following a strategy signal, the position is sized by
+// sz, or all in if sz is nil
+func Apply(s Symbol, signal uint8, sz Sizer) error {
+	if sz != nil {
+		if err := Sized(s, signal, sz); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		return nil
+	}
+
+	var err error
+	switch signal {
+	case strategy.SigRise:
+		err = AllIn(s, Buy, false)
+	case strategy.SigFall:
+		err = AllIn(s, Sell, false)
+	case strategy.SigBull:
+		err = AllIn(s, Buy, true)
+	case strategy.SigBear:
+		err = AllIn(s, Sell, true)
+	case strategy.SigNone:
+		fallthrough
+	default:
+		// do nothing
+	}
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// Received return amount of the received currency after fees, which is
+// base currency when buying and quote currency when selling
+func (f *Fill) Received() float64 {
+	if strings.HasPrefix(f.Type, "buy") {
+		return f.FilledAmount - f.Fees
+	}
+	return f.FilledCashAmount - f.Fees
+}
@@ -0,0 +1,89 @@
+package exchange
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeSymbol struct {
+	balance  map[string]*Balance
+	loans    []Loan
+	trades   []string
+	borrowed float64
+	repaid   []string
+	received []float64
+}
+
+func (f *fakeSymbol) Name() string          { return "dogeusdt" }
+func (f *fakeSymbol) BaseCurrency() string  { return "doge" }
+func (f *fakeSymbol) QuoteCurrency() string { return "usdt" }
+
+func (f *fakeSymbol) Price() (float64, error) { return 0.5, nil }
+
+func (f *fakeSymbol) Balance(currency string) (*Balance, error) {
+	b := *f.balance[currency]
+	return &b, nil
+}
+
+func (f *fakeSymbol) Limit() (*Limit, error) {
+	return &Limit{BuyGT: 1, BuyLT: 1000, SellGT: 10, SellLT: 100000}, nil
+}
+
+func (f *fakeSymbol) Trade(cmd string, amount float64) (*Fill, error) {
+	f.trades = append(f.trades, cmd)
+	if cmd == Buy {
+		return &Fill{Type: "buy-market", Amount: amount, FilledAmount: amount * 2, FilledCashAmount: amount, Fees: 1}, nil
+	}
+	return &Fill{Type: "sell-market", Amount: amount, FilledAmount: amount, FilledCashAmount: amount / 2, Fees: 1}, nil
+}
+
+func (f *fakeSymbol) Order(ID uint64) (*Order, error) { return &Order{ID: ID}, nil }
+func (f *fakeSymbol) OpenOrders() ([]Order, error)    { return nil, nil }
+func (f *fakeSymbol) Cancel(ID uint64) error          { return nil }
+func (f *fakeSymbol) CancelAll() error                { return nil }
+func (f *fakeSymbol) Loans() ([]Loan, error)          { return f.loans, nil }
+
+func (f *fakeSymbol) Borrow(currency string, amount float64) error {
+	f.borrowed += amount
+	f.loans = append(f.loans, Loan{ID: 1, Currency: currency, Amount: amount})
+	b := f.balance[currency]
+	b.Trade += amount
+	b.LoanAvailable = 0
+	return nil
+}
+
+func (f *fakeSymbol) Repay(currency string, amount float64) error {
+	f.repaid = append(f.repaid, currency)
+	f.received = append(f.received, amount)
+	return nil
+}
+
+func TestAllIn(t *testing.T) {
+	Convey("should trade all balance successfully", t, func(c C) {
+		f := &fakeSymbol{balance: map[string]*Balance{
+			"usdt": {Trade: 100, LoanAvailable: 400},
+			"doge": {Trade: 5},
+		}}
+
+		err := AllIn(f, Buy, false)
+		c.So(err, ShouldBeNil)
+		c.So(f.trades, ShouldResemble, []string{Buy})
+		c.So(f.borrowed, ShouldEqual, 0)
+		c.So(f.repaid, ShouldResemble, []string{"doge"})
+		c.So(f.received, ShouldResemble, []float64{199})
+
+		err = AllIn(f, Buy, true)
+		c.So(err, ShouldBeNil)
+		c.So(f.borrowed, ShouldEqual, 400)
+
+		// less than SellGT
+		err = AllIn(f, Sell, false)
+		c.So(err, ShouldBeNil)
+		c.So(len(f.trades), ShouldEqual, 2)
+
+		err = AllIn(f, "HOLD", false)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, errUnkownTradeType.Error())
+	})
+}
@@ -0,0 +1,96 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// Exit policies, what is done to a symbol when the bot stops
+const (
+	ExitNone    = "none"    // leave orders, positions and loans as they are
+	ExitCancel  = "cancel"  // cancel open orders
+	ExitRepay   = "repay"   // cancel open orders and repay loans by available balances
+	ExitFlatten = "flatten" // cancel open orders, close the position and repay loans
+)
+
+var (
+	errUnknownExitPolicy = errors.New("unknown exit policy, it should be none, cancel, repay or flatten")
+)
+
+// ExitPolicies return all exit policies
+func ExitPolicies() []string {
+	return []string{ExitNone, ExitCancel, ExitRepay, ExitFlatten}
+}
+
+// Exit leave a symbol in a safe state following an exit policy
+func Exit(s Symbol, policy string) error {
+	switch policy {
+	case ExitNone, "":
+		return nil
+	case ExitCancel, ExitRepay, ExitFlatten:
+	default:
+		return errors.Wrap(errUnknownExitPolicy, util.FuncName())
+	}
+
+	err := s.CancelAll()
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	if policy == ExitFlatten {
+		if err = Rebalance(s, 0, false); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+	if policy == ExitCancel {
+		return nil
+	}
+
+	var errs []string
+	for _, c := range []string{s.BaseCurrency(), s.QuoteCurrency()} {
+		b, err := s.Balance(c)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		amount := math.Min(b.Loan+b.Interest, b.Trade)
+		if amount <= 0 {
+			continue
+		}
+		if err = s.Repay(c, amount); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Wrap(errors.New(strings.Join(errs, ";")), util.FuncName())
+	}
+	return nil
+}
+
+// State return a human readable state of a symbol: balances, loans and open
+// orders, which is reported when the bot stops
+func State(s Symbol) (string, error) {
+	var lines []string
+	for _, c := range []string{s.BaseCurrency(), s.QuoteCurrency()} {
+		b, err := s.Balance(c)
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+		lines = append(lines, fmt.Sprintf("%s：可用 %.8f，冻结 %.8f，负债 %.8f",
+			c, b.Trade, b.Frozen, b.Loan+b.Interest))
+	}
+
+	orders, err := s.OpenOrders()
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+	lines = append(lines, fmt.Sprintf("挂单：%d", len(orders)))
+	for _, o := range orders {
+		lines = append(lines, fmt.Sprintf("  #%d %s %.8f@%.8f", o.ID, o.Type, o.Amount, o.Price))
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,40 @@
+package exchange
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExit(t *testing.T) {
+	Convey("should leave a symbol following exit policies", t, func(c C) {
+		f := &fakeSymbol{balance: map[string]*Balance{
+			"usdt": {Trade: 100, Loan: 30, Interest: 1},
+			"doge": {Trade: 5, Loan: 10},
+		}}
+
+		c.So(Exit(f, ExitNone), ShouldBeNil)
+		c.So(Exit(f, ExitCancel), ShouldBeNil)
+		c.So(f.repaid, ShouldBeEmpty)
+
+		c.So(Exit(f, ExitRepay), ShouldBeNil)
+		c.So(f.repaid, ShouldResemble, []string{"doge", "usdt"})
+		c.So(f.received, ShouldResemble, []float64{5, 31})
+
+		c.So(Exit(f, "panic"), ShouldNotBeNil)
+	})
+}
+
+func TestState(t *testing.T) {
+	Convey("should describe balances and open orders", t, func(c C) {
+		f := &fakeSymbol{balance: map[string]*Balance{
+			"usdt": {Trade: 100, Loan: 30},
+			"doge": {Trade: 5},
+		}}
+
+		s, err := State(f)
+		c.So(err, ShouldBeNil)
+		c.So(s, ShouldContainSubstring, "usdt：可用 100.00000000，冻结 0.00000000，负债 30.00000000")
+		c.So(s, ShouldContainSubstring, "挂单：0")
+	})
+}
@@ -0,0 +1,314 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/modood/cts/strategy"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Sizer decide the quote currency value of a position
+	Sizer interface {
+		Size(equity, price float64) float64
+	}
+
+	// Fixed is a fixed quote currency value
+	Fixed float64
+
+	// Fraction is a fixed fraction of equity, 0.5 means half of equity
+	Fraction float64
+
+	// VolTarget size a position so that its annualized volatility is Target
+	// of equity. prices are observed every Interval, i.e., the poll interval,
+	// by which volatility of their log returns is annualized. the position is
+	// 0 until Window prices are observed, or if Interval is 0.
+	VolTarget struct {
+		Target   float64 // 0.2 means 20% of equity a year
+		Window   int
+		Interval time.Duration
+
+		prices []float64
+	}
+
+	// MaxLeverage limit a position to Ratio times of equity
+	MaxLeverage struct {
+		Sizer
+		Ratio float64
+	}
+
+	// observer is a Sizer which needs every price, not only the ones of
+	// signals
+	observer interface {
+		Observe(price float64)
+	}
+)
+
+var (
+	// RebalanceBand is the fraction of equity which a position may deviate
+	// from its target before it is rebalanced
+	RebalanceBand = 0.05
+
+	errInvalidSizer = errors.New("invalid sizing, it should be one of `allin`, `fixed:<quote>`, `fraction:<ratio>`, `vol:<target>[:<window>]`")
+	errUnboundedVol = errors.New("vol sizing needs a max leverage greater than 0")
+)
+
+// Size return f
+func (f Fixed) Size(equity, price float64) float64 {
+	return float64(f)
+}
+
+// Size return f of equity
+func (f Fraction) Size(equity, price float64) float64 {
+	return equity * float64(f)
+}
+
+// Observe record a price
+func (v *VolTarget) Observe(price float64) {
+	if price <= 0 {
+		return
+	}
+	v.prices = append(v.prices, price)
+	if n := v.window() + 1; len(v.prices) > n {
+		v.prices = v.prices[len(v.prices)-n:]
+	}
+}
+
+// Size return equity * Target / annualized volatility of log returns
+func (v *VolTarget) Size(equity, price float64) float64 {
+	n := v.window()
+	if len(v.prices) < n+1 || v.Interval <= 0 {
+		return 0
+	}
+
+	rs := make([]float64, n)
+	var mean float64
+	for i := range rs {
+		rs[i] = math.Log(v.prices[i+1] / v.prices[i])
+		mean += rs[i] / float64(n)
+	}
+	var variance float64
+	for _, r := range rs {
+		variance += (r - mean) * (r - mean) / float64(n)
+	}
+	if variance == 0 {
+		return 0
+	}
+	// prices are traded all the year round
+	periods := float64(time.Hour*24*365) / float64(v.Interval)
+	return equity * v.Target / math.Sqrt(variance*periods)
+}
+
+func (v *VolTarget) window() int {
+	if v.Window < 2 {
+		return 20
+	}
+	return v.Window
+}
+
+// Observe pass the price to the inner sizer if it needs
+func (m MaxLeverage) Observe(price float64) {
+	if o, ok := m.Sizer.(observer); ok {
+		o.Observe(price)
+	}
+}
+
+// Size return the inner size, which is no more than Ratio times of equity
+func (m MaxLeverage) Size(equity, price float64) float64 {
+	return math.Min(m.Sizer.Size(equity, price), equity*m.Ratio)
+}
+
+// ParseSizer parse a sizing policy, e.g., fixed:100, fraction:0.5, vol:0.2:20.
+// allin or empty return nil, which means AllIn. the policy is limited to
+// maxLeverage times of equity if maxLeverage > 0, which vol needs. prices of
+// vol are observed every interval.
+func ParseSizer(s string, maxLeverage float64, interval time.Duration) (Sizer, error) {
+	fs := strings.Split(s, ":")
+	if fs[0] == "" || fs[0] == "allin" {
+		return nil, nil
+	}
+
+	vs := make([]float64, len(fs)-1)
+	for i, v := range fs[1:] {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			err = fmt.Errorf("%v: %s", errInvalidSizer, s)
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		vs[i] = f
+	}
+
+	var sz Sizer
+	switch {
+	case fs[0] == "fixed" && len(vs) == 1:
+		sz = Fixed(vs[0])
+	case fs[0] == "fraction" && len(vs) == 1:
+		sz = Fraction(vs[0])
+	case fs[0] == "vol" && len(vs) == 1:
+		sz = &VolTarget{Target: vs[0], Interval: interval}
+	case fs[0] == "vol" && len(vs) == 2:
+		sz = &VolTarget{Target: vs[0], Window: int(vs[1]), Interval: interval}
+	default:
+		err := fmt.Errorf("%v: %s", errInvalidSizer, s)
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	if _, ok := sz.(*VolTarget); ok && maxLeverage <= 0 {
+		// a calm market would size it many times of equity
+		err := fmt.Errorf("%v: %s", errUnboundedVol, s)
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	if maxLeverage > 0 {
+		sz = MaxLeverage{Sizer: sz, Ratio: maxLeverage}
+	}
+	return sz, nil
+}
+
+// Position return net position in base currency, which is negative if
+// short, equity in quote currency and the latest price
+func Position(s Symbol) (pos, equity, price float64, err error) {
+	price, err = s.Price()
+	if err != nil {
+		return 0, 0, 0, errors.Wrap(err, util.FuncName())
+	}
+	b, err := s.Balance(s.BaseCurrency())
+	if err != nil {
+		return 0, 0, 0, errors.Wrap(err, util.FuncName())
+	}
+	q, err := s.Balance(s.QuoteCurrency())
+	if err != nil {
+		return 0, 0, 0, errors.Wrap(err, util.FuncName())
+	}
+
+	pos = b.Trade + b.Frozen - b.Loan - b.Interest
+	equity = q.Trade + q.Frozen - q.Loan - q.Interest + pos*price
+	return pos, equity, price, nil
+}
+
+// Sized trade a symbol following a strategy signal, moving the position
+// toward the size of sz: long on rise and bull, flat on fall and short on
+// bear. only bull and bear may borrow.
+func Sized(s Symbol, signal uint8, sz Sizer) error {
+	if signal == strategy.SigNone {
+		if _, ok := sz.(observer); !ok {
+			return nil
+		}
+	}
+
+	pos, equity, price, err := Position(s)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if o, ok := sz.(observer); ok {
+		o.Observe(price)
+	}
+
+	var target float64
+	switch signal {
+	case strategy.SigRise, strategy.SigBull:
+		target = sz.Size(equity, price) / price
+	case strategy.SigFall:
+		target = 0
+	case strategy.SigBear:
+		target = -sz.Size(equity, price) / price
+	default:
+		return nil
+	}
+	if math.Abs(target-pos)*price < equity*RebalanceBand {
+		return nil
+	}
+
+	margin := signal == strategy.SigBull || signal == strategy.SigBear
+	err = Rebalance(s, target, margin)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// Rebalance trade a symbol until its net position is target in base
+// currency, the missing currency is borrowed if isMargin, and debts are
+// repaid with what was received.
+func Rebalance(s Symbol, target float64, isMargin bool) error {
+	err := s.CancelAll()
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	pos, _, price, err := Position(s)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	// close the position first when reversing it, so that its debt is
+	// repaid before borrowing the other currency
+	if pos*target < 0 {
+		if err = Rebalance(s, 0, isMargin); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		if pos, _, price, err = Position(s); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+
+	cmd, bc, qc := Buy, s.BaseCurrency(), s.QuoteCurrency()
+	amount := (target - pos) * price // quote currency to spend
+	if target < pos {
+		// sell base currency and receive quote currency
+		cmd, bc, qc = Sell, qc, bc
+		amount = pos - target
+	}
+
+	b, err := s.Balance(qc)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if isMargin && b.Trade < amount && b.LoanAvailable > 0 {
+		err = s.Borrow(qc, math.Min(amount-b.Trade, b.LoanAvailable))
+		if err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		if b, err = s.Balance(qc); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+	amount = math.Min(amount, b.Trade)
+
+	// check trade amount limit
+	l, err := s.Limit()
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	gt, lt := l.BuyGT, l.BuyLT
+	if cmd == Sell {
+		gt, lt = l.SellGT, l.SellLT
+	}
+	if amount <= 0 || amount < gt {
+		return nil
+	}
+	amount = math.Min(amount, lt)
+
+	f, err := s.Trade(cmd, amount)
+	if f == nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	// a short position is covered, or a long one is paid back
+	if e := s.Repay(bc, f.Received()); e != nil {
+		if err == nil {
+			err = e
+		} else {
+			err = errors.Wrap(err, e.Error())
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	return nil
+}
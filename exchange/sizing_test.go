@@ -0,0 +1,108 @@
+package exchange
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/strategy"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSizer(t *testing.T) {
+	Convey("should size positions by policies", t, func(c C) {
+		c.So(Fixed(100).Size(1000, 2), ShouldEqual, 100)
+		c.So(Fraction(0.5).Size(1000, 2), ShouldEqual, 500)
+
+		// observed every 365 days / 10000
+		v := &VolTarget{Target: 0.01, Window: 2, Interval: time.Hour * 24 * 365 / 10000}
+		v.Observe(100)
+		v.Observe(110)
+		c.So(v.Size(1000, 110), ShouldEqual, 0)
+		v.Observe(100)
+		c.So(v.Size(1000, 100), ShouldAlmostEqual, 1000*0.01/(math.Log(1.1)*100))
+
+		m := MaxLeverage{Sizer: v, Ratio: 0.0005}
+		m.Observe(100)
+		c.So(len(v.prices), ShouldEqual, 3)
+		c.So(m.Size(1000, 100), ShouldAlmostEqual, 0.5)
+	})
+}
+
+func TestParseSizer(t *testing.T) {
+	Convey("should parse sizing policies", t, func(c C) {
+		sz, err := ParseSizer("allin", 3, time.Second)
+		c.So(err, ShouldBeNil)
+		c.So(sz, ShouldBeNil)
+
+		sz, err = ParseSizer("fixed:100", 0, time.Second)
+		c.So(err, ShouldBeNil)
+		c.So(sz, ShouldEqual, Fixed(100))
+
+		sz, err = ParseSizer("fraction:0.5", 2, time.Second)
+		c.So(err, ShouldBeNil)
+		c.So(sz, ShouldResemble, MaxLeverage{Sizer: Fraction(0.5), Ratio: 2})
+
+		sz, err = ParseSizer("vol:0.2:30", 2, time.Second*5)
+		c.So(err, ShouldBeNil)
+		c.So(sz, ShouldResemble, MaxLeverage{
+			Sizer: &VolTarget{Target: 0.2, Window: 30, Interval: time.Second * 5},
+			Ratio: 2,
+		})
+
+		for _, v := range []string{"fixed", "fixed:-1", "fraction:abc", "vol:1:2:3", "kelly:1"} {
+			_, err = ParseSizer(v, 1, time.Second)
+			c.So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("should not size by volatility without a max leverage", t, func(c C) {
+		_, err := ParseSizer("vol:0.2", 0, time.Second*5)
+		c.So(errors.Cause(err).Error(), ShouldContainSubstring, errUnboundedVol.Error())
+
+		// a calm market sizes it about 80 times of equity
+		v := &VolTarget{Target: 0.2, Window: 2, Interval: time.Second * 5}
+		for _, p := range []float64{100, 100.0001, 100} {
+			v.Observe(p)
+		}
+		c.So(v.Size(1000, 100), ShouldBeGreaterThan, 1000*50)
+
+		sz, err := ParseSizer("vol:0.2:2", 3, time.Second*5)
+		c.So(err, ShouldBeNil)
+		for _, p := range []float64{100, 100.0001, 100} {
+			sz.(MaxLeverage).Observe(p)
+		}
+		c.So(sz.Size(1000, 100), ShouldEqual, 3000)
+	})
+}
+
+func TestSized(t *testing.T) {
+	Convey("should move toward the target position", t, func(c C) {
+		f := &fakeSymbol{balance: map[string]*Balance{
+			"usdt": {Trade: 100},
+			"doge": {Trade: 0},
+		}}
+
+		// equity is 100 usdt, buy 50 usdt at price 0.5
+		err := Sized(f, strategy.SigRise, Fraction(0.5))
+		c.So(err, ShouldBeNil)
+		c.So(f.trades, ShouldResemble, []string{Buy})
+
+		// within the rebalance band
+		f.balance["usdt"].Trade = 50
+		f.balance["doge"].Trade = 99
+		err = Sized(f, strategy.SigRise, Fraction(0.5))
+		c.So(err, ShouldBeNil)
+		c.So(f.trades, ShouldHaveLength, 1)
+
+		err = Sized(f, strategy.SigNone, Fraction(0.5))
+		c.So(err, ShouldBeNil)
+		c.So(f.trades, ShouldHaveLength, 1)
+
+		err = Sized(f, strategy.SigFall, Fraction(0.5))
+		c.So(err, ShouldBeNil)
+		c.So(f.trades, ShouldResemble, []string{Buy, Sell})
+		c.So(f.borrowed, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,202 @@
+package fixture
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// EnvRecord is the environment variable which makes Client record fixtures
+// from real servers instead of replaying them, e.g.,
+// CTS_RECORD=1 go test ./huobi -run TestFixtures
+const EnvRecord = "CTS_RECORD"
+
+type (
+	// Fixture is a request and its response, with credentials and
+	// signatures scrubbed
+	Fixture struct {
+		Method   string          `json:"method"`
+		Path     string          `json:"path"`
+		Query    string          `json:"query,omitempty"` // sorted, without scrubbed parameters
+		Body     string          `json:"body,omitempty"`
+		Status   int             `json:"status"`
+		Response json.RawMessage `json:"response"` // secrets of util.AddSecret are redacted
+	}
+
+	// Recorder is a http.RoundTripper which sends requests to real servers
+	// and saves them as fixtures in Dir
+	Recorder struct {
+		Dir       string
+		Transport http.RoundTripper // http.DefaultTransport if nil
+	}
+
+	// Replayer is a http.RoundTripper which responds with fixtures in Dir
+	// instead of sending requests, a request without a fixture is an error
+	Replayer struct {
+		Dir string
+	}
+)
+
+var (
+	// scrubbed are query parameters of credentials, signatures and clocks,
+	// which are neither saved nor matched
+	scrubbed = map[string]bool{
+		"AccessKeyId":      true,
+		"SignatureMethod":  true,
+		"SignatureVersion": true,
+		"Timestamp":        true,
+		"Signature":        true,
+		"access_token":     true,
+		"timestamp":        true,
+		"sign":             true,
+	}
+
+	errNoFixture = errors.New("no fixture")
+	errNotJSON   = errors.New("response is not json")
+)
+
+// Client return a client which replays fixtures in dir, or records them if
+// $CTS_RECORD is not empty
+func Client(dir string) *http.Client {
+	if Recording() {
+		return &http.Client{Transport: &Recorder{Dir: dir}}
+	}
+	return &http.Client{Transport: &Replayer{Dir: dir}}
+}
+
+// Recording return whether fixtures are recorded from real servers
+func Recording() bool {
+	return os.Getenv(EnvRecord) != ""
+}
+
+// RoundTrip send a request and save its response as a fixture
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	f, err := newFixture(req)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	t := r.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	resp, err := t.RoundTrip(req)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	bs, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(bs))
+
+	redacted := []byte(util.Redact(string(bs)))
+	if !json.Valid(redacted) {
+		err = fmt.Errorf("%v: %s %s", errNotJSON, f.Method, f.Path)
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	f.Status, f.Response = resp.StatusCode, redacted
+
+	out, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	if err = os.MkdirAll(r.Dir, 0755); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	err = ioutil.WriteFile(filepath.Join(r.Dir, f.Name()), append(out, '\n'), 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return resp, nil
+}
+
+// RoundTrip respond with the fixture of a request
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	f, err := newFixture(req)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(r.Dir, f.Name()))
+	if os.IsNotExist(err) {
+		err = fmt.Errorf("%v: %s %s?%s, record it by %s=1", errNoFixture, f.Method, f.Path, f.Query, EnvRecord)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	if err = json.Unmarshal(bs, f); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(f.Response)),
+		ContentLength: int64(len(f.Response)),
+		Request:       req,
+	}, nil
+}
+
+// Name return the file name of a fixture, e.g., GET_v1_common_symbols.json,
+// requests with a query or a body are told apart by a hash of them
+func (f *Fixture) Name() string {
+	name := f.Method + strings.Replace(f.Path, "/", "_", -1)
+	if f.Query != "" || f.Body != "" {
+		h := sha1.Sum([]byte(f.Query + "\n" + f.Body))
+		name += "_" + hex.EncodeToString(h[:4])
+	}
+	return name + ".json"
+}
+
+// newFixture return the fixture of a request without its response, the body
+// of the request is read and restored
+func newFixture(req *http.Request) (*Fixture, error) {
+	f := Fixture{Method: req.Method, Path: req.URL.Path, Query: scrub(req.URL.Query())}
+	if req.Body != nil {
+		bs, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(bs))
+		f.Body = string(bs)
+	}
+	return &f, nil
+}
+
+// scrub return the sorted query without scrubbed parameters
+func scrub(q url.Values) string {
+	var keys []string
+	for k := range q {
+		if !scrubbed[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var r []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			r = append(r, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(r, "&")
+}
@@ -0,0 +1,85 @@
+package fixture
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modood/cts/util"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFixture(t *testing.T) {
+	Convey("should record responses and replay them", t, func(c C) {
+		dir, err := ioutil.TempDir("", "fixture")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var hits int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			bs, _ := ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"status":"ok","echo":"` + string(bs) + `","user":"fixture-user-secret"}`))
+		}))
+		defer srv.Close()
+		util.AddSecret("fixture-user-secret")
+
+		rec := &http.Client{Transport: &Recorder{Dir: dir}}
+		u := srv.URL + "/v1/order/orders?states=filled&AccessKeyId=my-key&Timestamp=2018-03-01T08%3A00%3A00&Signature=abc"
+		resp, err := rec.Post(u, "application/json", strings.NewReader("1"))
+		c.So(err, ShouldBeNil)
+		bs, err := ioutil.ReadAll(resp.Body)
+		c.So(err, ShouldBeNil)
+		c.So(string(bs), ShouldContainSubstring, "fixture-user-secret")
+		c.So(hits, ShouldEqual, 1)
+
+		ns, err := filepath.Glob(filepath.Join(dir, "POST_v1_order_orders_*.json"))
+		c.So(err, ShouldBeNil)
+		c.So(ns, ShouldHaveLength, 1)
+		bs, err = ioutil.ReadFile(ns[0])
+		c.So(err, ShouldBeNil)
+		c.So(string(bs), ShouldContainSubstring, `"query": "states=filled"`)
+		c.So(string(bs), ShouldContainSubstring, `"echo": "1"`)
+		c.So(string(bs), ShouldNotContainSubstring, "my-key")
+		c.So(string(bs), ShouldNotContainSubstring, "fixture-user-secret")
+
+		// credentials and clocks of replayed requests differ
+		rep := &http.Client{Transport: &Replayer{Dir: dir}}
+		u = "https://example.com/v1/order/orders?Signature=xyz&states=filled&AccessKeyId=other&Timestamp=2020-01-01T00%3A00%3A00"
+		resp, err = rep.Post(u, "application/json", strings.NewReader("1"))
+		c.So(err, ShouldBeNil)
+		c.So(resp.StatusCode, ShouldEqual, http.StatusAccepted)
+		bs, err = ioutil.ReadAll(resp.Body)
+		c.So(err, ShouldBeNil)
+		c.So(string(bs), ShouldContainSubstring, `"echo": "1"`)
+		c.So(hits, ShouldEqual, 1)
+
+		_, err = rep.Post(u, "application/json", strings.NewReader("2"))
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, errNoFixture.Error())
+	})
+}
+
+func TestName(t *testing.T) {
+	Convey("should name fixtures by requests", t, func(c C) {
+		f := Fixture{Method: "GET", Path: "/v1/common/symbols"}
+		c.So(f.Name(), ShouldEqual, "GET_v1_common_symbols.json")
+
+		f.Query = "symbol=btcusdt"
+		a := f.Name()
+		c.So(a, ShouldStartWith, "GET_v1_common_symbols_")
+		f.Query = "symbol=ethusdt"
+		c.So(f.Name(), ShouldNotEqual, a)
+
+		r, err := http.NewRequest("GET", "https://api.huobipro.com/v1/common/exchange?Timestamp=x&symbol=btcusdt&AccessKeyId=k", nil)
+		c.So(err, ShouldBeNil)
+		g, err := newFixture(r)
+		c.So(err, ShouldBeNil)
+		c.So(g.Query, ShouldEqual, "symbol=btcusdt")
+	})
+}
@@ -1,15 +1,15 @@
 package gateio
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/mitchellh/mapstructure"
+	"github.com/modood/cts/transport"
 	"github.com/modood/cts/util"
 	"github.com/pkg/errors"
 )
@@ -28,7 +28,9 @@ type (
 		Low24hr       float64 // 24 小时最低价
 	}
 
-	gateioError struct {
+	// Error is an error of a request rejected by gateio, it matches ErrXxx by
+	// errors.Is, e.g., errors.Is(err, gateio.ErrTooManyAttempts)
+	Error struct {
 		// Response:
 		// true		success
 		// false	fail
@@ -60,13 +62,56 @@ type (
 	}
 )
 
+// DefaultURL is the base url of the gateio data API
+const DefaultURL = "http://data.gateio.io"
+
+// Client request market data of gateio, which needs no credentials
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+
+	// Observe receive the latency and error of every request to an
+	// endpoint, e.g., for metrics
+	Observe func(endpoint string, d time.Duration, err error)
+
+	transport *transport.Client
+}
+
 var (
+	// errors of gateio, which are matched by codes of Error
+	ErrTooManyAttempts     = errors.New("too many attempts")
+	ErrInvalidSignature    = errors.New("invalid signature")
+	ErrUnsupported         = errors.New("currency is not supported")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+
+	// requests are given up after requestTimeout, so that they fit in a
+	// cycle of bots
+	requestTimeout = time.Second * 4
+
 	json = jsoniter.ConfigCompatibleWithStandardLibrary
 )
 
+// NewClient return a client of gateio, baseURL is DefaultURL if empty and
+// hc is http.DefaultClient if nil
+func NewClient(baseURL string, hc *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	return &Client{
+		BaseURL: baseURL,
+		HTTP:    hc,
+		transport: &transport.Client{
+			Timeout:  time.Second * 2,
+			Attempts: 3,
+			Backoff:  transport.Backoff{Base: time.Millisecond * 250, Max: time.Second},
+			Limiter:  transport.NewLimiter(5, 5),
+		},
+	}
+}
+
 // Tickers return pairs
-func Tickers() (map[string]*Pair, error) {
-	m, err := get("http://data.gateio.io/api2/1/tickers")
+func (c *Client) Tickers(ctx context.Context) (map[string]*Pair, error) {
+	m, err := c.get(ctx, "/api2/1/tickers")
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
 	}
@@ -85,8 +130,8 @@ func Tickers() (map[string]*Pair, error) {
 }
 
 // Ticker returns ticker for the selected symbol
-func Ticker(symbol string) (*Pair, error) {
-	m, err := get("http://data.gateio.io/api2/1/ticker/" + symbol)
+func (c *Client) Ticker(ctx context.Context, symbol string) (*Pair, error) {
+	m, err := c.get(ctx, "/api2/1/ticker/"+symbol)
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
 	}
@@ -100,8 +145,8 @@ func Ticker(symbol string) (*Pair, error) {
 }
 
 // Rate return exchange rate of USD/CNY
-func Rate() (float64, error) {
-	p, err := Ticker("usdt_cny")
+func (c *Client) Rate(ctx context.Context) (float64, error) {
+	p, err := c.Ticker(ctx, "usdt_cny")
 	if err != nil {
 		return 0, errors.Wrap(err, util.FuncName())
 	}
@@ -110,12 +155,18 @@ func Rate() (float64, error) {
 }
 
 // Trend return market trend
-func Trend() (rise, fall uint16, err error) {
-	m, err := Tickers()
+func (c *Client) Trend(ctx context.Context) (rise, fall uint16, err error) {
+	m, err := c.Tickers(ctx)
 	if err != nil {
 		return 0, 0, errors.Wrap(err, util.FuncName())
 	}
 
+	rise, fall = TrendOf(m)
+	return rise, fall, nil
+}
+
+// TrendOf return market trend of usdt pairs
+func TrendOf(m map[string]*Pair) (rise, fall uint16) {
 	for k, v := range m {
 		if !strings.HasSuffix(k, "_usdt") {
 			continue
@@ -126,43 +177,27 @@ func Trend() (rise, fall uint16, err error) {
 			fall++
 		}
 	}
-	return rise, fall, nil
+	return rise, fall
 }
 
-func get(address string) (map[string]interface{}, error) {
-	var retry int
-t:
-	resp, err := http.Get(address)
+func (c *Client) get(ctx context.Context, path string) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	tc := *c.transport
+	tc.HTTP, tc.Observe = c.HTTP, c.Observe
+	resp, err := tc.Do(ctx, &transport.Request{Method: "GET", URL: c.BaseURL + path})
 	if err != nil {
-		if retry++; retry < 3 {
-			time.Sleep(time.Second * 10) // retry 10 seconds later
-			goto t
-		}
 		return nil, errors.Wrap(err, util.FuncName())
 	}
 
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
-
-	bs, err := ioutil.ReadAll(resp.Body)
-	if err := handle(bs, err); err != nil {
-		if retry++; retry < 3 {
-			time.Sleep(time.Second * 10) // retry 10 seconds later
-			goto t
-		}
+	if err := handle(resp.Body, nil); err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
 	}
 
 	m := make(map[string]interface{})
-	err = json.Unmarshal(bs, &m)
+	err = json.Unmarshal(resp.Body, &m)
 	if err != nil {
-		if retry++; retry < 3 {
-			time.Sleep(time.Second * 10) // retry 10 seconds later
-			goto t
-		}
 		return nil, errors.Wrap(err, util.FuncName())
 	}
 
@@ -180,7 +215,7 @@ func handle(bs []byte, err error) error {
 		return errors.Wrap(err, util.FuncName())
 	}
 
-	e := gateioError{}
+	e := Error{}
 
 	decoder, err := mapstructure.NewDecoder(
 		&mapstructure.DecoderConfig{
@@ -197,9 +232,27 @@ func handle(bs []byte, err error) error {
 	}
 
 	if e.Code != 0 {
-		err = fmt.Errorf("Code: %d, %s", e.Code, e.Message)
-		return errors.Wrap(err, util.FuncName())
+		return errors.Wrap(&e, util.FuncName())
 	}
 
 	return nil
 }
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Code: %d, %s", e.Code, e.Message)
+}
+
+// Is return whether the code of e means target
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrTooManyAttempts:
+		return e.Code == 4
+	case ErrInvalidSignature:
+		return e.Code == 5 || e.Code == 6
+	case ErrUnsupported:
+		return e.Code >= 7 && e.Code <= 9
+	case ErrInsufficientBalance:
+		return e.Code == 21
+	}
+	return false
+}
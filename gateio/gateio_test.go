@@ -1,40 +1,152 @@
 package gateio
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/modood/cts/fixture"
+	"github.com/modood/cts/mock"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+// newMock return a mock server of gateio and a client of it
+func newMock() (*mock.Server, *Client) {
+	srv := mock.NewServer()
+	srv.SetTicker("btc_usdt", mock.Ticker{Last: 6500, PercentChange: 1.2})
+	srv.SetTicker("eth_usdt", mock.Ticker{Last: 500, PercentChange: -0.8})
+	srv.SetTicker("usdt_cny", mock.Ticker{Last: 6.5})
+	return srv, NewClient(srv.URL, nil)
+}
+
 func TestTicker(t *testing.T) {
-	Convey("should return pair ticker", t, func() {
-		r, err := Ticker("btc_usdt")
-		So(err, ShouldBeNil)
-		So(r.Result, ShouldEqual, true)
+	Convey("should return pair ticker", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+
+		r, err := cl.Ticker(context.Background(), "btc_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(r.Result, ShouldEqual, true)
+		c.So(r.Last, ShouldEqual, 6500)
 
-		_, err = Ticker("btc_shit")
-		So(err, ShouldNotBeNil)
+		_, err = cl.Ticker(context.Background(), "btc_shit")
+		c.So(err, ShouldNotBeNil)
+		c.So(errors.Is(err, ErrUnsupported), ShouldBeTrue)
 	})
 }
 
 func TestTickers(t *testing.T) {
-	Convey("should return pairs", t, func() {
-		_, err := Tickers()
-		So(err, ShouldBeNil)
+	Convey("should return pairs", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+
+		r, err := cl.Tickers(context.Background())
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldHaveLength, 3)
+		c.So(r["eth_usdt"].PercentChange, ShouldEqual, -0.8)
 	})
 }
 
 func TestRate(t *testing.T) {
-	Convey("should return rate successfully", t, func() {
-		r, err := Rate()
-		So(err, ShouldBeNil)
-		So(r, ShouldBeGreaterThan, 0)
+	Convey("should return rate successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+
+		r, err := cl.Rate(context.Background())
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldEqual, 6.5)
 	})
 }
 
 func TestTrend(t *testing.T) {
-	Convey("should return trend successfully", t, func() {
-		_, _, err := Trend()
-		So(err, ShouldBeNil)
+	Convey("should return trend successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+
+		rise, fall, err := cl.Trend(context.Background())
+		c.So(err, ShouldBeNil)
+		c.So(rise, ShouldEqual, 1)
+		c.So(fall, ShouldEqual, 1)
+	})
+}
+
+func TestFixtures(t *testing.T) {
+	Convey("should decode payloads recorded from gateio", t, func(c C) {
+		cl := NewClient("", fixture.Client("testdata/fixtures"))
+
+		r, err := cl.Tickers(context.Background())
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldNotBeEmpty)
+		for _, v := range r {
+			c.So(v.Result, ShouldBeTrue)
+			c.So(v.Last, ShouldBeGreaterThan, 0)
+			c.So(v.LowestAsk, ShouldBeGreaterThanOrEqualTo, v.HighestBid)
+			c.So(v.HighestBid, ShouldBeGreaterThan, 0)
+			c.So(v.PercentChange, ShouldNotEqual, 0)
+			c.So(v.BaseVolume, ShouldBeGreaterThan, 0)
+			c.So(v.QuoteVolume, ShouldBeGreaterThan, 0)
+			c.So(v.High24hr, ShouldBeGreaterThanOrEqualTo, v.Low24hr)
+			c.So(v.Low24hr, ShouldBeGreaterThan, 0)
+		}
+	})
+}
+
+func TestClient(t *testing.T) {
+	Convey("should request the base url", t, func(c C) {
+		var path string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			w.Write([]byte(`{"result":"true","last":6.5,"percentChange":1.2}`))
+		}))
+		defer srv.Close()
+
+		cl := NewClient(srv.URL, srv.Client())
+		var endpoints []string
+		cl.Observe = func(endpoint string, d time.Duration, err error) {
+			endpoints = append(endpoints, endpoint)
+		}
+		r, err := cl.Rate(context.Background())
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldEqual, 6.5)
+		c.So(path, ShouldEqual, "/api2/1/ticker/usdt_cny")
+		c.So(endpoints, ShouldResemble, []string{"/api2/1/ticker/usdt_cny"})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = cl.Ticker(ctx, "btc_usdt")
+		c.So(errors.Is(err, context.Canceled), ShouldBeTrue)
+	})
+}
+
+func TestTrendOf(t *testing.T) {
+	Convey("should count usdt pairs only", t, func(c C) {
+		rise, fall := TrendOf(map[string]*Pair{
+			"btc_usdt":  {PercentChange: 1.2},
+			"eth_usdt":  {PercentChange: -0.5},
+			"xrp_usdt":  {PercentChange: 0},
+			"doge_btc":  {PercentChange: 3},
+			"doge_usdt": {PercentChange: 7},
+		})
+		c.So(rise, ShouldEqual, 2)
+		c.So(fall, ShouldEqual, 2)
+	})
+}
+
+func TestError(t *testing.T) {
+	Convey("should return typed errors of gateio", t, func(c C) {
+		err := handle([]byte(`{"result":"false","code":4,"message":"Too many attempts"}`), nil)
+		c.So(errors.Is(err, ErrTooManyAttempts), ShouldBeTrue)
+		c.So(errors.Is(err, ErrInvalidSignature), ShouldBeFalse)
+		var e *Error
+		c.So(errors.As(err, &e), ShouldBeTrue)
+		c.So(e.Message, ShouldEqual, "Too many attempts")
+
+		c.So(handle([]byte(`{"result":"true","code":0}`), nil), ShouldBeNil)
+		c.So(errors.Is(&Error{Code: 6}, ErrInvalidSignature), ShouldBeTrue)
+		c.So(errors.Is(&Error{Code: 8}, ErrUnsupported), ShouldBeTrue)
+		c.So(errors.Is(&Error{Code: 21}, ErrInsufficientBalance), ShouldBeTrue)
 	})
 }
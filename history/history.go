@@ -0,0 +1,294 @@
+package history
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/indicator"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Snapshot is the whole market tickers at a moment
+	Snapshot struct {
+		Time    time.Time                     `json:"time"`
+		Tickers map[string]*gateio.Pair       `json:"tickers"`
+		Klines  map[string][]indicator.Candle `json:"klines,omitempty"` // huobi klines by symbol, oldest first
+	}
+
+	// Replay is a strategy.Feed which serves recorded snapshots one by one
+	Replay struct {
+		snaps []Snapshot
+		pos   int
+	}
+
+	// Writer append snapshots to gzip compressed JSON lines files in a
+	// directory, files are rotated every period and never reopened, so that
+	// a restart or a crash can not corrupt recorded data.
+	Writer struct {
+		dir    string
+		prefix string
+		period time.Duration
+
+		start time.Time // start of current period
+		f     *os.File
+		gw    *gzip.Writer
+	}
+)
+
+var (
+	errNoSnapshot = errors.New("no snapshot")
+	errNoTicker   = errors.New("no ticker")
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// Load read snapshots from files or directories, files should be JSON lines
+// and may be compressed by gzip(*.jsonl.gz). snapshots are sorted by time.
+func Load(paths ...string) ([]Snapshot, error) {
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		fis, err := ioutil.ReadDir(p)
+		if err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		for _, v := range fis {
+			if !v.IsDir() && (strings.HasSuffix(v.Name(), ".jsonl") ||
+				strings.HasSuffix(v.Name(), ".jsonl.gz")) {
+				files = append(files, filepath.Join(p, v.Name()))
+			}
+		}
+	}
+
+	var snaps []Snapshot
+	for _, v := range files {
+		ss, err := loadFile(v)
+		if err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		snaps = append(snaps, ss...)
+	}
+
+	sort.SliceStable(snaps, func(i, j int) bool {
+		return snaps[i].Time.Before(snaps[j].Time)
+	})
+
+	// drop duplicates which were recorded by multiple recorders
+	r := snaps[:0]
+	for i, v := range snaps {
+		if i > 0 && v.Time.Equal(snaps[i-1].Time) {
+			continue
+		}
+		r = append(r, v)
+	}
+	return r, nil
+}
+
+func loadFile(name string) ([]Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err == io.EOF {
+			// the writer was killed before writing anything
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		defer func() {
+			if err := gr.Close(); err != nil {
+				log.Println(err)
+			}
+		}()
+		r = gr
+	}
+
+	return Decode(r)
+}
+
+// Decode read snapshots from JSON lines, a truncated last line is ignored
+func Decode(r io.Reader) ([]Snapshot, error) {
+	var snaps []Snapshot
+
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		bs, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		eof := err != nil
+
+		if len(strings.TrimSpace(string(bs))) != 0 {
+			s := Snapshot{}
+			if e := json.Unmarshal(bs, &s); e != nil {
+				// the writer was killed while writing the last line
+				if eof {
+					break
+				}
+				e = fmt.Errorf("line %d: %v", line, e)
+				return nil, errors.Wrap(e, util.FuncName())
+			}
+			snaps = append(snaps, s)
+		}
+
+		if eof {
+			break
+		}
+	}
+
+	return snaps, nil
+}
+
+// NewReplay return a replay feed positioned at the first snapshot
+func NewReplay(snaps []Snapshot) *Replay {
+	return &Replay{snaps: snaps}
+}
+
+// Len return number of snapshots
+func (r *Replay) Len() int {
+	return len(r.snaps)
+}
+
+// Seek move to the ith snapshot
+func (r *Replay) Seek(i int) {
+	r.pos = i
+}
+
+// Current return current snapshot
+func (r *Replay) Current() (*Snapshot, error) {
+	if r.pos < 0 || r.pos >= len(r.snaps) {
+		return nil, errors.Wrap(errNoSnapshot, util.FuncName())
+	}
+	return &r.snaps[r.pos], nil
+}
+
+// Ticker return ticker of the symbol at current snapshot
+func (r *Replay) Ticker(symbol string) (*gateio.Pair, error) {
+	s, err := r.Current()
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	p, ok := s.Tickers[symbol]
+	if !ok || p == nil {
+		err = fmt.Errorf("%v: %s at %s", errNoTicker, symbol, s.Time.Format(time.RFC3339))
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return p, nil
+}
+
+// Trend return market trend at current snapshot
+func (r *Replay) Trend() (rise, fall uint16, err error) {
+	s, err := r.Current()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, util.FuncName())
+	}
+
+	rise, fall = gateio.TrendOf(s.Tickers)
+	return rise, fall, nil
+}
+
+// NewWriter return a writer of directory dir, which is created if necessary
+func NewWriter(dir, prefix string, period time.Duration) (*Writer, error) {
+	if period <= 0 {
+		period = time.Hour
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	return &Writer{dir: dir, prefix: prefix, period: period}, nil
+}
+
+// Write append a snapshot, it is flushed to disk before return
+func (w *Writer) Write(s *Snapshot) error {
+	start := s.Time.Truncate(w.period)
+	if w.f == nil || !start.Equal(w.start) {
+		if err := w.rotate(start); err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+
+	bs, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if _, err = w.gw.Write(append(bs, '\n')); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if err = w.gw.Flush(); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// Close finish current file
+func (w *Writer) Close() error {
+	if w.f == nil {
+		return nil
+	}
+
+	err := w.gw.Close()
+	if e := w.f.Close(); err == nil {
+		err = e
+	}
+	w.f, w.gw = nil, nil
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+func (w *Writer) rotate(start time.Time) error {
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	base := w.prefix + "-" + start.Format("20060102T1504")
+	name := filepath.Join(w.dir, base+".jsonl.gz")
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			// restarted within the period
+			name = filepath.Join(w.dir, fmt.Sprintf("%s.%d.jsonl.gz", base, i))
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+
+		w.f, w.gw, w.start = f, gzip.NewWriter(f), start
+		return nil
+	}
+}
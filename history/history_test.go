@@ -0,0 +1,123 @@
+package history
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/gateio"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const lines = `{"time":"2018-03-01T08:00:05+08:00","tickers":{"doge_usdt":{"PercentChange":5,"Last":0.005},"xrp_usdt":{"PercentChange":-1,"Last":0.9}}}
+{"time":"2018-03-01T08:00:00+08:00","tickers":{"doge_usdt":{"PercentChange":4,"Last":0.004}}}
+{"time":"2018-03-01T08:00:10+08:00","tick`
+
+func TestDecode(t *testing.T) {
+	Convey("should decode json lines and ignore truncated last line", t, func(c C) {
+		snaps, err := Decode(strings.NewReader(lines))
+		c.So(err, ShouldBeNil)
+		c.So(snaps, ShouldHaveLength, 2)
+		c.So(snaps[0].Tickers["doge_usdt"].Last, ShouldEqual, 0.005)
+
+		_, err = Decode(strings.NewReader("{}\nxxx\n{}\n"))
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "line 2")
+	})
+}
+
+func TestLoad(t *testing.T) {
+	Convey("should load snapshots from directory sorted by time", t, func(c C) {
+		dir, err := ioutil.TempDir("", "history")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err = w.Write([]byte(lines))
+		c.So(err, ShouldBeNil)
+		c.So(w.Close(), ShouldBeNil)
+
+		c.So(ioutil.WriteFile(filepath.Join(dir, "a.jsonl.gz"), buf.Bytes(), 0644), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(dir, "b.jsonl"), []byte(lines), 0644), ShouldBeNil)
+		c.So(ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("xxx"), 0644), ShouldBeNil)
+
+		// both files contain the same snapshots
+		snaps, err := Load(dir)
+		c.So(err, ShouldBeNil)
+		c.So(snaps, ShouldHaveLength, 2)
+		for i := 1; i < len(snaps); i++ {
+			c.So(snaps[i].Time.Before(snaps[i-1].Time), ShouldBeFalse)
+		}
+
+		_, err = Load(filepath.Join(dir, "nonexistent"))
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestReplay(t *testing.T) {
+	Convey("should serve snapshots one by one", t, func(c C) {
+		snaps, err := Decode(strings.NewReader(lines))
+		c.So(err, ShouldBeNil)
+
+		r := NewReplay(snaps)
+		c.So(r.Len(), ShouldEqual, 2)
+
+		p, err := r.Ticker("xrp_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(p.Last, ShouldEqual, 0.9)
+
+		rise, fall, err := r.Trend()
+		c.So(err, ShouldBeNil)
+		c.So(rise, ShouldEqual, 1)
+		c.So(fall, ShouldEqual, 1)
+
+		r.Seek(1)
+		_, err = r.Ticker("xrp_usdt")
+		c.So(err, ShouldNotBeNil)
+
+		r.Seek(2)
+		_, _, err = r.Trend()
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestWriter(t *testing.T) {
+	Convey("should rotate files and survive restarts", t, func(c C) {
+		dir, err := ioutil.TempDir("", "history")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		t0 := time.Date(2018, 3, 1, 8, 59, 55, 0, time.UTC)
+		tickers := map[string]*gateio.Pair{"doge_usdt": {Last: 0.005}}
+
+		w, err := NewWriter(dir, "tickers", time.Hour)
+		c.So(err, ShouldBeNil)
+		for i := 0; i < 3; i++ {
+			err = w.Write(&Snapshot{Time: t0.Add(time.Duration(i) * 5 * time.Second), Tickers: tickers})
+			c.So(err, ShouldBeNil)
+		}
+		c.So(w.Close(), ShouldBeNil)
+
+		// restart within the same period and get killed without closing
+		w, err = NewWriter(dir, "tickers", time.Hour)
+		c.So(err, ShouldBeNil)
+		err = w.Write(&Snapshot{Time: t0.Add(20 * time.Second), Tickers: tickers})
+		c.So(err, ShouldBeNil)
+
+		fis, err := ioutil.ReadDir(dir)
+		c.So(err, ShouldBeNil)
+		c.So(fis, ShouldHaveLength, 3)
+
+		snaps, err := Load(dir)
+		c.So(err, ShouldBeNil)
+		c.So(snaps, ShouldHaveLength, 4)
+		c.So(snaps[3].Tickers["doge_usdt"].Last, ShouldEqual, 0.005)
+		c.So(w.Close(), ShouldBeNil)
+	})
+}
@@ -0,0 +1,191 @@
+package huobi
+
+import (
+	"context"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Exchange is the huobi implementation of exchange.Exchange of the
+	// account of Client
+	Exchange struct {
+		Client *Client
+	}
+
+	// market adapts Symbol to exchange.Symbol, its requests are sent within
+	// ctx
+	market struct {
+		s   *Symbol
+		ctx context.Context
+	}
+)
+
+// Name return exchange name
+func (Exchange) Name() string {
+	return "huobi"
+}
+
+// Symbols return all support symbol name, e.g., btc_usdt
+func (e Exchange) Symbols(ctx context.Context) ([]string, error) {
+	ss, err := e.Client.Symbols(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	r := make([]string, 0, len(ss))
+	for _, v := range ss {
+		r = append(r, v.BaseCurrency+"_"+v.QuoteCurrency)
+	}
+	return r, nil
+}
+
+// Symbol return a tradable symbol by name, e.g., btc_usdt, its requests are
+// sent within ctx
+func (e Exchange) Symbol(ctx context.Context, name string) (exchange.Symbol, error) {
+	s, err := e.Client.Symbol(ctx, name)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return &market{s, ctx}, nil
+}
+
+func (m *market) Name() string          { return m.s.Name }
+func (m *market) BaseCurrency() string  { return m.s.BaseCurrency }
+func (m *market) QuoteCurrency() string { return m.s.QuoteCurrency }
+
+func (m *market) Price() (float64, error) {
+	d, err := m.s.Merged(m.ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, util.FuncName())
+	}
+	return d.Close, nil
+}
+
+func (m *market) Balance(currency string) (*exchange.Balance, error) {
+	c, err := m.s.Carry(m.ctx, currency)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	return &exchange.Balance{
+		Trade:         c.Trade,
+		Frozen:        c.Frozen,
+		LoanAvailable: c.LoanAvailable,
+		Loan:          c.Loan,
+		Interest:      c.Interest,
+	}, nil
+}
+
+func (m *market) RiskRate() (float64, error) {
+	a, err := m.s.Account(m.ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, util.FuncName())
+	}
+	return a.RiskRate, nil
+}
+
+func (m *market) Limit() (*exchange.Limit, error) {
+	l, err := m.s.Limit(m.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	return &exchange.Limit{
+		BuyGT:  l.BuyGT,
+		BuyLT:  l.BuyLT,
+		SellGT: l.SellGT,
+		SellLT: l.SellLT,
+	}, nil
+}
+
+func (m *market) Trade(cmd string, amount float64) (*exchange.Fill, error) {
+	f, err := m.s.Trade(m.ctx, cmd, amount)
+	if f == nil {
+		return nil, err
+	}
+
+	return &exchange.Fill{
+		OrderID:          f.OrderID,
+		Type:             f.Type,
+		State:            f.State,
+		Amount:           f.Amount,
+		FilledAmount:     f.FilledAmount,
+		FilledCashAmount: f.FilledCashAmount,
+		Fees:             f.Fees,
+		Price:            f.Price,
+	}, err
+}
+
+func (m *market) Order(ID uint64) (*exchange.Order, error) {
+	o, err := m.s.c.OrderDetail(m.ctx, ID)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	r := order(o)
+	return &r, nil
+}
+
+func (m *market) OpenOrders() ([]exchange.Order, error) {
+	oos, err := m.s.OpenOrders(m.ctx, "")
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	r := make([]exchange.Order, 0, len(oos))
+	for i := range oos {
+		r = append(r, order(&oos[i]))
+	}
+	return r, nil
+}
+
+func (m *market) Cancel(ID uint64) error {
+	return m.s.Cancel(m.ctx, ID)
+}
+
+func (m *market) CancelAll() error {
+	return m.s.CancelAll(m.ctx)
+}
+
+func (m *market) Loans() ([]exchange.Loan, error) {
+	bos, err := m.s.BorrowOrders(m.ctx, "accrual")
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	r := make([]exchange.Loan, 0, len(bos))
+	for _, v := range bos {
+		r = append(r, exchange.Loan{
+			ID:       v.ID,
+			Currency: v.Currency,
+			Amount:   v.LoanAmount,
+			Interest: v.InterestAmount,
+		})
+	}
+	return r, nil
+}
+
+func (m *market) Borrow(currency string, amount float64) error {
+	return m.s.Borrow(m.ctx, currency, amount)
+}
+
+func (m *market) Repay(currency string, amount float64) error {
+	return m.s.RepayUpTo(m.ctx, currency, amount)
+}
+
+func order(o *OpenOrder) exchange.Order {
+	return exchange.Order{
+		ID:               o.ID,
+		Symbol:           o.Symbol,
+		Type:             o.Type,
+		State:            o.State,
+		Amount:           o.Amount,
+		Price:            o.Price,
+		FilledAmount:     o.FieldAmount,
+		FilledCashAmount: o.FieldCashAmount,
+		FilledFees:       o.FieldFees,
+	}
+}
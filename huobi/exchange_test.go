@@ -0,0 +1,22 @@
+package huobi
+
+import (
+	"testing"
+
+	"github.com/modood/cts/exchange"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExchange(t *testing.T) {
+	Convey("should implement exchange interface", t, func(c C) {
+		var e exchange.Exchange = Exchange{Client: NewClient("", "", "", nil, nil)}
+		c.So(e.Name(), ShouldEqual, "huobi")
+
+		_, err := e.Symbol(ctx, "btcusdt")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, errInvalidSymbol.Error())
+
+		var _ exchange.Symbol = &market{}
+		var _ exchange.RiskRater = &market{}
+	})
+}
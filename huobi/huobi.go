@@ -1,33 +1,65 @@
 package huobi
 
 import (
-	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
 	"math"
-	"net"
 	"net/http"
 	"net/url"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/mitchellh/mapstructure"
-	"github.com/modood/cts/dingtalk"
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/transport"
 	"github.com/modood/cts/util"
 	"github.com/pkg/errors"
 )
 
+// DefaultURL is the base url of the huobi API
+const DefaultURL = "https://api.huobipro.com"
+
 type (
+	// Client is a client of the huobi API of an account
+	Client struct {
+		BaseURL string
+		Key     string // api key
+		Secret  string // secret key
+		HTTP    *http.Client
+		Now     func() time.Time
+
+		// Notify receive events of trades, borrows and repays, they are
+		// logged if it is nil
+		Notify func(text string)
+
+		// Observe receive the latency and error of every request to an
+		// endpoint, whose numeric path segments are {id}, e.g., for metrics
+		Observe func(endpoint string, d time.Duration, err error)
+
+		// TradeTimeout is how long Trade waits for an order to be filled
+		TradeTimeout time.Duration
+
+		transport *transport.Client
+
+		// pending orders by symbol, they are saved in pendingFile if not
+		// empty, so that a restart can find out whether they have been placed
+		pending     map[string]pendingOrder
+		pendingFile string
+		pendingMu   sync.Mutex
+	}
+
 	// Symbol ...
 	Symbol struct {
+		c *Client
+
 		Name            string
 		BaseCurrency    string `mapstructure:"base-currency" json:"base-currency"`
 		QuoteCurrency   string `mapstructure:"quote-currency" json:"quote-currency"`
@@ -121,7 +153,9 @@ type (
 		AccruedAt       uint64  `mapstructure:"accrued-at" json:"accrued-at"`
 	}
 
-	huobiError struct {
+	// Error is an error of a request rejected by huobi, it matches ErrXxx by
+	// errors.Is, e.g., errors.Is(err, huobi.ErrInsufficientBalance)
+	Error struct {
 		Status string
 		// Error code:
 		// base-symbol-error                            交易对不存在
@@ -153,27 +187,62 @@ type (
 )
 
 var (
-	key    string // your api key
-	secret string // your secret key
-
 	errInvalidSymbol     = errors.New("invalid symbol name, A valid name should look like: btc_usdt")
 	errInvalidCurrency   = errors.New("invalid currency")
 	errUnsupportedSymbol = errors.New("unsupported symbol")
 	errNoMarginAccount   = errors.New("no margin account")
 	errUnkownTradeType   = errors.New("unknown trade type, it should be `BUY` or `SELL`")
 
+	// errors of huobi, which are matched by codes of Error
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrInvalidSignature    = errors.New("invalid signature")
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrBusy                = errors.New("huobi is busy")
+
+	// a request is given up after requestTimeout
+	requestTimeout = time.Second * 10
+
 	json = jsoniter.ConfigCompatibleWithStandardLibrary
 )
 
-// Init set apikey and secretkey
-func Init(apikey, secretkey string) {
-	key = apikey
-	secret = secretkey
+// NewClient return a client of the account of key, baseURL is DefaultURL if
+// empty, hc is http.DefaultClient if nil and now is time.Now if nil
+func NewClient(baseURL, key, secret string, hc *http.Client, now func() time.Time) *Client {
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &Client{
+		BaseURL:      baseURL,
+		Key:          key,
+		Secret:       secret,
+		HTTP:         hc,
+		Now:          now,
+		TradeTimeout: time.Second * 30,
+		// requests of an account are at most 10 per second
+		transport: &transport.Client{
+			Timeout:  time.Second * 3,
+			Attempts: 3,
+			Backoff:  transport.Backoff{Base: time.Millisecond * 200, Max: time.Second * 2},
+			Limiter:  transport.NewLimiter(10, 10),
+		},
+		pending: map[string]pendingOrder{},
+	}
+}
+
+func (c *Client) notify(text string) {
+	if c.Notify == nil {
+		log.Println(text)
+		return
+	}
+	c.Notify(text)
 }
 
 // Symbols return all support symbol
-func Symbols() ([]Symbol, error) {
-	m, err := req("GET", "https://api.huobipro.com/v1/common/symbols", nil)
+func (c *Client) Symbols(ctx context.Context) ([]Symbol, error) {
+	m, err := c.req(ctx, "GET", "/v1/common/symbols", nil)
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
 	}
@@ -187,9 +256,8 @@ func Symbols() ([]Symbol, error) {
 }
 
 // OrderDetail return order detail by ID
-func OrderDetail(ID uint64) (*OpenOrder, error) {
-	m, err := req("GET", "https://api.huobipro.com/v1/order/orders/"+
-		strconv.FormatUint(ID, 10), nil)
+func (c *Client) OrderDetail(ctx context.Context, ID uint64) (*OpenOrder, error) {
+	m, err := c.req(ctx, "GET", "/v1/order/orders/"+strconv.FormatUint(ID, 10), nil)
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
 	}
@@ -202,14 +270,14 @@ func OrderDetail(ID uint64) (*OpenOrder, error) {
 	return &r.Data, nil
 }
 
-// NewSymbol return new symbol
-func NewSymbol(name string) (*Symbol, error) {
+// Symbol return a symbol by name, e.g., btc_usdt
+func (c *Client) Symbol(ctx context.Context, name string) (*Symbol, error) {
 	n := strings.Split(name, "_")
 	if len(n) != 2 {
 		return nil, errors.Wrap(errInvalidSymbol, util.FuncName())
 	}
 
-	ss, err := Symbols()
+	ss, err := c.Symbols(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
 	}
@@ -217,6 +285,7 @@ func NewSymbol(name string) (*Symbol, error) {
 	for _, v := range ss {
 		if n[0] == v.BaseCurrency && n[1] == v.QuoteCurrency {
 			s = &v
+			s.c = c
 			s.Name = v.BaseCurrency + v.QuoteCurrency
 			break
 		}
@@ -229,8 +298,8 @@ func NewSymbol(name string) (*Symbol, error) {
 }
 
 // Limit return trade limit of a symbol
-func (s *Symbol) Limit() (*Limit, error) {
-	m, err := req("GET", "https://api.huobipro.com/v1/common/exchange",
+func (s *Symbol) Limit(ctx context.Context) (*Limit, error) {
+	m, err := s.c.req(ctx, "GET", "/v1/common/exchange",
 		map[string]string{"symbol": s.Name})
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
@@ -245,8 +314,8 @@ func (s *Symbol) Limit() (*Limit, error) {
 }
 
 // Account return margin account
-func (s *Symbol) Account() (*Account, error) {
-	m, err := req("GET", "https://api.huobipro.com/v1/margin/accounts/balance",
+func (s *Symbol) Account(ctx context.Context) (*Account, error) {
+	m, err := s.c.req(ctx, "GET", "/v1/margin/accounts/balance",
 		map[string]string{"symbol": s.Name})
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
@@ -264,8 +333,8 @@ func (s *Symbol) Account() (*Account, error) {
 }
 
 // Carry return balance of specific currency
-func (s *Symbol) Carry(currency string) (*Carry, error) {
-	a, err := s.Account()
+func (s *Symbol) Carry(ctx context.Context, currency string) (*Carry, error) {
+	a, err := s.Account(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
 	}
@@ -294,8 +363,8 @@ func (s *Symbol) Carry(currency string) (*Carry, error) {
 }
 
 // Orders return finished orders
-func (s *Symbol) Orders() ([]Order, error) {
-	m, err := req("GET", "https://api.huobipro.com/v1/order/matchresults",
+func (s *Symbol) Orders(ctx context.Context) ([]Order, error) {
+	m, err := s.c.req(ctx, "GET", "/v1/order/matchresults",
 		map[string]string{"symbol": s.Name})
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
@@ -310,12 +379,12 @@ func (s *Symbol) Orders() ([]Order, error) {
 }
 
 // OpenOrders return pendding orders
-func (s *Symbol) OpenOrders(state string) ([]OpenOrder, error) {
+func (s *Symbol) OpenOrders(ctx context.Context, state string) ([]OpenOrder, error) {
 	if state == "" {
 		state = "pre-submitted,submitted,partial-filled"
 	}
 
-	m, err := req("GET", "https://api.huobipro.com/v1/order/orders",
+	m, err := s.c.req(ctx, "GET", "/v1/order/orders",
 		map[string]string{
 			"symbol": s.Name,
 			"states": state,
@@ -333,8 +402,8 @@ func (s *Symbol) OpenOrders(state string) ([]OpenOrder, error) {
 }
 
 // BorrowOrders return borrow orders
-func (s *Symbol) BorrowOrders(state string) ([]BorrowOrder, error) {
-	m, err := req("GET", "https://api.huobipro.com/v1/margin/loan-orders",
+func (s *Symbol) BorrowOrders(ctx context.Context, state string) ([]BorrowOrder, error) {
+	m, err := s.c.req(ctx, "GET", "/v1/margin/loan-orders",
 		map[string]string{
 			"symbol": s.Name,
 			"states": state,
@@ -352,12 +421,12 @@ func (s *Symbol) BorrowOrders(state string) ([]BorrowOrder, error) {
 }
 
 // BorrowAvailable return available amount to borrow
-func (s *Symbol) BorrowAvailable(currency string) (float64, error) {
+func (s *Symbol) BorrowAvailable(ctx context.Context, currency string) (float64, error) {
 	if currency != s.BaseCurrency && currency != s.QuoteCurrency {
 		return 0, errors.Wrap(errInvalidCurrency, util.FuncName())
 	}
 
-	a, err := s.Account()
+	a, err := s.Account(ctx)
 	if err != nil {
 		return 0, errors.Wrap(err, util.FuncName())
 	}
@@ -370,12 +439,12 @@ func (s *Symbol) BorrowAvailable(currency string) (float64, error) {
 }
 
 // Borrow borrow money
-func (s *Symbol) Borrow(currency string, amount float64) error {
+func (s *Symbol) Borrow(ctx context.Context, currency string, amount float64) error {
 	if currency != s.BaseCurrency && currency != s.QuoteCurrency {
 		return errors.Wrap(errInvalidCurrency, util.FuncName())
 	}
 
-	_, err := req("POST", "https://api.huobipro.com/v1/margin/orders",
+	_, err := s.c.req(ctx, "POST", "/v1/margin/orders",
 		map[string]string{
 			"symbol":   s.Name,
 			"currency": currency,
@@ -385,24 +454,29 @@ func (s *Symbol) Borrow(currency string, amount float64) error {
 		return errors.Wrap(err, util.FuncName())
 	}
 
-	msg := fmt.Sprintf("%s\n类型：%s\n品种：%s\n数量：%.4f %s",
-		time.Now().Format("2006-01-02 15:04:05"),
-		"borrow", s.Name, amount, currency)
-	err = dingtalk.Push(msg, true)
-	if err != nil {
-		log.Println(err)
-	}
+	s.c.notify(fmt.Sprintf("%s\n类型：%s\n品种：%s\n数量：%.4f %s",
+		s.c.Now().Format("2006-01-02 15:04:05"),
+		"borrow", s.Name, amount, currency))
 
 	return nil
 }
 
 // Repay repay all debt
-func (s *Symbol) Repay(currency string) error {
+func (s *Symbol) Repay(ctx context.Context, currency string) error {
+	err := s.RepayUpTo(ctx, currency, math.MaxFloat64)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// RepayUpTo repay debt of currency, the total repayment is at most amount
+func (s *Symbol) RepayUpTo(ctx context.Context, currency string, amount float64) error {
 	if currency != s.BaseCurrency && currency != s.QuoteCurrency {
 		return errors.Wrap(errInvalidCurrency, util.FuncName())
 	}
 
-	bos, err := s.BorrowOrders("accrual")
+	bos, err := s.BorrowOrders(ctx, "accrual")
 	if err != nil {
 		return errors.Wrap(err, util.FuncName())
 	}
@@ -413,23 +487,28 @@ func (s *Symbol) Repay(currency string) error {
 			continue
 		}
 
-		_, err := req("POST", "https://api.huobipro.com/v1/margin/orders/"+
+		pay := math.Min(v.LoanAmount+v.InterestAmount, amount)
+		if pay <= 0 {
+			break
+		}
+
+		_, err := s.c.req(ctx, "POST", "/v1/margin/orders/"+
 			strconv.FormatUint(v.ID, 10)+"/repay",
 			map[string]string{
-				"amount": floor(v.LoanAmount+v.InterestAmount, 8),
+				"amount": floor(pay, 8),
 			})
 		if err != nil {
 			errs = append(errs, err.Error()+"(ID: "+strconv.FormatUint(v.ID, 10)+")")
 			continue
 		}
+		amount -= pay
 
+		// interest is repaid first
+		interest := math.Min(pay, v.InterestAmount)
 		msg := fmt.Sprintf("%s\n类型：%s\n品种：%s\n数量：%.4f %s\n利息：%.6f %s",
-			time.Now().Format("2006-01-02 15:04:05"),
-			"repay", s.Name, v.LoanAmount, currency, v.InterestAmount, currency)
-		err = dingtalk.Push(msg, true)
-		if err != nil {
-			log.Println(err)
-		}
+			s.c.Now().Format("2006-01-02 15:04:05"),
+			"repay", s.Name, pay-interest, currency, interest, currency)
+		s.c.notify(msg)
 	}
 	if len(errs) != 0 {
 		return errors.Wrap(errors.New(strings.Join(errs, ";")), util.FuncName())
@@ -437,11 +516,12 @@ func (s *Symbol) Repay(currency string) error {
 	return nil
 }
 
-// Trade place new margin order
-func (s *Symbol) Trade(cmd string, amount float64) error {
-	a, err := s.Account()
+// Trade place new margin order and wait until it is filled, the leftover is
+// canceled if it is not filled in TradeTimeout
+func (s *Symbol) Trade(ctx context.Context, cmd string, amount float64) (*Fill, error) {
+	a, err := s.Account(ctx)
 	if err != nil {
-		return errors.Wrap(err, util.FuncName())
+		return nil, errors.Wrap(err, util.FuncName())
 	}
 
 	params := map[string]string{
@@ -464,48 +544,49 @@ func (s *Symbol) Trade(cmd string, amount float64) error {
 		params["price"] = "100000"
 		params["type"] = "sell-limit"
 	default:
-		return errors.Wrap(errUnkownTradeType, util.FuncName())
+		return nil, errors.Wrap(errUnkownTradeType, util.FuncName())
 	}
 
-	m, err := req("POST", "https://api.huobipro.com/v1/order/orders/place", params)
+	ID, err := s.c.place(ctx, params)
 	if err != nil {
-		return errors.Wrap(err, util.FuncName())
+		return nil, errors.Wrap(err, util.FuncName())
 	}
 
-	r := struct{ Data uint64 }{}
-	if err := util.Decode(m, &r); err != nil {
-		return errors.Wrap(err, util.FuncName())
+	f, err := s.Track(ctx, ID, s.c.TradeTimeout)
+	if f != nil {
+		msg := fmt.Sprintf("%s\n订单：%d\n状态：%s\n类型：%s\n品种：%s\n价格：$%.4f\n成交：%.4f %s\n金额：$%.2f\n手续费：%.6f",
+			s.c.Now().Format("2006-01-02 15:04:05"), f.OrderID, f.State,
+			strings.ToLower(cmd), s.Name, f.Price, f.FilledAmount, s.BaseCurrency,
+			f.FilledCashAmount, f.Fees)
+		s.c.notify(msg)
 	}
-
-	time.Sleep(time.Second * 5) // await until order state changed: submitted => filled
-	o, err := OrderDetail(r.Data)
-	if err := util.Decode(m, &r); err != nil {
-		return errors.Wrap(err, util.FuncName())
+	if err != nil {
+		return f, errors.Wrap(err, util.FuncName())
 	}
 
-	msg := fmt.Sprintf("%s\n订单：%d\n状态：%s\n类型：%s\n品种：%s\n价格：$%.2f\n数量：$%.2f",
-		time.Now().Format("2006-01-02 15:04:05"), o.ID, o.State,
-		strings.ToLower(cmd), o.Symbol, o.FieldCashAmount/o.FieldAmount, o.FieldCashAmount)
+	return f, nil
+}
 
-	err = dingtalk.Push(msg, true)
+// Cancel cancel an open order by ID
+func (s *Symbol) Cancel(ctx context.Context, ID uint64) error {
+	_, err := s.c.req(ctx, "POST", "/v1/order/orders/"+
+		strconv.FormatUint(ID, 10)+"/submitcancel", nil)
 	if err != nil {
-		log.Println(err)
+		return errors.Wrap(err, util.FuncName())
 	}
-
 	return nil
 }
 
 // CancelAll cancel all open orders
-func (s *Symbol) CancelAll() error {
-	oos, err := s.OpenOrders("")
+func (s *Symbol) CancelAll(ctx context.Context) error {
+	oos, err := s.OpenOrders(ctx, "")
 	if err != nil {
 		return errors.Wrap(err, util.FuncName())
 	}
 
 	var errs []string
 	for _, v := range oos {
-		_, err := req("POST", "https://api.huobipro.com/v1/order/orders/"+
-			strconv.FormatUint(v.ID, 10)+"/submitcancel", nil)
+		err := s.Cancel(ctx, v.ID)
 		if err != nil {
 			errs = append(errs, err.Error()+"(ID: "+strconv.FormatUint(v.ID, 10)+")")
 			continue
@@ -518,75 +599,16 @@ func (s *Symbol) CancelAll() error {
 }
 
 // AllIn all in
-func (s *Symbol) AllIn(cmd string, isMargin bool) error {
-	bc, qc := s.BaseCurrency, s.QuoteCurrency
-	switch cmd {
-	case "BUY": // do nothing
-	case "SELL":
-		bc, qc = qc, bc
-	default:
-		return errors.Wrap(errUnkownTradeType, util.FuncName())
-	}
-
-	err := s.CancelAll()
-	if err != nil {
-		return errors.Wrap(err, util.FuncName())
-	}
-
-t:
-	c, err := s.Carry(qc)
+func (s *Symbol) AllIn(ctx context.Context, cmd string, isMargin bool) error {
+	err := exchange.AllIn(&market{s, ctx}, cmd, isMargin)
 	if err != nil {
 		return errors.Wrap(err, util.FuncName())
 	}
-	if isMargin && c.LoanAvailable > 0 {
-		bos, err := s.BorrowOrders("accrual")
-		if err != nil {
-			return errors.Wrap(err, util.FuncName())
-		}
-		if len(bos) == 0 {
-			err = s.Borrow(qc, c.LoanAvailable)
-			if err != nil {
-				return errors.Wrap(err, util.FuncName())
-			}
-			goto t
-		}
-	}
-
-	// check trade amount limit
-	l, err := s.Limit()
-	if err != nil {
-		return errors.Wrap(err, util.FuncName())
-	}
-	if cmd == "BUY" {
-		if c.Trade < l.BuyGT {
-			return nil
-		} else if c.Trade > l.BuyLT {
-			c.Trade = l.BuyLT
-		}
-	}
-	if cmd == "SELL" {
-		if c.Trade < l.SellGT {
-			return nil
-		} else if c.Trade > l.SellLT {
-			c.Trade = l.SellLT
-		}
-	}
-
-	err = s.Trade(cmd, c.Trade)
-	if err != nil {
-		return errors.Wrap(err, util.FuncName())
-	}
-
-	err = s.Repay(bc)
-	if err != nil {
-		return errors.Wrap(err, util.FuncName())
-	}
-
 	return nil
 }
 
-func sign(content string) (string, error) {
-	h := hmac.New(sha256.New, []byte(secret))
+func (c *Client) sign(content string) (string, error) {
+	h := hmac.New(sha256.New, []byte(c.Secret))
 	_, err := h.Write([]byte(content))
 	if err != nil {
 		return "", err
@@ -595,7 +617,14 @@ func sign(content string) (string, error) {
 	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
 }
 
-func req(method, address string, params map[string]string) (map[string]interface{}, error) {
+// req send a signed request to path of the base url
+func (c *Client) req(ctx context.Context, method, path string, params map[string]string) (map[string]interface{}, error) {
+	return c.request(ctx, method, c.BaseURL+path, params, 3)
+}
+
+// request send a signed request, it is sent at most attempts times if it
+// is safe to retry
+func (c *Client) request(ctx context.Context, method, address string, params map[string]string, attempts int) (map[string]interface{}, error) {
 	u, err := url.Parse(address)
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
@@ -604,14 +633,14 @@ func req(method, address string, params map[string]string) (map[string]interface
 	path := u.EscapedPath()
 
 	compute := map[string]string{
-		"AccessKeyId":      key,
+		"AccessKeyId":      c.Key,
 		"SignatureMethod":  "HmacSHA256",
 		"SignatureVersion": "2",
-		"Timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05"),
+		"Timestamp":        c.Now().UTC().Format("2006-01-02T15:04:05"),
 	}
 
 	var ctype, signature string
-	var reader io.Reader
+	var body []byte
 	switch strings.ToUpper(method) {
 	case "GET":
 		for k, v := range params {
@@ -621,58 +650,52 @@ func req(method, address string, params map[string]string) (map[string]interface
 	default:
 		ctype = "application/json"
 
-		bs, err := json.Marshal(params)
+		body, err = json.Marshal(params)
 		if err != nil {
 			return nil, errors.Wrap(err, util.FuncName())
 		}
-		reader = bytes.NewBuffer(bs)
 	}
 
 	query := querystring(compute)
-	signature, err = sign(method + "\n" + host + "\n" + path + "\n" + query)
+	signature, err = c.sign(method + "\n" + host + "\n" + path + "\n" + query)
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
 	}
 	// huobi get parameters must be passing by querystring
 	address += "?" + query + "&Signature=" + url.QueryEscape(signature)
 
-	client := &http.Client{Timeout: time.Duration(time.Second * 3)}
-
-	req, err := http.NewRequest(method, address, reader)
-	if err != nil {
-		return nil, errors.Wrap(err, util.FuncName())
-	}
-	req.Header.Set("Content-Type", ctype)
+	return c.do(ctx, method, address, ctype, body, attempts)
+}
 
-	var retry int
-t:
-	resp, err := client.Do(req)
+// do send a request, it is sent at most attempts times if it is safe to
+// retry, see transport.Client
+func (c *Client) do(ctx context.Context, method, address, ctype string, body []byte, attempts int) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	tc := *c.transport
+	tc.HTTP, tc.Observe, tc.Attempts = c.HTTP, c.Observe, attempts
+	resp, err := tc.Do(ctx, &transport.Request{
+		Method: method,
+		URL:    address,
+		Header: http.Header{"Content-Type": {ctype}},
+		Body:   body,
+	})
 	if err != nil {
-		if err, ok := err.(net.Error); (ok && err.Timeout()) ||
-			strings.Contains(err.Error(), "connection reset by peer") {
-			if retry++; retry < 3 {
-				goto t
-			}
+		// huobi may explain the error status in the body
+		var e *Error
+		if resp != nil && errors.As(handle(resp.Body, nil), &e) {
+			return nil, errors.Wrap(e, util.FuncName())
 		}
 		return nil, errors.Wrap(err, util.FuncName())
 	}
 
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Println(err)
-		}
-	}()
-
-	bs, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, util.FuncName())
-	}
-	if err := handle(bs, err); err != nil {
+	if err := handle(resp.Body, nil); err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
 	}
 
 	m := make(map[string]interface{})
-	err = json.Unmarshal(bs, &m)
+	err = json.Unmarshal(resp.Body, &m)
 	if err != nil {
 		return nil, errors.Wrap(err, util.FuncName())
 	}
@@ -713,7 +736,7 @@ func handle(bs []byte, err error) error {
 		return errors.Wrap(err, util.FuncName())
 	}
 
-	e := huobiError{}
+	e := Error{}
 
 	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
 		WeaklyTypedInput: true,
@@ -729,9 +752,28 @@ func handle(bs []byte, err error) error {
 	}
 
 	if e.Status != "ok" {
-		err = fmt.Errorf("Code: %s, %s", e.Code, e.Message)
-		return errors.Wrap(err, util.FuncName())
+		return errors.Wrap(&e, util.FuncName())
 	}
 
 	return nil
 }
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Code: %s, %s", e.Code, e.Message)
+}
+
+// Is return whether the code of e means target
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrInsufficientBalance:
+		return e.Code == "order-accountbalance-error" ||
+			strings.HasPrefix(e.Code, "account-") && strings.HasSuffix(e.Code, "-balance-insufficient-error")
+	case ErrInvalidSignature:
+		return e.Code == "api-signature-not-valid"
+	case ErrOrderNotFound:
+		return e.Code == "order-queryorder-invalid" || e.Code == "base-record-invalid"
+	case ErrBusy:
+		return e.Code == "gateway-internal-error"
+	}
+	return false
+}
@@ -1,179 +1,408 @@
 package huobi
 
 import (
-	"fmt"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/modood/cts/fixture"
+	"github.com/modood/cts/mock"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-func TestInit(t *testing.T) {
-	Convey("should init successfully", t, func() {
-		So(key, ShouldEqual, "")
-		So(secret, ShouldEqual, "")
-		Init("apikey", "secretkey")
-		So(key, ShouldEqual, "apikey")
-		So(secret, ShouldEqual, "secretkey")
+var (
+	ctx    = context.Background()
+	client = NewClient("", "", "", nil, nil)
+)
+
+func TestNewClient(t *testing.T) {
+	Convey("should create a client of an account", t, func(c C) {
+		cl := NewClient("", "apikey", "secretkey", nil, nil)
+		c.So(cl.BaseURL, ShouldEqual, DefaultURL)
+		c.So(cl.Key, ShouldEqual, "apikey")
+		c.So(cl.Secret, ShouldEqual, "secretkey")
+		c.So(cl.Now, ShouldNotBeNil)
 	})
 }
 
+// newMock return a mock server of huobi and a client of its account, which
+// has 1000 usdt and 0.01 btc of btc_usdt
+func newMock() (*mock.Server, *Client) {
+	srv := mock.NewServer()
+	srv.AddKey("apikey", "secretkey")
+	srv.SetTicker("btc_usdt", mock.Ticker{Last: 6500, LowestAsk: 6501, HighestBid: 6499})
+	srv.SetLimit("btc_usdt", mock.Limit{BuyGT: 1, BuyLT: 100000, SellGT: 0.001, SellLT: 100})
+	srv.Deposit("apikey", "btc_usdt", "usdt", 1000)
+	srv.Deposit("apikey", "btc_usdt", "btc", 0.01)
+	return srv, NewClient(srv.URL, "apikey", "secretkey", nil, nil)
+}
+
 func TestSymbols(t *testing.T) {
-	Convey("should return all support symbol successfully", t, func() {
-		r, err := Symbols()
-		So(err, ShouldBeNil)
-		So(r, ShouldNotBeEmpty)
+	Convey("should return all support symbol successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+
+		r, err := cl.Symbols(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldNotBeEmpty)
 	})
 }
 
-func TestNewSymbol(t *testing.T) {
-	Convey("should return new symbol successfully", t, func() {
-		_, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
+func TestSymbol(t *testing.T) {
+	Convey("should return new symbol successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+
+		_, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
 
-		_, err = NewSymbol("btcusdt")
-		So(err, ShouldNotBeNil)
-		So(err.Error(), ShouldContainSubstring, errInvalidSymbol.Error())
+		_, err = cl.Symbol(ctx, "btcusdt")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, errInvalidSymbol.Error())
 
-		_, err = NewSymbol("abc_def")
-		So(err, ShouldNotBeNil)
-		So(err.Error(), ShouldContainSubstring, errUnsupportedSymbol.Error())
+		_, err = cl.Symbol(ctx, "abc_def")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, errUnsupportedSymbol.Error())
 	})
 }
 
 func TestLimit(t *testing.T) {
-	Convey("should return trade limit of symbol successfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
-
-		r, err := s.Limit()
-		So(err, ShouldBeNil)
-		So(r.BuyGT, ShouldBeGreaterThan, 0)
-		So(r.BuyLT, ShouldBeGreaterThan, 0)
-		So(r.SellGT, ShouldBeGreaterThan, 0)
-		So(r.SellLT, ShouldBeGreaterThan, 0)
+	Convey("should return trade limit of symbol successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		r, err := s.Limit(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(r.BuyGT, ShouldEqual, 1)
+		c.So(r.BuyLT, ShouldEqual, 100000)
+		c.So(r.SellGT, ShouldEqual, 0.001)
+		c.So(r.SellLT, ShouldEqual, 100)
 	})
 }
 
 func TestAccount(t *testing.T) {
-	Convey("should return margin account successfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
-
-		r, err := s.Account()
-		So(err, ShouldBeNil)
-		So(r.ID, ShouldBeGreaterThan, 0)
-		So(r.Type, ShouldEqual, "margin")
-		So(r.List, ShouldNotBeEmpty)
+	Convey("should return margin account successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		r, err := s.Account(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(r.ID, ShouldBeGreaterThan, 0)
+		c.So(r.Type, ShouldEqual, "margin")
+		c.So(r.List, ShouldNotBeEmpty)
+
+		ca, err := s.Carry(ctx, "usdt")
+		c.So(err, ShouldBeNil)
+		c.So(ca.Trade, ShouldEqual, 1000)
+		c.So(ca.LoanAvailable, ShouldBeGreaterThan, 2000)
 	})
 }
 
 func TestOrders(t *testing.T) {
-	Convey("should return finished orders successfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
-
-		_, err = s.Orders()
-		So(err, ShouldBeNil)
+	Convey("should return finished orders successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		_, err = s.Trade(ctx, "BUY", 100)
+		c.So(err, ShouldBeNil)
+
+		r, err := s.Orders(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldHaveLength, 1)
 	})
 }
 
 func TestOpenOrders(t *testing.T) {
-	Convey("should return pendding orders successfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
-
-		_, err = s.OpenOrders("")
-		So(err, ShouldBeNil)
+	Convey("should return pendding orders successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		r, err := s.OpenOrders(ctx, "")
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldBeEmpty)
 	})
 }
 
 func TestBorrowOrders(t *testing.T) {
-	Convey("should return borrow orders successfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
-
-		_, err = s.BorrowOrders("")
-		So(err, ShouldBeNil)
+	Convey("should return borrow orders successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		r, err := s.BorrowOrders(ctx, "")
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldBeEmpty)
 	})
 }
 
 func TestBorrowAvailable(t *testing.T) {
-	Convey("should return available amount successfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
-
-		_, err = s.BorrowAvailable(s.BaseCurrency)
-		So(err, ShouldBeNil)
-
-		_, err = s.BorrowAvailable(s.QuoteCurrency)
-		So(err, ShouldBeNil)
-
-		_, err = s.BorrowAvailable("unknown")
-		So(err, ShouldNotBeNil)
-		So(err.Error(), ShouldContainSubstring, errInvalidCurrency.Error())
+	Convey("should return available amount successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		b, err := s.BorrowAvailable(ctx, s.BaseCurrency)
+		c.So(err, ShouldBeNil)
+		c.So(b, ShouldBeGreaterThan, 0)
+
+		q, err := s.BorrowAvailable(ctx, s.QuoteCurrency)
+		c.So(err, ShouldBeNil)
+		c.So(q, ShouldAlmostEqual, b*6500, 0.000001)
+
+		_, err = s.BorrowAvailable(ctx, "unknown")
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, errInvalidCurrency.Error())
 	})
 }
 
 func TestBorrow(t *testing.T) {
-	Convey("should borrow successfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
-
-		amount, err := s.BorrowAvailable(s.BaseCurrency)
-		So(err, ShouldBeNil)
-		if amount != 0 {
-			fmt.Println("\n", amount)
-			err := s.Borrow(s.BaseCurrency, 0.001)
-			So(err, ShouldBeNil)
-		}
+	Convey("should borrow successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		err = s.Borrow(ctx, s.BaseCurrency, 0.001)
+		c.So(err, ShouldBeNil)
+		c.So(srv.Debt("apikey", "btc_usdt", "btc"), ShouldEqual, 0.001)
+
+		err = s.Borrow(ctx, s.QuoteCurrency, 1000000)
+		c.So(err, ShouldNotBeNil)
 	})
 }
 
 func TestRepay(t *testing.T) {
-	Convey("should repay all debt successfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
-
-		err = s.Repay("btc")
-		So(err, ShouldBeNil)
+	Convey("should repay all debt successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		c.So(s.Borrow(ctx, "btc", 0.001), ShouldBeNil)
+		c.So(s.Borrow(ctx, "btc", 0.002), ShouldBeNil)
+		c.So(s.RepayUpTo(ctx, "btc", 0.002), ShouldBeNil)
+		c.So(srv.Debt("apikey", "btc_usdt", "btc"), ShouldAlmostEqual, 0.001)
+
+		err = s.Repay(ctx, "btc")
+		c.So(err, ShouldBeNil)
+		c.So(srv.Debt("apikey", "btc_usdt", "btc"), ShouldEqual, 0)
+		c.So(srv.Balance("apikey", "btc_usdt", "btc"), ShouldAlmostEqual, 0.01)
 	})
 }
 
 func TestTrade(t *testing.T) {
-	Convey("should trade unsuccessfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
-
-		err = s.Trade("FUCK", 1)
-		So(err, ShouldNotBeNil)
-
-		err = s.Trade("TESTBUY", 1)
-		So(err, ShouldBeNil)
-
-		err = s.Trade("TESTSELL", 0.001)
-		So(err, ShouldBeNil)
+	Convey("should trade unsuccessfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		cl.TradeTimeout = 0
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		_, err = s.Trade(ctx, "FUCK", 1)
+		c.So(err, ShouldNotBeNil)
+
+		// limit orders of the mock are never filled
+		f, err := s.Trade(ctx, "TESTBUY", 1)
+		c.So(err, ShouldBeNil)
+		c.So(f.State, ShouldEqual, "canceled")
+
+		f, err = s.Trade(ctx, "TESTSELL", 0.001)
+		c.So(err, ShouldBeNil)
+		c.So(f.State, ShouldEqual, "canceled")
+		c.So(srv.Balance("apikey", "btc_usdt", "usdt"), ShouldEqual, 1000)
+		c.So(srv.Balance("apikey", "btc_usdt", "btc"), ShouldAlmostEqual, 0.01)
 	})
 }
 
 func TestCancelAll(t *testing.T) {
-	Convey("should cancel all open orders successfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
-
-		err = s.CancelAll()
-		So(err, ShouldBeNil)
+	Convey("should cancel all open orders successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		a, err := s.Account(ctx)
+		c.So(err, ShouldBeNil)
+		_, err = cl.place(ctx, map[string]string{
+			"account-id": strconv.FormatUint(a.ID, 10),
+			"symbol":     "btcusdt",
+			"type":       "buy-limit",
+			"price":      "1",
+			"amount":     "10",
+		})
+		c.So(err, ShouldBeNil)
+		c.So(srv.Balance("apikey", "btc_usdt", "usdt"), ShouldEqual, 990)
+
+		err = s.CancelAll(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(srv.Balance("apikey", "btc_usdt", "usdt"), ShouldEqual, 1000)
+		oos, err := s.OpenOrders(ctx, "")
+		c.So(err, ShouldBeNil)
+		c.So(oos, ShouldBeEmpty)
 	})
 }
 
 func TestAllIn(t *testing.T) {
-	Convey("should cancel all open orders successfully", t, func() {
-		s, err := NewSymbol("btc_usdt")
-		So(err, ShouldBeNil)
+	Convey("should cancel all open orders successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		err = s.AllIn(ctx, "BUY", true)
+		c.So(err, ShouldBeNil)
+		c.So(srv.Balance("apikey", "btc_usdt", "usdt"), ShouldBeLessThan, 1)
+		c.So(srv.Debt("apikey", "btc_usdt", "usdt"), ShouldBeGreaterThan, 0)
+
+		err = s.AllIn(ctx, "SELL", true)
+		c.So(err, ShouldBeNil)
+		c.So(srv.Balance("apikey", "btc_usdt", "btc"), ShouldBeLessThan, 0.001)
+		c.So(srv.Debt("apikey", "btc_usdt", "usdt"), ShouldEqual, 0)
+	})
+}
+
+func TestFixtures(t *testing.T) {
+	Convey("should decode payloads recorded from huobi", t, func(c C) {
+		// keys are needed only to record, see fixture.EnvRecord
+		key, secret := os.Getenv("CTS_HUOBI_KEY"), os.Getenv("CTS_HUOBI_SECRET")
+		util.AddSecret(key, secret)
+		cl := NewClient("", key, secret, fixture.Client("testdata/fixtures"), nil)
+
+		ss, err := cl.Symbols(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(ss, ShouldNotBeEmpty)
+		for _, v := range ss {
+			c.So(v.BaseCurrency, ShouldNotBeBlank)
+			c.So(v.QuoteCurrency, ShouldNotBeBlank)
+			c.So(v.AmountPrecision, ShouldBeGreaterThan, 0)
+			c.So(v.PricePrecision, ShouldBeGreaterThan, 0)
+			c.So(v.SymbolPartition, ShouldNotBeBlank)
+		}
 
-		err = s.AllIn("BUY", true)
-		So(err, ShouldBeNil)
+		s, err := cl.Symbol(ctx, "btc_usdt")
+		c.So(err, ShouldBeNil)
+
+		l, err := s.Limit(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(l.BuyGT, ShouldBeGreaterThan, 0)
+		c.So(l.BuyLT, ShouldBeGreaterThan, l.BuyGT)
+		c.So(l.SellGT, ShouldBeGreaterThan, 0)
+		c.So(l.SellLT, ShouldBeGreaterThan, l.SellGT)
+
+		a, err := s.Account(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(a.ID, ShouldBeGreaterThan, 0)
+		c.So(a.Type, ShouldEqual, "margin")
+		c.So(a.State, ShouldNotBeBlank)
+		c.So(a.Symbol, ShouldEqual, "btcusdt")
+		c.So(a.FlType, ShouldNotBeBlank)
+		c.So(a.RiskRate, ShouldBeGreaterThan, 0)
+		types := map[string]bool{}
+		for _, v := range a.List {
+			c.So(v.Currency, ShouldBeIn, "btc", "usdt")
+			types[v.Type] = true
+		}
+		for _, v := range []string{"trade", "frozen", "loan", "interest", "transfer-out-available", "loan-available"} {
+			c.So(types[v], ShouldBeTrue)
+		}
+		ca, err := s.Carry(ctx, "usdt")
+		c.So(err, ShouldBeNil)
+		c.So(ca.Trade, ShouldBeGreaterThan, 0)
+		c.So(ca.LoanAvailable, ShouldBeGreaterThan, 0)
+
+		bos, err := s.BorrowOrders(ctx, "")
+		c.So(err, ShouldBeNil)
+		c.So(bos, ShouldNotBeEmpty)
+		for _, v := range bos {
+			c.So(v.ID, ShouldBeGreaterThan, 0)
+			c.So(v.UserID, ShouldBeGreaterThan, 0)
+			c.So(v.AccountID, ShouldEqual, a.ID)
+			c.So(v.Symbol, ShouldEqual, "btcusdt")
+			c.So(v.Currency, ShouldNotBeBlank)
+			c.So(v.State, ShouldNotBeBlank)
+			c.So(v.LoanAmount, ShouldBeGreaterThan, 0)
+			c.So(v.InterestRate, ShouldBeGreaterThan, 0)
+			c.So(v.CreatedAt, ShouldBeGreaterThan, 0)
+			c.So(v.AccruedAt, ShouldBeGreaterThan, 0)
+			c.So(v.UpdatedAt, ShouldBeGreaterThan, 0)
+		}
+	})
+}
+
+func TestError(t *testing.T) {
+	Convey("should return typed errors of huobi", t, func(c C) {
+		status := http.StatusOK
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"status":"error","err-code":"account-frozen-balance-insufficient-error","err-msg":"insufficient"}`))
+		}))
+		defer srv.Close()
+
+		_, err := client.do(ctx, "POST", srv.URL, "application/json", []byte("{}"), 1)
+		c.So(errors.Is(err, ErrInsufficientBalance), ShouldBeTrue)
+		c.So(errors.Is(err, ErrOrderNotFound), ShouldBeFalse)
+		var e *Error
+		c.So(errors.As(err, &e), ShouldBeTrue)
+		c.So(e.Code, ShouldEqual, "account-frozen-balance-insufficient-error")
+		c.So(err.Error(), ShouldContainSubstring, "Code: account-frozen-balance-insufficient-error, insufficient")
+
+		// explained by the body of an error status
+		status = http.StatusBadRequest
+		_, err = client.do(ctx, "GET", srv.URL, "application/json", nil, 1)
+		c.So(errors.Is(err, ErrInsufficientBalance), ShouldBeTrue)
+
+		c.So(errors.Is(&Error{Code: "api-signature-not-valid"}, ErrInvalidSignature), ShouldBeTrue)
+		c.So(errors.Is(&Error{Code: "base-record-invalid"}, ErrOrderNotFound), ShouldBeTrue)
+		c.So(errors.Is(&Error{Code: "gateway-internal-error"}, ErrBusy), ShouldBeTrue)
+	})
+}
 
-		err = s.AllIn("SELL", true)
-		So(err, ShouldBeNil)
+func TestClient(t *testing.T) {
+	Convey("should sign requests of every account by its clock", t, func(c C) {
+		var queries []url.Values
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			queries = append(queries, r.URL.Query())
+			w.Write([]byte(`{"status":"ok","data":[{"base-currency":"doge","quote-currency":"usdt","amount-precision":2}]}`))
+		}))
+		defer srv.Close()
+
+		now := func() time.Time { return time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC) }
+		a := NewClient(srv.URL, "key-a", "secret-a", srv.Client(), now)
+		b := NewClient(srv.URL, "key-b", "secret-b", srv.Client(), now)
+
+		s, err := a.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(s.Name, ShouldEqual, "dogeusdt")
+		_, err = b.Symbols(ctx)
+		c.So(err, ShouldBeNil)
+
+		c.So(queries, ShouldHaveLength, 2)
+		c.So(queries[0].Get("AccessKeyId"), ShouldEqual, "key-a")
+		c.So(queries[1].Get("AccessKeyId"), ShouldEqual, "key-b")
+		c.So(queries[0].Get("Timestamp"), ShouldEqual, "2018-03-01T08:00:00")
+		c.So(queries[0].Get("Signature"), ShouldNotEqual, queries[1].Get("Signature"))
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = s.Account(canceled)
+		c.So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		c.So(queries, ShouldHaveLength, 2)
 	})
 }
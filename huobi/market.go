@@ -0,0 +1,287 @@
+package huobi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/modood/cts/indicator"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// Kline periods
+const (
+	Period1Min  = "1min"
+	Period5Min  = "5min"
+	Period15Min = "15min"
+	Period30Min = "30min"
+	Period60Min = "60min"
+	Period1Day  = "1day"
+	Period1Week = "1week"
+	Period1Mon  = "1mon"
+	Period1Year = "1year"
+)
+
+// Depth steps, step0 means no aggregation
+const (
+	Step0 = "step0"
+	Step1 = "step1"
+	Step2 = "step2"
+	Step3 = "step3"
+	Step4 = "step4"
+	Step5 = "step5"
+)
+
+type (
+	// Kline ...
+	Kline struct {
+		ID     int64   // start time in seconds
+		Open   float64 // 开盘价
+		Close  float64 // 收盘价
+		Low    float64 // 最低价
+		High   float64 // 最高价
+		Amount float64 // 成交量(基础货币)
+		Vol    float64 // 成交额(计价货币)
+		Count  int64   // 成交笔数
+	}
+
+	// Level is a price level of depth
+	Level struct {
+		Price  float64
+		Amount float64
+	}
+
+	// Depth ...
+	Depth struct {
+		Ts      uint64
+		Version uint64
+		Bids    []Level // highest first
+		Asks    []Level // lowest first
+	}
+
+	// Merged is the aggregated ticker in the last 24 hours
+	Merged struct {
+		ID     uint64
+		Ts     uint64
+		Open   float64
+		Close  float64 // 最新价
+		Low    float64
+		High   float64
+		Amount float64
+		Vol    float64
+		Count  int64
+		Bid    Level // 买一
+		Ask    Level // 卖一
+	}
+
+	// MarketTrade is a trade of the market
+	MarketTrade struct {
+		ID        uint64
+		Ts        uint64
+		Price     float64
+		Amount    float64
+		Direction string // buy or sell
+	}
+)
+
+var (
+	errInvalidPeriod = errors.New("invalid kline period")
+	errInvalidStep   = errors.New("invalid depth step")
+	errInvalidSize   = errors.New("invalid size, it should be 1-2000")
+)
+
+// Klines return latest klines of a period, newest first
+func (s *Symbol) Klines(ctx context.Context, period string, size int) ([]Kline, error) {
+	switch period {
+	case Period1Min, Period5Min, Period15Min, Period30Min, Period60Min,
+		Period1Day, Period1Week, Period1Mon, Period1Year:
+	default:
+		return nil, errors.Wrap(errInvalidPeriod, util.FuncName())
+	}
+	if size < 1 || size > 2000 {
+		return nil, errors.Wrap(errInvalidSize, util.FuncName())
+	}
+
+	m, err := s.c.get(ctx, "/market/history/kline",
+		map[string]string{
+			"symbol": s.Name,
+			"period": period,
+			"size":   strconv.Itoa(size),
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	r := struct{ Data []Kline }{}
+	if err = util.Decode(m, &r); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	return r.Data, nil
+}
+
+// Candles return latest klines of a period as candles, oldest first
+func (s *Symbol) Candles(ctx context.Context, period string, size int) ([]indicator.Candle, error) {
+	ks, err := s.Klines(ctx, period, size)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	r := make([]indicator.Candle, len(ks))
+	for i, v := range ks {
+		r[len(ks)-1-i] = v.Candle()
+	}
+	return r, nil
+}
+
+// Candle convert kline to candle
+func (k Kline) Candle() indicator.Candle {
+	return indicator.Candle{
+		Time:   time.Unix(k.ID, 0),
+		Open:   k.Open,
+		High:   k.High,
+		Low:    k.Low,
+		Close:  k.Close,
+		Volume: k.Amount,
+	}
+}
+
+// Depth return order book aggregated by step
+func (s *Symbol) Depth(ctx context.Context, step string) (*Depth, error) {
+	switch step {
+	case Step0, Step1, Step2, Step3, Step4, Step5:
+	default:
+		return nil, errors.Wrap(errInvalidStep, util.FuncName())
+	}
+
+	m, err := s.c.get(ctx, "/market/depth",
+		map[string]string{
+			"symbol": s.Name,
+			"type":   step,
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	r := struct {
+		Tick struct {
+			Ts      uint64
+			Version uint64
+			Bids    [][]float64
+			Asks    [][]float64
+		}
+	}{}
+	if err = util.Decode(m, &r); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	d := Depth{Ts: r.Tick.Ts, Version: r.Tick.Version}
+	if d.Bids, err = levels(r.Tick.Bids); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	if d.Asks, err = levels(r.Tick.Asks); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return &d, nil
+}
+
+// Merged return aggregated ticker
+func (s *Symbol) Merged(ctx context.Context) (*Merged, error) {
+	m, err := s.c.get(ctx, "/market/detail/merged",
+		map[string]string{"symbol": s.Name})
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	r := struct {
+		Ts   uint64
+		Tick struct {
+			ID     uint64
+			Open   float64
+			Close  float64
+			Low    float64
+			High   float64
+			Amount float64
+			Vol    float64
+			Count  int64
+			Bid    []float64
+			Ask    []float64
+		}
+	}{}
+	if err = util.Decode(m, &r); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	t := r.Tick
+	d := Merged{
+		ID:     t.ID,
+		Ts:     r.Ts,
+		Open:   t.Open,
+		Close:  t.Close,
+		Low:    t.Low,
+		High:   t.High,
+		Amount: t.Amount,
+		Vol:    t.Vol,
+		Count:  t.Count,
+	}
+	ls, err := levels([][]float64{t.Bid, t.Ask})
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	d.Bid, d.Ask = ls[0], ls[1]
+	return &d, nil
+}
+
+// Trades return latest trades of the market, newest first
+func (s *Symbol) Trades(ctx context.Context, size int) ([]MarketTrade, error) {
+	if size < 1 || size > 2000 {
+		return nil, errors.Wrap(errInvalidSize, util.FuncName())
+	}
+
+	m, err := s.c.get(ctx, "/market/history/trade",
+		map[string]string{
+			"symbol": s.Name,
+			"size":   strconv.Itoa(size),
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	// trades are grouped by match
+	r := struct {
+		Data []struct{ Data []MarketTrade }
+	}{}
+	if err = util.Decode(m, &r); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	var ts []MarketTrade
+	for _, v := range r.Data {
+		ts = append(ts, v.Data...)
+	}
+	return ts, nil
+}
+
+func levels(l [][]float64) ([]Level, error) {
+	r := make([]Level, 0, len(l))
+	for _, v := range l {
+		if len(v) != 2 {
+			err := fmt.Errorf("invalid price level: %v", v)
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		r = append(r, Level{Price: v[0], Amount: v[1]})
+	}
+	return r, nil
+}
+
+// get request public market data of path, which needs no signature
+func (c *Client) get(ctx context.Context, path string, params map[string]string) (map[string]interface{}, error) {
+	m, err := c.do(ctx, "GET", c.BaseURL+path+"?"+querystring(params),
+		"application/x-www-form-urlencoded", nil, 3)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return m, nil
+}
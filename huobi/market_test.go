@@ -0,0 +1,88 @@
+package huobi
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKlines(t *testing.T) {
+	Convey("should return klines successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s := &Symbol{c: cl, Name: "btcusdt", BaseCurrency: "btc", QuoteCurrency: "usdt"}
+
+		_, err := s.Klines(ctx, "2min", 10)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, errInvalidPeriod.Error())
+
+		_, err = s.Klines(ctx, Period1Min, 2001)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, errInvalidSize.Error())
+
+		r, err := s.Candles(ctx, Period1Min, 10)
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldHaveLength, 10)
+		c.So(r[0].Time.Before(r[9].Time), ShouldBeTrue)
+	})
+}
+
+func TestDepth(t *testing.T) {
+	Convey("should return depth successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s := &Symbol{c: cl, Name: "btcusdt", BaseCurrency: "btc", QuoteCurrency: "usdt"}
+
+		_, err := s.Depth(ctx, "step9")
+		c.So(err, ShouldNotBeNil)
+
+		r, err := s.Depth(ctx, Step0)
+		c.So(err, ShouldBeNil)
+		c.So(r.Bids, ShouldNotBeEmpty)
+		c.So(r.Asks, ShouldNotBeEmpty)
+		c.So(r.Bids[0].Price, ShouldBeLessThan, r.Asks[0].Price)
+	})
+}
+
+func TestMerged(t *testing.T) {
+	Convey("should return merged ticker successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s := &Symbol{c: cl, Name: "btcusdt", BaseCurrency: "btc", QuoteCurrency: "usdt"}
+
+		r, err := s.Merged(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(r.Close, ShouldBeGreaterThan, 0)
+		c.So(r.Bid.Price, ShouldBeLessThan, r.Ask.Price)
+	})
+}
+
+func TestTrades(t *testing.T) {
+	Convey("should return market trades successfully", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		s := &Symbol{c: cl, Name: "btcusdt", BaseCurrency: "btc", QuoteCurrency: "usdt"}
+
+		_, err := s.Trades(ctx, 0)
+		c.So(err, ShouldNotBeNil)
+
+		r, err := s.Trades(ctx, 5)
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldNotBeEmpty)
+	})
+}
+
+func TestLevels(t *testing.T) {
+	Convey("should convert price levels", t, func(c C) {
+		r, err := levels([][]float64{{1.5, 2}, {1.4, 3}})
+		c.So(err, ShouldBeNil)
+		c.So(r, ShouldResemble, []Level{{1.5, 2}, {1.4, 3}})
+
+		_, err = levels([][]float64{{1.5}})
+		c.So(err, ShouldNotBeNil)
+
+		k := Kline{ID: 1519862400, Open: 1, Close: 2, Low: 0.5, High: 3, Amount: 10}
+		c.So(k.Candle().Volume, ShouldEqual, 10)
+		c.So(k.Candle().Time.Unix(), ShouldEqual, 1519862400)
+	})
+}
@@ -0,0 +1,300 @@
+package huobi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/modood/cts/transport"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Fill is the final result of an order
+	Fill struct {
+		OrderID          uint64
+		Type             string
+		State            string
+		Amount           float64 // quote currency for buy-market, otherwise base currency
+		FilledAmount     float64 // base currency
+		FilledCashAmount float64 // quote currency
+		Fees             float64 // in the received currency
+		Price            float64 // average price
+	}
+
+	// pendingOrder is an order which has been sent but not confirmed
+	pendingOrder struct {
+		ClientOrderID string            `json:"client-order-id"`
+		Params        map[string]string `json:"params"`
+		CreatedAt     time.Time         `json:"created-at"`
+	}
+)
+
+var (
+	trackInterval = time.Second
+	errUnfilled   = errors.New("order is neither filled nor canceled")
+
+	// client order id can be queried in 24 hours
+	pendingTTL = time.Hour * 24
+)
+
+// SetPendingFile set the file where unconfirmed orders are saved, and load
+// orders which were unconfirmed before last exit
+func (c *Client) SetPendingFile(name string) error {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	c.pendingFile = name
+	c.pending = map[string]pendingOrder{}
+	if name == "" {
+		return nil
+	}
+
+	bs, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if len(bs) == 0 {
+		return nil
+	}
+	if err = json.Unmarshal(bs, &c.pending); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// Track poll an order until it is filled or canceled, the leftover is
+// canceled if it is not filled before timeout. the returned fill is not nil
+// as long as the order has been found, even if an error is returned.
+func (s *Symbol) Track(ctx context.Context, ID uint64, timeout time.Duration) (*Fill, error) {
+	var o *OpenOrder
+	var err error
+
+	deadline := s.c.Now().Add(timeout)
+loop:
+	for canceled := false; ; {
+		var d *OpenOrder
+		if d, err = s.c.OrderDetail(ctx, ID); err == nil {
+			o = d
+			if final(o.State) {
+				return fill(o), nil
+			}
+		}
+
+		if s.c.Now().After(deadline) {
+			if canceled {
+				break
+			}
+			if err := s.Cancel(ctx, ID); err != nil {
+				// it may be filled just now
+				log.Println(err)
+			}
+			canceled = true
+			deadline = s.c.Now().Add(trackInterval * 10)
+			continue
+		}
+
+		t := time.NewTimer(trackInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			err = ctx.Err()
+			break loop
+		case <-t.C:
+		}
+	}
+
+	if o == nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	e := fmt.Errorf("%v: %d(%s)", errUnfilled, o.ID, o.State)
+	if ctx.Err() != nil {
+		e = fmt.Errorf("%v, %v", e, ctx.Err())
+	}
+	return fill(o), errors.Wrap(e, util.FuncName())
+}
+
+// final return whether an order will never change
+func final(state string) bool {
+	switch state {
+	case "filled", "canceled", "partial-canceled":
+		return true
+	}
+	return false
+}
+
+func fill(o *OpenOrder) *Fill {
+	f := Fill{
+		OrderID:          o.ID,
+		Type:             o.Type,
+		State:            o.State,
+		Amount:           o.Amount,
+		FilledAmount:     o.FieldAmount,
+		FilledCashAmount: o.FieldCashAmount,
+		Fees:             o.FieldFees,
+	}
+	if o.FieldAmount > 0 {
+		f.Price = o.FieldCashAmount / o.FieldAmount
+	}
+	return &f
+}
+
+// ClientOrder return order detail by client order id
+func (c *Client) ClientOrder(ctx context.Context, clientOrderID string) (*OpenOrder, error) {
+	m, err := c.req(ctx, "GET", "/v1/order/orders/getClientOrder",
+		map[string]string{"clientOrderId": clientOrderID})
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	r := struct{ Data OpenOrder }{}
+	if err = util.Decode(m, &r); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	return &r.Data, nil
+}
+
+// place place an order at most once. every order carries a client order id,
+// the order is looked up by the id instead of sending again if the previous
+// request was timeout or reset, or the process was restarted.
+func (c *Client) place(ctx context.Context, params map[string]string) (uint64, error) {
+	symbol := params["symbol"]
+
+	p, ok := c.loadPending(symbol)
+	if ok && (!samePlace(p.Params, params) || c.Now().Sub(p.CreatedAt) > pendingTTL) {
+		// it is another order now, the old one can never be resent
+		if err := c.savePending(symbol, nil); err != nil {
+			return 0, errors.Wrap(err, util.FuncName())
+		}
+		ok = false
+	}
+	if !ok {
+		p = pendingOrder{
+			ClientOrderID: clientOrderID(),
+			Params:        params,
+			CreatedAt:     c.Now(),
+		}
+		if err := c.savePending(symbol, &p); err != nil {
+			return 0, errors.Wrap(err, util.FuncName())
+		}
+	} else {
+		log.Println("huobi: unconfirmed order found, client-order-id:", p.ClientOrderID)
+	}
+
+	body := make(map[string]string, len(params)+1)
+	for k, v := range params {
+		body[k] = v
+	}
+	body["client-order-id"] = p.ClientOrderID
+
+	for retry := 0; ; retry++ {
+		// the order may have been placed by the previous request or process
+		if ok || retry > 0 {
+			o, err := c.ClientOrder(ctx, p.ClientOrderID)
+			if err == nil {
+				if err = c.savePending(symbol, nil); err != nil {
+					log.Println(err)
+				}
+				return o.ID, nil
+			}
+			if !errors.Is(err, ErrOrderNotFound) {
+				// unknown yet, e.g., timeout or 5xx, keep it pending
+				return 0, errors.Wrap(err, util.FuncName())
+			}
+		}
+
+		m, err := c.request(ctx, "POST", c.BaseURL+"/v1/order/orders/place", body, 1)
+		if err != nil {
+			if transport.IsNetError(err) && retry < 2 {
+				continue
+			}
+			var e *Error
+			if errors.As(err, &e) && !errors.Is(e, ErrBusy) {
+				// rejected by huobi, it is never placed. otherwise it may
+				// have been, e.g., cancelled, 5xx or an undecodable response,
+				// and it is kept pending to be looked up
+				if e := c.savePending(symbol, nil); e != nil {
+					log.Println(e)
+				}
+			}
+			return 0, errors.Wrap(err, util.FuncName())
+		}
+
+		r := struct{ Data uint64 }{}
+		if err := util.Decode(m, &r); err != nil {
+			return 0, errors.Wrap(err, util.FuncName())
+		}
+
+		if err = c.savePending(symbol, nil); err != nil {
+			log.Println(err)
+		}
+		return r.Data, nil
+	}
+}
+
+// clientOrderID return a unique id, e.g., cts1j8ygq2nmbf7f1a2b3c4
+func clientOrderID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		log.Println(err)
+	}
+	return "cts" + strconv.FormatInt(time.Now().UnixNano(), 36) + hex.EncodeToString(b)
+}
+
+func samePlace(a, b map[string]string) bool {
+	for _, k := range []string{"account-id", "symbol", "type", "amount", "price"} {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) loadPending(symbol string) (pendingOrder, bool) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	p, ok := c.pending[symbol]
+	return p, ok
+}
+
+// savePending save or delete(if p is nil) the pending order of symbol
+func (c *Client) savePending(symbol string, p *pendingOrder) error {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if p == nil {
+		delete(c.pending, symbol)
+	} else {
+		c.pending[symbol] = *p
+	}
+	if c.pendingFile == "" {
+		return nil
+	}
+
+	bs, err := json.Marshal(c.pending)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	// write a temporary file and rename, so that the file is never broken
+	tmp := c.pendingFile + ".tmp"
+	if err = ioutil.WriteFile(tmp, bs, 0600); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if err = os.Rename(tmp, c.pendingFile); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package huobi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/mock"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClientOrderID(t *testing.T) {
+	Convey("should generate unique client order id", t, func(c C) {
+		m := map[string]bool{}
+		for i := 0; i < 100; i++ {
+			id := clientOrderID()
+			c.So(len(id), ShouldBeLessThanOrEqualTo, 64)
+			c.So(m[id], ShouldBeFalse)
+			m[id] = true
+		}
+	})
+}
+
+func TestPendingFile(t *testing.T) {
+	Convey("should keep unconfirmed orders across restarts", t, func(c C) {
+		dir, err := ioutil.TempDir("", "huobi")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "pending.json")
+
+		cl := NewClient("", "", "", nil, nil)
+		c.So(cl.SetPendingFile(name), ShouldBeNil)
+		p := pendingOrder{
+			ClientOrderID: clientOrderID(),
+			Params:        map[string]string{"symbol": "btcusdt", "type": "buy-market", "amount": "10"},
+			CreatedAt:     time.Now(),
+		}
+		c.So(cl.savePending("btcusdt", &p), ShouldBeNil)
+
+		// restart
+		c.So(cl.SetPendingFile(name), ShouldBeNil)
+		r, ok := cl.loadPending("btcusdt")
+		c.So(ok, ShouldBeTrue)
+		c.So(r.ClientOrderID, ShouldEqual, p.ClientOrderID)
+		c.So(samePlace(r.Params, p.Params), ShouldBeTrue)
+		c.So(samePlace(r.Params, map[string]string{"symbol": "btcusdt", "type": "buy-market", "amount": "9"}), ShouldBeFalse)
+
+		c.So(cl.savePending("btcusdt", nil), ShouldBeNil)
+		c.So(cl.SetPendingFile(name), ShouldBeNil)
+		_, ok = cl.loadPending("btcusdt")
+		c.So(ok, ShouldBeFalse)
+
+		c.So(cl.SetPendingFile(""), ShouldBeNil)
+	})
+}
+
+func TestPlace(t *testing.T) {
+	Convey("should never place again if the order is unknown", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		cl.HTTP = &http.Client{Timeout: time.Millisecond * 100}
+		a, err := (&Symbol{c: cl, Name: "btcusdt"}).Account(ctx)
+		c.So(err, ShouldBeNil)
+
+		// the response is lost, and huobi fails to look it up
+		srv.Inject("/v1/order/orders/place", mock.Fault{Delay: time.Millisecond * 300, Times: 1})
+		srv.Inject("/v1/order/orders/getClientOrder", mock.Fault{
+			Status: http.StatusBadGateway,
+			Body:   "bad gateway",
+			Times:  3, // every attempt of a lookup
+		})
+		params := map[string]string{
+			"account-id": strconv.FormatUint(a.ID, 10),
+			"symbol":     "btcusdt",
+			"type":       "buy-market",
+			"amount":     "100",
+		}
+		_, err = cl.place(ctx, params)
+		c.So(err, ShouldNotBeNil)
+		c.So(srv.Requests("/v1/order/orders/place"), ShouldEqual, 1)
+		c.So(srv.Requests("/v1/order/orders/getClientOrder"), ShouldEqual, 3)
+		c.So(srv.Orders("apikey"), ShouldHaveLength, 1)
+		_, ok := cl.loadPending("btcusdt")
+		c.So(ok, ShouldBeTrue)
+
+		// gateway is busy
+		srv.Inject("/v1/order/orders/getClientOrder", mock.Fault{
+			Status: http.StatusOK,
+			Body:   `{"status":"error","err-code":"gateway-internal-error","err-msg":"busy"}`,
+			Times:  1,
+		})
+		_, err = cl.place(ctx, params)
+		c.So(errors.Is(err, ErrBusy), ShouldBeTrue)
+		c.So(srv.Requests("/v1/order/orders/place"), ShouldEqual, 1)
+
+		// found at last
+		id, err := cl.place(ctx, params)
+		c.So(err, ShouldBeNil)
+		c.So(id, ShouldEqual, srv.Orders("apikey")[0].ID)
+		c.So(srv.Requests("/v1/order/orders/place"), ShouldEqual, 1)
+		_, ok = cl.loadPending("btcusdt")
+		c.So(ok, ShouldBeFalse)
+	})
+
+	Convey("should keep the order pending if it may have been placed", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		a, err := (&Symbol{c: cl, Name: "btcusdt"}).Account(ctx)
+		c.So(err, ShouldBeNil)
+		params := map[string]string{
+			"account-id": strconv.FormatUint(a.ID, 10),
+			"symbol":     "btcusdt",
+			"type":       "buy-market",
+			"amount":     "100",
+		}
+
+		// cancelled after huobi has placed it
+		srv.Inject("/v1/order/orders/place", mock.Fault{Delay: time.Hour, Times: 1})
+		cctx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(time.Millisecond*100, cancel)
+		_, err = cl.place(cctx, params)
+		c.So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		_, ok := cl.loadPending("btcusdt")
+		c.So(ok, ShouldBeTrue)
+
+		id, err := cl.place(ctx, params)
+		c.So(err, ShouldBeNil)
+		c.So(id, ShouldEqual, srv.Orders("apikey")[0].ID)
+		c.So(srv.Requests("/v1/order/orders/place"), ShouldEqual, 1)
+
+		// 5xx and an undecodable response
+		for _, f := range []mock.Fault{
+			{Status: http.StatusInternalServerError, Body: "internal error", Times: 1},
+			{Status: http.StatusOK, Body: "<html>", Times: 1},
+		} {
+			srv.Inject("/v1/order/orders/place", f)
+			_, err = cl.place(ctx, params)
+			c.So(err, ShouldNotBeNil)
+			_, ok = cl.loadPending("btcusdt")
+			c.So(ok, ShouldBeTrue)
+		}
+	})
+
+	Convey("should forget the order rejected by huobi", t, func(c C) {
+		srv, cl := newMock()
+		defer srv.Close()
+		a, err := (&Symbol{c: cl, Name: "btcusdt"}).Account(ctx)
+		c.So(err, ShouldBeNil)
+
+		srv.Inject("/v1/order/orders/place", mock.Fault{
+			Status: http.StatusOK,
+			Body:   `{"status":"error","err-code":"order-accountbalance-error","err-msg":"insufficient"}`,
+			Times:  1,
+		})
+		_, err = cl.place(ctx, map[string]string{
+			"account-id": strconv.FormatUint(a.ID, 10),
+			"symbol":     "btcusdt",
+			"type":       "buy-market",
+			"amount":     "100",
+		})
+		c.So(errors.Is(err, ErrInsufficientBalance), ShouldBeTrue)
+		_, ok := cl.loadPending("btcusdt")
+		c.So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,420 @@
+package indicator
+
+import (
+	"math"
+	"time"
+)
+
+type (
+	// Candle is a bar of prices in a period
+	Candle struct {
+		Time   time.Time
+		Open   float64
+		High   float64
+		Low    float64
+		Close  float64
+		Volume float64 // base currency volume
+	}
+
+	// SMA is simple moving average
+	SMA struct {
+		period int
+		window []float64
+		pos    int
+		sum    float64
+		value  float64
+	}
+
+	// EMA is exponential moving average, it is seeded by the SMA of the
+	// first period values
+	EMA struct {
+		alpha float64
+		sma   *SMA
+		value float64
+		ready bool
+	}
+
+	// RSI is relative strength index with Wilder's smoothing
+	RSI struct {
+		period int
+		prev   float64
+		count  int
+		gain   float64
+		loss   float64
+		value  float64
+	}
+
+	// MACD is moving average convergence divergence
+	MACD struct {
+		fast   *EMA
+		slow   *EMA
+		signal *EMA
+
+		MACD      float64
+		Signal    float64
+		Histogram float64
+	}
+
+	// Bollinger is bollinger bands
+	Bollinger struct {
+		k     float64
+		sma   *SMA
+		count int
+
+		Upper  float64
+		Middle float64
+		Lower  float64
+	}
+
+	// ATR is average true range with Wilder's smoothing
+	ATR struct {
+		period int
+		prev   float64 // previous close
+		count  int
+		value  float64
+	}
+
+	// VWAP is volume weighted average price since last reset
+	VWAP struct {
+		pv     float64
+		volume float64
+		value  float64
+	}
+)
+
+// NewSMA return a simple moving average of period
+func NewSMA(period int) *SMA {
+	if period < 1 {
+		period = 1
+	}
+	return &SMA{period: period, window: make([]float64, 0, period)}
+}
+
+// Update add a value and return current average
+func (s *SMA) Update(v float64) float64 {
+	if len(s.window) < s.period {
+		s.window = append(s.window, v)
+	} else {
+		s.sum -= s.window[s.pos]
+		s.window[s.pos] = v
+		s.pos = (s.pos + 1) % s.period
+	}
+	s.sum += v
+	s.value = s.sum / float64(len(s.window))
+	return s.Value()
+}
+
+// Ready return whether there are period values
+func (s *SMA) Ready() bool { return len(s.window) == s.period }
+
+// Value return current average, NaN if not ready
+func (s *SMA) Value() float64 {
+	if !s.Ready() {
+		return math.NaN()
+	}
+	return s.value
+}
+
+// NewEMA return an exponential moving average of period
+func NewEMA(period int) *EMA {
+	if period < 1 {
+		period = 1
+	}
+	return &EMA{alpha: 2 / float64(period+1), sma: NewSMA(period)}
+}
+
+// Update add a value and return current average
+func (e *EMA) Update(v float64) float64 {
+	if e.ready {
+		e.value += e.alpha * (v - e.value)
+		return e.value
+	}
+
+	e.sma.Update(v)
+	if e.sma.Ready() {
+		e.value, e.ready = e.sma.Value(), true
+	}
+	return e.Value()
+}
+
+// Ready return whether there are period values
+func (e *EMA) Ready() bool { return e.ready }
+
+// Value return current average, NaN if not ready
+func (e *EMA) Value() float64 {
+	if !e.ready {
+		return math.NaN()
+	}
+	return e.value
+}
+
+// NewRSI return a relative strength index of period
+func NewRSI(period int) *RSI {
+	if period < 1 {
+		period = 1
+	}
+	return &RSI{period: period}
+}
+
+// Update add a value and return current index
+func (r *RSI) Update(v float64) float64 {
+	r.count++
+	if r.count == 1 {
+		r.prev = v
+		return math.NaN()
+	}
+
+	gain, loss := 0.0, 0.0
+	if d := v - r.prev; d > 0 {
+		gain = d
+	} else {
+		loss = -d
+	}
+	r.prev = v
+
+	n := float64(r.period)
+	if r.count <= r.period+1 {
+		// simple average of the first period changes
+		r.gain += gain / n
+		r.loss += loss / n
+	} else {
+		r.gain = (r.gain*(n-1) + gain) / n
+		r.loss = (r.loss*(n-1) + loss) / n
+	}
+
+	switch {
+	case r.loss == 0 && r.gain == 0:
+		r.value = 50
+	case r.loss == 0:
+		r.value = 100
+	default:
+		r.value = 100 - 100/(1+r.gain/r.loss)
+	}
+	return r.Value()
+}
+
+// Ready return whether there are period changes
+func (r *RSI) Ready() bool { return r.count > r.period }
+
+// Value return current index, NaN if not ready
+func (r *RSI) Value() float64 {
+	if !r.Ready() {
+		return math.NaN()
+	}
+	return r.value
+}
+
+// NewMACD return a MACD, the classic one is NewMACD(12, 26, 9)
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{
+		fast:      NewEMA(fast),
+		slow:      NewEMA(slow),
+		signal:    NewEMA(signal),
+		MACD:      math.NaN(),
+		Signal:    math.NaN(),
+		Histogram: math.NaN(),
+	}
+}
+
+// Update add a value and return current histogram
+func (m *MACD) Update(v float64) float64 {
+	f, s := m.fast.Update(v), m.slow.Update(v)
+	if !m.fast.Ready() || !m.slow.Ready() {
+		return m.Histogram
+	}
+
+	m.MACD = f - s
+	m.Signal = m.signal.Update(m.MACD)
+	if m.signal.Ready() {
+		m.Histogram = m.MACD - m.Signal
+	}
+	return m.Histogram
+}
+
+// Ready return whether the signal line is ready
+func (m *MACD) Ready() bool { return m.signal.Ready() }
+
+// NewBollinger return bollinger bands of period and k standard deviations,
+// the classic one is NewBollinger(20, 2)
+func NewBollinger(period int, k float64) *Bollinger {
+	return &Bollinger{
+		k:      k,
+		sma:    NewSMA(period),
+		Upper:  math.NaN(),
+		Middle: math.NaN(),
+		Lower:  math.NaN(),
+	}
+}
+
+// Update add a value and return current middle band
+func (b *Bollinger) Update(v float64) float64 {
+	b.sma.Update(v)
+	if !b.sma.Ready() {
+		return b.Middle
+	}
+
+	mean := b.sma.Value()
+	var variance float64
+	for _, x := range b.sma.window {
+		variance += (x - mean) * (x - mean)
+	}
+	sd := math.Sqrt(variance / float64(len(b.sma.window)))
+
+	b.Middle = mean
+	b.Upper = mean + b.k*sd
+	b.Lower = mean - b.k*sd
+	return b.Middle
+}
+
+// Ready return whether there are period values
+func (b *Bollinger) Ready() bool { return b.sma.Ready() }
+
+// Width return (upper - lower) / middle
+func (b *Bollinger) Width() float64 {
+	return (b.Upper - b.Lower) / b.Middle
+}
+
+// NewATR return an average true range of period
+func NewATR(period int) *ATR {
+	if period < 1 {
+		period = 1
+	}
+	return &ATR{period: period}
+}
+
+// Update add a candle and return current average
+func (a *ATR) Update(c Candle) float64 {
+	tr := c.High - c.Low
+	if a.count > 0 {
+		tr = math.Max(tr, math.Max(math.Abs(c.High-a.prev), math.Abs(c.Low-a.prev)))
+	}
+	a.prev = c.Close
+	a.count++
+
+	n := float64(a.period)
+	if a.count <= a.period {
+		a.value += tr / n
+	} else {
+		a.value = (a.value*(n-1) + tr) / n
+	}
+	return a.Value()
+}
+
+// Ready return whether there are period candles
+func (a *ATR) Ready() bool { return a.count >= a.period }
+
+// Value return current average, NaN if not ready
+func (a *ATR) Value() float64 {
+	if !a.Ready() {
+		return math.NaN()
+	}
+	return a.value
+}
+
+// NewVWAP return a volume weighted average price
+func NewVWAP() *VWAP {
+	return &VWAP{value: math.NaN()}
+}
+
+// Update add a candle and return current average of typical price
+func (w *VWAP) Update(c Candle) float64 {
+	w.pv += (c.High + c.Low + c.Close) / 3 * c.Volume
+	w.volume += c.Volume
+	if w.volume > 0 {
+		w.value = w.pv / w.volume
+	}
+	return w.value
+}
+
+// Reset start a new session
+func (w *VWAP) Reset() {
+	*w = VWAP{value: math.NaN()}
+}
+
+// Value return current average, NaN if no volume
+func (w *VWAP) Value() float64 { return w.value }
+
+// SMAs return simple moving averages of values, NaN while warming up
+func SMAs(values []float64, period int) []float64 {
+	s := NewSMA(period)
+	r := make([]float64, len(values))
+	for i, v := range values {
+		r[i] = s.Update(v)
+	}
+	return r
+}
+
+// EMAs return exponential moving averages of values, NaN while warming up
+func EMAs(values []float64, period int) []float64 {
+	e := NewEMA(period)
+	r := make([]float64, len(values))
+	for i, v := range values {
+		r[i] = e.Update(v)
+	}
+	return r
+}
+
+// RSIs return relative strength indexes of values, NaN while warming up
+func RSIs(values []float64, period int) []float64 {
+	s := NewRSI(period)
+	r := make([]float64, len(values))
+	for i, v := range values {
+		r[i] = s.Update(v)
+	}
+	return r
+}
+
+// MACDs return macd, signal and histogram lines of values, NaN while warming up
+func MACDs(values []float64, fast, slow, signal int) (macd, sig, hist []float64) {
+	m := NewMACD(fast, slow, signal)
+	macd = make([]float64, len(values))
+	sig = make([]float64, len(values))
+	hist = make([]float64, len(values))
+	for i, v := range values {
+		hist[i] = m.Update(v)
+		macd[i], sig[i] = m.MACD, m.Signal
+	}
+	return macd, sig, hist
+}
+
+// Bollingers return upper, middle and lower bands of values, NaN while warming up
+func Bollingers(values []float64, period int, k float64) (upper, middle, lower []float64) {
+	b := NewBollinger(period, k)
+	upper = make([]float64, len(values))
+	middle = make([]float64, len(values))
+	lower = make([]float64, len(values))
+	for i, v := range values {
+		middle[i] = b.Update(v)
+		upper[i], lower[i] = b.Upper, b.Lower
+	}
+	return upper, middle, lower
+}
+
+// ATRs return average true ranges of candles, NaN while warming up
+func ATRs(candles []Candle, period int) []float64 {
+	a := NewATR(period)
+	r := make([]float64, len(candles))
+	for i, v := range candles {
+		r[i] = a.Update(v)
+	}
+	return r
+}
+
+// VWAPs return cumulative volume weighted average prices of candles
+func VWAPs(candles []Candle) []float64 {
+	w := NewVWAP()
+	r := make([]float64, len(candles))
+	for i, v := range candles {
+		r[i] = w.Update(v)
+	}
+	return r
+}
+
+// Closes return close prices of candles
+func Closes(candles []Candle) []float64 {
+	r := make([]float64, len(candles))
+	for i, v := range candles {
+		r[i] = v.Close
+	}
+	return r
+}
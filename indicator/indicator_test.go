@@ -0,0 +1,147 @@
+package indicator
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// closing prices of the stockcharts.com examples
+var (
+	rsiCloses = []float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+		46.21, 46.25, 45.71, 46.45, 45.78, 45.35, 44.03, 44.18, 44.22, 44.57,
+		43.42, 42.66, 43.13,
+	}
+	emaCloses = []float64{
+		22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+		22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63,
+		23.82, 23.87, 23.65, 23.19, 23.10, 23.33, 22.68, 23.10, 22.40, 22.17,
+	}
+)
+
+// compare values with tolerance, a NaN in want means not ready
+func equal(c C, got, want []float64, tolerance float64) {
+	c.So(got, ShouldHaveLength, len(want))
+	for i := range want {
+		if math.IsNaN(want[i]) {
+			c.So(math.IsNaN(got[i]), ShouldBeTrue)
+			continue
+		}
+		c.So(got[i], ShouldAlmostEqual, want[i], tolerance)
+	}
+}
+
+func nan(n int) []float64 {
+	r := make([]float64, n)
+	for i := range r {
+		r[i] = math.NaN()
+	}
+	return r
+}
+
+func TestMovingAverage(t *testing.T) {
+	Convey("should calculate moving averages", t, func(c C) {
+		cases := []struct {
+			name string
+			got  []float64
+			want []float64
+		}{
+			{"sma", SMAs([]float64{1, 2, 3, 4, 5, 6}, 3), append(nan(2), 2, 3, 4, 5)},
+			{"sma period 1", SMAs([]float64{1, 2, 3}, 1), []float64{1, 2, 3}},
+			{"ema", EMAs(emaCloses, 10), append(nan(9),
+				22.22, 22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28,
+				23.34, 23.43, 23.51, 23.53, 23.47, 23.40, 23.39, 23.26, 23.23, 23.08,
+				22.92)},
+		}
+		for _, v := range cases {
+			c.Convey(v.name, func(c C) {
+				equal(c, v.got, v.want, 0.005)
+			})
+		}
+	})
+}
+
+func TestRSI(t *testing.T) {
+	Convey("should calculate relative strength index", t, func(c C) {
+		cases := []struct {
+			name   string
+			values []float64
+			period int
+			want   []float64
+		}{
+			{"stockcharts", rsiCloses, 14, append(nan(14),
+				70.46, 66.25, 66.48, 69.35, 66.29, 57.92, 62.88, 63.21, 56.01, 62.34,
+				54.67, 50.39, 40.02, 41.49, 41.90, 45.50, 37.32, 33.09, 37.79)},
+			{"rising", []float64{1, 2, 3, 4}, 2, []float64{math.NaN(), math.NaN(), 100, 100}},
+			{"flat", []float64{1, 1, 1}, 2, []float64{math.NaN(), math.NaN(), 50}},
+		}
+		for _, v := range cases {
+			c.Convey(v.name, func(c C) {
+				equal(c, RSIs(v.values, v.period), v.want, 0.005)
+			})
+		}
+	})
+}
+
+func TestMACD(t *testing.T) {
+	Convey("should calculate macd, signal and histogram", t, func(c C) {
+		macd, sig, hist := MACDs(emaCloses[:10], 3, 5, 2)
+		equal(c, macd, append(nan(4), -0.0005, -0.00825, 0.007208, 0.044493, 0.017839, 0.014315), 1e-6)
+		equal(c, sig, append(nan(5), -0.004375, 0.003347, 0.030778, 0.022152, 0.016927), 1e-6)
+		equal(c, hist, append(nan(5), -0.003875, 0.003861, 0.013715, -0.004313, -0.002612), 1e-6)
+
+		m := NewMACD(12, 26, 9)
+		for _, v := range emaCloses {
+			m.Update(v)
+		}
+		c.So(m.Ready(), ShouldBeFalse)
+	})
+}
+
+func TestBollinger(t *testing.T) {
+	Convey("should calculate bollinger bands", t, func(c C) {
+		upper, middle, lower := Bollingers([]float64{1, 2, 3, 4, 5, 6}, 5, 2)
+		equal(c, upper, append(nan(4), 5.828427, 6.828427), 1e-6)
+		equal(c, middle, append(nan(4), 3, 4), 1e-6)
+		equal(c, lower, append(nan(4), 0.171573, 1.171573), 1e-6)
+
+		b := NewBollinger(2, 2)
+		b.Update(2)
+		b.Update(2)
+		c.So(b.Ready(), ShouldBeTrue)
+		c.So(b.Width(), ShouldEqual, 0)
+	})
+}
+
+func TestATR(t *testing.T) {
+	Convey("should calculate average true range", t, func(c C) {
+		candles := []Candle{
+			{High: 10, Low: 8, Close: 9},
+			{High: 11, Low: 9, Close: 10},
+			{High: 12, Low: 10, Close: 11},
+			{High: 11, Low: 7, Close: 8},
+			{High: 9, Low: 8.5, Close: 9},
+		}
+		equal(c, ATRs(candles, 3), append(nan(2), 2, 2.666667, 2.111111), 1e-6)
+	})
+}
+
+func TestVWAP(t *testing.T) {
+	Convey("should calculate volume weighted average price", t, func(c C) {
+		candles := []Candle{
+			{High: 3, Low: 1, Close: 2, Volume: 0},
+			{High: 3, Low: 1, Close: 2, Volume: 10},
+			{High: 6, Low: 3, Close: 3, Volume: 30},
+		}
+		equal(c, VWAPs(candles), []float64{math.NaN(), 2, 3.5}, 1e-9)
+		c.So(Closes(candles), ShouldResemble, []float64{2, 2, 3})
+
+		w := NewVWAP()
+		w.Update(candles[1])
+		w.Reset()
+		c.So(math.IsNaN(w.Value()), ShouldBeTrue)
+	})
+}
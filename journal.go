@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/modood/cts/journal"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var (
+	errFormat = errors.New("unknown format, it should be csv or json")
+)
+
+func journalCommand() cli.Command {
+	return cli.Command{
+		Name:  "journal",
+		Usage: "filter and export the journal of signals, orders and loans as CSV or JSON",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "file",
+				Value:  ".cts-journal.jsonl",
+				Usage:  "journal file",
+				EnvVar: "CTS_JOURNAL",
+			},
+			cli.StringSliceFlag{
+				Name:  "kind",
+				Usage: "kinds of entries: signal, order, borrow or repay, all if not set",
+			},
+			cli.StringFlag{
+				Name:  "bot",
+				Usage: "name of the bot, all if empty",
+			},
+			cli.StringFlag{
+				Name:  "symbol",
+				Usage: "symbol name, e.g., doge_usdt, all if empty",
+			},
+			cli.StringFlag{
+				Name:  "from",
+				Usage: "start time, inclusive, e.g., 2018-03-01 or 2018-03-01T08:00:00+08:00",
+			},
+			cli.StringFlag{
+				Name:  "to",
+				Usage: "end time, exclusive, like --from",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "csv",
+				Usage: "output format: csv or json",
+			},
+			cli.StringFlag{
+				Name:  "output",
+				Usage: "output file, stdout if empty",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			f := journal.Filter{
+				Kinds:  c.StringSlice("kind"),
+				Bot:    c.String("bot"),
+				Symbol: c.String("symbol"),
+			}
+			var err error
+			if f.From, err = parseTime(c.String("from")); err != nil {
+				return errors.Wrap(err, util.FuncName())
+			}
+			if f.To, err = parseTime(c.String("to")); err != nil {
+				return errors.Wrap(err, util.FuncName())
+			}
+
+			write := journal.WriteCSV
+			switch c.String("format") {
+			case "csv":
+			case "json":
+				write = journal.WriteJSON
+			default:
+				return errors.Wrap(errFormat, util.FuncName())
+			}
+
+			es, err := journal.Read(c.String("file"), f)
+			if err != nil {
+				return errors.Wrap(err, util.FuncName())
+			}
+
+			name := c.String("output")
+			if name == "" {
+				if err = write(os.Stdout, es); err != nil {
+					return errors.Wrap(err, util.FuncName())
+				}
+				return nil
+			}
+
+			out, err := os.Create(name)
+			if err != nil {
+				return errors.Wrap(err, util.FuncName())
+			}
+			err = write(out, es)
+			if e := out.Close(); e != nil && err == nil {
+				err = e
+			}
+			if err != nil {
+				return errors.Wrap(err, util.FuncName())
+			}
+			return nil
+		},
+	}
+}
+
+// parseTime parse a date or RFC3339 time in local time, zero if s is empty
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, s)
+	}
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, util.FuncName())
+	}
+	return t, nil
+}
@@ -0,0 +1,267 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// Kinds of entries
+const (
+	Signal = "signal"
+	Order  = "order"
+	Borrow = "borrow"
+	Repay  = "repay"
+	Equity = "equity" // a snapshot of the account value in Currency
+)
+
+type (
+	// Entry is a record of the journal, fields which do not belong to its
+	// kind are empty
+	Entry struct {
+		Time   time.Time `json:"time"`
+		Kind   string    `json:"kind"`
+		Bot    string    `json:"bot,omitempty"`
+		Symbol string    `json:"symbol,omitempty"`
+
+		// signal
+		Strategy string             `json:"strategy,omitempty"`
+		Signal   string             `json:"signal,omitempty"`
+		Inputs   map[string]float64 `json:"inputs,omitempty"`
+
+		// order
+		OrderID          uint64  `json:"order_id,omitempty"`
+		Type             string  `json:"type,omitempty"`
+		State            string  `json:"state,omitempty"`
+		FilledAmount     float64 `json:"filled_amount,omitempty"`      // base currency
+		FilledCashAmount float64 `json:"filled_cash_amount,omitempty"` // quote currency
+		Fees             float64 `json:"fees,omitempty"`               // in the received currency
+		Price            float64 `json:"price,omitempty"`              // average price
+
+		// order and loan, amount of an order is quote currency for buy-market,
+		// otherwise base currency. amount of a repay is what has been repaid,
+		// interest included.
+		Currency string  `json:"currency,omitempty"`
+		Amount   float64 `json:"amount,omitempty"`
+		Interest float64 `json:"interest,omitempty"` // paid by a repay, in Currency
+
+		Error string `json:"error,omitempty"`
+	}
+
+	// Journal is an append-only file of entries in JSON lines, every entry
+	// is flushed to disk when it is appended
+	Journal struct {
+		Now func() time.Time // time.Now if nil
+
+		name string
+		mu   sync.Mutex
+		f    *os.File
+	}
+
+	// Filter select entries, empty fields match all
+	Filter struct {
+		Kinds  []string
+		Bot    string
+		Symbol string
+		From   time.Time // inclusive
+		To     time.Time // exclusive
+	}
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	// columns of CSV
+	columns = []string{"time", "kind", "bot", "symbol", "strategy", "signal", "inputs",
+		"order_id", "type", "state", "currency", "amount", "filled_amount",
+		"filled_cash_amount", "fees", "price", "interest", "error"}
+)
+
+// Open open a journal file for appending, it is created if not exists
+func Open(name string) (*Journal, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return &Journal{name: name, f: f}, nil
+}
+
+// Name return the file name of the journal, which can be Read
+func (j *Journal) Name() string {
+	return j.name
+}
+
+// Append write an entry, its time is now if zero. appending to a nil
+// journal does nothing.
+func (j *Journal) Append(e Entry) error {
+	if j == nil {
+		return nil
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+		if j.Now != nil {
+			e.Time = j.Now()
+		}
+	}
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err = j.f.Write(append(bs, '\n')); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if err = j.f.Sync(); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// Close close the journal file
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.f.Close(); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// Read return entries of a journal file selected by filter, in order of
+// appending. a broken last line, which is left by a crash, is ignored.
+func Read(name string, filter Filter) ([]Entry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	defer f.Close()
+
+	var r []Entry
+	var broken error
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if broken != nil {
+			return nil, errors.Wrap(broken, util.FuncName())
+		}
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var e Entry
+		if err = json.Unmarshal(sc.Bytes(), &e); err != nil {
+			broken = fmt.Errorf("%s line %d: %v", name, line, err)
+			continue
+		}
+		if filter.Match(e) {
+			r = append(r, e)
+		}
+	}
+	if err = sc.Err(); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return r, nil
+}
+
+// Match return whether an entry is selected by the filter
+func (f Filter) Match(e Entry) bool {
+	if len(f.Kinds) != 0 {
+		ok := false
+		for _, v := range f.Kinds {
+			ok = ok || v == e.Kind
+		}
+		if !ok {
+			return false
+		}
+	}
+	if f.Bot != "" && f.Bot != e.Bot {
+		return false
+	}
+	if f.Symbol != "" && f.Symbol != e.Symbol {
+		return false
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.Time.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// WriteJSON write entries as a JSON array
+func WriteJSON(w io.Writer, es []Entry) error {
+	if es == nil {
+		es = []Entry{}
+	}
+	bs, err := json.MarshalIndent(es, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if _, err = w.Write(append(bs, '\n')); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// WriteCSV write entries as CSV with a header, inputs are name=value pairs
+// separated by semicolons
+func WriteCSV(w io.Writer, es []Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	num := func(f float64) string {
+		if f == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	for _, e := range es {
+		var inputs []string
+		for k, v := range e.Inputs {
+			inputs = append(inputs, k+"="+strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		sort.Strings(inputs)
+
+		id := ""
+		if e.OrderID != 0 {
+			id = strconv.FormatUint(e.OrderID, 10)
+		}
+
+		err := cw.Write([]string{e.Time.Format(time.RFC3339), e.Kind, e.Bot, e.Symbol,
+			e.Strategy, e.Signal, strings.Join(inputs, ";"),
+			id, e.Type, e.State, e.Currency, num(e.Amount), num(e.FilledAmount),
+			num(e.FilledCashAmount), num(e.Fees), num(e.Price), num(e.Interest), e.Error})
+		if err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package journal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJournal(t *testing.T) {
+	Convey("should append entries and read them by filter", t, func(c C) {
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "journal")
+
+		now := time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)
+		j, err := Open(name)
+		c.So(err, ShouldBeNil)
+		j.Now = func() time.Time { return now }
+
+		c.So(j.Append(Entry{Kind: Signal, Bot: "doge", Symbol: "doge_usdt", Strategy: "ripdog",
+			Signal: "rise", Inputs: map[string]float64{"rise": 70, "doge": 1.5}}), ShouldBeNil)
+		now = now.Add(time.Hour)
+		c.So(j.Append(Entry{Kind: Order, Bot: "doge", Symbol: "doge_usdt", OrderID: 1,
+			Type: "buy-market", Amount: 100, FilledAmount: 49.9, Fees: 0.1}), ShouldBeNil)
+		c.So(j.Append(Entry{Kind: Borrow, Bot: "xrp", Symbol: "xrp_usdt", Currency: "usdt", Amount: 50}), ShouldBeNil)
+		c.So(j.Close(), ShouldBeNil)
+
+		// reopened for appending
+		j, err = Open(name)
+		c.So(err, ShouldBeNil)
+		c.So(j.Append(Entry{Kind: Repay, Bot: "xrp", Symbol: "xrp_usdt", Currency: "usdt", Amount: 50}), ShouldBeNil)
+		c.So(j.Close(), ShouldBeNil)
+
+		es, err := Read(name, Filter{})
+		c.So(err, ShouldBeNil)
+		c.So(len(es), ShouldEqual, 4)
+		c.So(es[0].Time.Equal(time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)), ShouldBeTrue)
+		c.So(es[0].Inputs["rise"], ShouldEqual, 70)
+		c.So(es[3].Kind, ShouldEqual, Repay)
+
+		es, err = Read(name, Filter{Kinds: []string{Borrow, Repay}})
+		c.So(err, ShouldBeNil)
+		c.So(len(es), ShouldEqual, 2)
+
+		es, err = Read(name, Filter{Bot: "doge", From: now})
+		c.So(err, ShouldBeNil)
+		c.So(len(es), ShouldEqual, 1)
+		c.So(es[0].OrderID, ShouldEqual, 1)
+
+		es, err = Read(name, Filter{Symbol: "doge_usdt", To: now})
+		c.So(err, ShouldBeNil)
+		c.So(len(es), ShouldEqual, 1)
+		c.So(es[0].Kind, ShouldEqual, Signal)
+
+		// a broken last line is left by a crash
+		f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0600)
+		c.So(err, ShouldBeNil)
+		_, err = f.WriteString(`{"time":"2018-03-01T`)
+		c.So(err, ShouldBeNil)
+		c.So(f.Close(), ShouldBeNil)
+		es, err = Read(name, Filter{})
+		c.So(err, ShouldBeNil)
+		c.So(len(es), ShouldEqual, 4)
+
+		c.So(ioutil.WriteFile(name, []byte("xxx\n{}\n"), 0600), ShouldBeNil)
+		_, err = Read(name, Filter{})
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestExport(t *testing.T) {
+	Convey("should export entries as CSV and JSON", t, func(c C) {
+		es := []Entry{
+			{Time: time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC), Kind: Signal, Bot: "doge",
+				Symbol: "doge_usdt", Strategy: "ripdog", Signal: "rise",
+				Inputs: map[string]float64{"rise": 70, "doge": 1.5}},
+			{Time: time.Date(2018, 3, 1, 8, 0, 1, 0, time.UTC), Kind: Order, Bot: "doge",
+				Symbol: "doge_usdt", OrderID: 1, Type: "buy-market", State: "filled",
+				Amount: 100, FilledAmount: 49.9, FilledCashAmount: 100, Fees: 0.1, Price: 2},
+		}
+
+		var buf bytes.Buffer
+		c.So(WriteCSV(&buf, es), ShouldBeNil)
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		c.So(len(lines), ShouldEqual, 3)
+		c.So(lines[0], ShouldStartWith, "time,kind,bot,symbol")
+		c.So(lines[1], ShouldEqual, "2018-03-01T08:00:00Z,signal,doge,doge_usdt,ripdog,rise,doge=1.5;rise=70,,,,,,,,,,,")
+		c.So(lines[2], ShouldEqual, "2018-03-01T08:00:01Z,order,doge,doge_usdt,,,,1,buy-market,filled,,100,49.9,100,0.1,2,,")
+
+		buf.Reset()
+		c.So(WriteJSON(&buf, es), ShouldBeNil)
+		c.So(buf.String(), ShouldContainSubstring, `"order_id": 1`)
+
+		buf.Reset()
+		c.So(WriteJSON(&buf, nil), ShouldBeNil)
+		c.So(buf.String(), ShouldEqual, "[]\n")
+	})
+}
@@ -0,0 +1,88 @@
+package journal
+
+import (
+	"log"
+	"math"
+
+	"github.com/modood/cts/exchange"
+)
+
+// symbol record orders and loan actions of an exchange.Symbol
+type symbol struct {
+	exchange.Symbol
+	j      *Journal
+	bot    string
+	symbol string // name in config, e.g., doge_usdt
+}
+
+// Wrap return a symbol which records its trades, borrows and repays to j
+// as entries of a bot, it is s itself if j is nil
+func Wrap(s exchange.Symbol, j *Journal, bot, name string) exchange.Symbol {
+	if j == nil {
+		return s
+	}
+	return &symbol{Symbol: s, j: j, bot: bot, symbol: name}
+}
+
+// Trade trade and record the fill
+func (s *symbol) Trade(cmd string, amount float64) (*exchange.Fill, error) {
+	f, err := s.Symbol.Trade(cmd, amount)
+
+	e := s.entry(Order, err)
+	e.Type, e.Amount = cmd, amount
+	if f != nil {
+		e.OrderID, e.Type, e.State = f.OrderID, f.Type, f.State
+		e.FilledAmount, e.FilledCashAmount = f.FilledAmount, f.FilledCashAmount
+		e.Fees, e.Price = f.Fees, f.Price
+	}
+	s.append(e)
+
+	return f, err
+}
+
+// Borrow borrow and record it
+func (s *symbol) Borrow(currency string, amount float64) error {
+	err := s.Symbol.Borrow(currency, amount)
+
+	e := s.entry(Borrow, err)
+	e.Currency, e.Amount = currency, amount
+	s.append(e)
+
+	return err
+}
+
+// Repay repay and record the amount repaid with the interest of it, which
+// are the differences of the loan and interest after the repayment, so that
+// a repayment limited by the balance or failed partially is recorded as is
+func (s *symbol) Repay(currency string, amount float64) error {
+	before, e1 := s.Symbol.Balance(currency)
+	err := s.Symbol.Repay(currency, amount)
+	after, e2 := s.Symbol.Balance(currency)
+
+	e := s.entry(Repay, err)
+	e.Currency = currency
+	if e1 == nil && e2 == nil {
+		e.Interest = math.Max(before.Interest-after.Interest, 0)
+		e.Amount = math.Max(before.Loan-after.Loan, 0) + e.Interest
+	} else {
+		log.Println("journal: unknown repayment of", s.symbol, currency, e1, e2)
+	}
+	s.append(e)
+
+	return err
+}
+
+func (s *symbol) entry(kind string, err error) Entry {
+	e := Entry{Kind: kind, Bot: s.bot, Symbol: s.symbol}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// append never fails a trade, errors of the journal are only logged
+func (s *symbol) append(e Entry) {
+	if err := s.j.Append(e); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,98 @@
+package journal
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/sim"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+func TestWrap(t *testing.T) {
+	Convey("should record trades and loans of a symbol", t, func(c C) {
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "journal")
+
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Leverage = 3
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		c.So(Wrap(s, nil, "doge", "doge_usdt"), ShouldEqual, s)
+
+		j, err := Open(name)
+		c.So(err, ShouldBeNil)
+		w := Wrap(s, j, "doge", "doge_usdt")
+		c.So(w.Borrow("usdt", 50), ShouldBeNil)
+		f, err := w.Trade(exchange.Buy, 150)
+		c.So(err, ShouldBeNil)
+		c.So(w.Repay("doge", f.Received()), ShouldBeNil)
+		c.So(w.Borrow("usdt", 1e9), ShouldNotBeNil)
+		c.So(j.Close(), ShouldBeNil)
+
+		es, err := Read(name, Filter{})
+		c.So(err, ShouldBeNil)
+		c.So(len(es), ShouldEqual, 4)
+		c.So(es[0].Kind, ShouldEqual, Borrow)
+		c.So(es[0].Currency, ShouldEqual, "usdt")
+		c.So(es[0].Amount, ShouldEqual, 50)
+		c.So(es[1].Kind, ShouldEqual, Order)
+		c.So(es[1].Bot, ShouldEqual, "doge")
+		c.So(es[1].Symbol, ShouldEqual, "doge_usdt")
+		c.So(es[1].FilledAmount, ShouldEqual, f.FilledAmount)
+		c.So(es[1].Price, ShouldEqual, 2)
+		c.So(es[2].Kind, ShouldEqual, Repay)
+		c.So(es[2].Amount, ShouldEqual, 0)
+		c.So(es[3].Error, ShouldNotBeEmpty)
+	})
+
+	Convey("should record the amount repaid instead of the upper limit", t, func(c C) {
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "journal")
+
+		now := time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Fee = 0
+		e.Leverage = 3
+		e.Interest = 0.001
+		e.Now = func() time.Time { return now }
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		j, err := Open(name)
+		c.So(err, ShouldBeNil)
+		w := Wrap(s, j, "doge", "doge_usdt")
+		c.So(w.Borrow("usdt", 100), ShouldBeNil)
+		now = now.Add(time.Hour * 24)
+
+		// interest of a day is repaid first
+		c.So(w.Repay("usdt", 1e9), ShouldBeNil)
+		// nothing is left to repay
+		c.So(w.Repay("usdt", 1e9), ShouldBeNil)
+		c.So(j.Close(), ShouldBeNil)
+
+		es, err := Read(name, Filter{Kinds: []string{Repay}})
+		c.So(err, ShouldBeNil)
+		c.So(es, ShouldHaveLength, 2)
+		c.So(es[0].Interest, ShouldAlmostEqual, 0.1)
+		c.So(es[0].Amount, ShouldAlmostEqual, 100.1)
+		c.So(es[1].Interest, ShouldEqual, 0)
+		c.So(es[1].Amount, ShouldEqual, 0)
+	})
+}
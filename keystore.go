@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/modood/cts/secret"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var (
+	errNoName  = errors.New("no secret name")
+	errNoValue = errors.New("no secret value in stdin")
+)
+
+func keystoreCommand() cli.Command {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "file",
+			Value: ".cts-keystore",
+			Usage: "keystore file",
+		},
+		cli.StringFlag{
+			Name:  "passphrase",
+			Value: secret.Env + "CTS_KEYSTORE_PASSPHRASE",
+			Usage: "reference of the passphrase: env:<name> or file:<path>",
+		},
+	}
+
+	return cli.Command{
+		Name:  "keystore",
+		Usage: "manage secrets in a passphrase encrypted keystore, refer to them by keystore:<name>",
+		Subcommands: []cli.Command{
+			{
+				Name:      "set",
+				Usage:     "add or replace a secret, its value is read from stdin",
+				ArgsUsage: "<name>",
+				Flags:     flags,
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errors.Wrap(errNoName, util.FuncName())
+					}
+					ks, err := openKeystore(c)
+					if err != nil {
+						return errors.Wrap(err, util.FuncName())
+					}
+
+					v, err := bufio.NewReader(os.Stdin).ReadString('\n')
+					v = strings.TrimRight(v, "\r\n")
+					if v == "" {
+						return errors.Wrap(errNoValue, util.FuncName())
+					}
+					ks.Set(c.Args().First(), v)
+					if err = ks.Save(); err != nil {
+						return errors.Wrap(err, util.FuncName())
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "delete",
+				Usage:     "remove a secret",
+				ArgsUsage: "<name>",
+				Flags:     flags,
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errors.Wrap(errNoName, util.FuncName())
+					}
+					ks, err := openKeystore(c)
+					if err != nil {
+						return errors.Wrap(err, util.FuncName())
+					}
+
+					if _, err = ks.Get(c.Args().First()); err != nil {
+						return errors.Wrap(err, util.FuncName())
+					}
+					ks.Delete(c.Args().First())
+					if err = ks.Save(); err != nil {
+						return errors.Wrap(err, util.FuncName())
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "print names of all secrets",
+				Flags: flags,
+				Action: func(c *cli.Context) error {
+					ks, err := openKeystore(c)
+					if err != nil {
+						return errors.Wrap(err, util.FuncName())
+					}
+
+					for _, v := range ks.Names() {
+						fmt.Println(v)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func openKeystore(c *cli.Context) (*secret.Store, error) {
+	p, err := secret.Resolve(c.String("passphrase"), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	ks, err := secret.Open(c.String("file"), p)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return ks, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/journal"
+	"github.com/modood/cts/metrics"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// meter count orders and borrows of a symbol by a bot
+type meter struct {
+	exchange.Symbol
+	bot    string
+	symbol string // name of config, e.g., doge_usdt
+}
+
+// registry is the metrics of /metrics
+var registry = metrics.NewRegistry()
+
+// meters of bots and exchanges
+var meters = struct {
+	requests      *metrics.Histogram
+	requestErrors *metrics.Counter
+	signals       *metrics.Counter
+	errors        *metrics.Counter
+	orders        *metrics.Counter
+	fills         *metrics.Counter
+	borrowed      *metrics.Counter
+	riskRate      *metrics.Gauge
+	position      *metrics.Gauge
+	equity        *metrics.Gauge
+	paused        *metrics.Gauge
+	lastCycle     *metrics.Gauge
+}{
+	requests: registry.Histogram("cts_exchange_request_duration_seconds",
+		"Latency of requests to exchange endpoints, of every attempt.",
+		metrics.DefBuckets, "exchange", "endpoint"),
+	requestErrors: registry.Counter("cts_exchange_request_errors_total",
+		"Failed requests to exchange endpoints.", "exchange", "endpoint"),
+	signals: registry.Counter("cts_signals_total",
+		"Signals of strategies by type.", "bot", "signal"),
+	errors: registry.Counter("cts_bot_errors_total",
+		"Errors of bots, which are never reset.", "bot"),
+	orders: registry.Counter("cts_orders_placed_total",
+		"Orders placed.", "bot", "symbol", "type"),
+	fills: registry.Counter("cts_orders_filled_total",
+		"Orders filled, fully or partially.", "bot", "symbol", "type"),
+	borrowed: registry.Counter("cts_borrowed_total",
+		"Amount borrowed in the currency.", "symbol", "currency"),
+	riskRate: registry.Gauge("cts_margin_risk_rate",
+		"Risk rate of margin accounts, which is assets / debts.", "symbol"),
+	position: registry.Gauge("cts_position",
+		"Position of symbols in the base currency, negative if short.", "symbol"),
+	equity: registry.Gauge("cts_equity",
+		"Equity of symbols in the quote currency.", "symbol", "quote"),
+	paused: registry.Gauge("cts_bot_paused",
+		"Whether bots are paused.", "bot"),
+	lastCycle: registry.Gauge("cts_last_success_timestamp_seconds",
+		"Unix time of the last successful cycle of bots.", "bot"),
+}
+
+func init() {
+	registry.Collect(collect)
+}
+
+// collect update gauges of bots on scrape, gauges of symbols are measured by
+// cycles of bots instead so that scrapes send no requests
+func collect() {
+	for _, v := range bots {
+		meters.paused.Set(float64(atomic.LoadInt32(&v.paused)), v.name)
+	}
+}
+
+// measure update the position, equity and risk rate of a symbol
+func measure(s exchange.Symbol, symbol string) error {
+	pos, equity, _, err := exchange.Position(s)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	meters.position.Set(pos, symbol)
+	meters.equity.Set(equity, symbol, s.QuoteCurrency())
+
+	if r, ok := s.(exchange.RiskRater); ok {
+		rate, err := r.RiskRate()
+		if err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		meters.riskRate.Set(rate, symbol)
+	}
+	return nil
+}
+
+// observe return a hook of requests to an exchange, e.g., Observe of a
+// huobi.Client
+func observe(exchange string) func(endpoint string, d time.Duration, err error) {
+	return func(endpoint string, d time.Duration, err error) {
+		meters.requests.Observe(d.Seconds(), exchange, endpoint)
+		if err != nil {
+			meters.requestErrors.Inc(exchange, endpoint)
+		}
+	}
+}
+
+// track return a symbol whose orders and loans by a bot are journaled and
+// metered
+func track(s exchange.Symbol, bot, symbol string) exchange.Symbol {
+	return &meter{Symbol: journal.Wrap(s, records, bot, symbol), bot: bot, symbol: symbol}
+}
+
+// Trade count the order and its fill
+func (m *meter) Trade(cmd string, amount float64) (*exchange.Fill, error) {
+	f, err := m.Symbol.Trade(cmd, amount)
+	if f != nil {
+		typ := f.Type
+		if typ == "" {
+			typ = strings.ToLower(cmd)
+		}
+		meters.orders.Inc(m.bot, m.symbol, typ)
+		if f.FilledAmount > 0 {
+			meters.fills.Inc(m.bot, m.symbol, typ)
+		}
+	}
+	return f, err
+}
+
+// Borrow count the amount borrowed
+func (m *meter) Borrow(currency string, amount float64) error {
+	err := m.Symbol.Borrow(currency, amount)
+	if err == nil {
+		meters.borrowed.Add(amount, m.symbol, currency)
+	}
+	return err
+}
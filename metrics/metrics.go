@@ -0,0 +1,291 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefBuckets are upper bounds of histograms of request latency in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type (
+	// Registry is a set of metrics which are written in the Prometheus text
+	// format, it is safe for concurrent use
+	Registry struct {
+		mu         sync.Mutex
+		families   []*family
+		collectors []func()
+	}
+
+	// Counter is a vector of counters by label values
+	Counter struct{ f *family }
+
+	// Gauge is a vector of gauges by label values
+	Gauge struct{ f *family }
+
+	// Histogram is a vector of histograms by label values
+	Histogram struct{ f *family }
+
+	family struct {
+		name    string
+		help    string
+		typ     string
+		labels  []string
+		buckets []float64 // of histograms
+
+		mu     sync.Mutex
+		series map[string]*series // by joined label values
+	}
+
+	series struct {
+		values []string
+		value  float64   // sum of histograms
+		counts []uint64  // of buckets of histograms, not cumulative
+		count  uint64    // of histograms
+		bounds []float64 // of histograms
+	}
+)
+
+// NewRegistry return an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter register a counter
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, TypeCounter, labels, nil)}
+}
+
+// Gauge register a gauge
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, TypeGauge, labels, nil)}
+}
+
+// Histogram register a histogram of buckets, which are sorted upper bounds
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r.register(name, help, TypeHistogram, labels, buckets)}
+}
+
+// Collect add a function which updates metrics before they are written,
+// e.g., gauges of values which are fetched on demand
+func (r *Registry) Collect(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, f)
+}
+
+func (r *Registry) register(name, help, typ string, labels []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range r.families {
+		if v.name == name {
+			panic("duplicate metric: " + name)
+		}
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*series{},
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// Write run collectors and write all metrics in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]func(){}, r.collectors...)
+	families := append([]*family{}, r.families...)
+	r.mu.Unlock()
+
+	for _, f := range collectors {
+		f()
+	}
+
+	b := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(b)
+	}
+	return b.Flush()
+}
+
+// Handler return the http handler of /metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.Write(w); err != nil {
+			log.Println(err)
+		}
+	})
+}
+
+// Inc add 1
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add add v, which should not be negative
+func (c *Counter) Add(v float64, values ...string) {
+	c.f.with(values, func(s *series) { s.value += v })
+}
+
+// Value return the value, it is for tests
+func (c *Counter) Value(values ...string) float64 {
+	return c.f.value(values)
+}
+
+// Set set v
+func (g *Gauge) Set(v float64, values ...string) {
+	g.f.with(values, func(s *series) { s.value = v })
+}
+
+// Value return the value, it is for tests
+func (g *Gauge) Value(values ...string) float64 {
+	return g.f.value(values)
+}
+
+// Observe add an observation
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.f.with(values, func(s *series) {
+		s.value += v
+		s.count++
+		for i, b := range s.bounds {
+			if v <= b {
+				s.counts[i]++
+				return
+			}
+		}
+	})
+}
+
+// Count return the number of observations, it is for tests
+func (h *Histogram) Count(values ...string) uint64 {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+
+	if s, ok := h.f.series[key(values)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (f *family) with(values []string, update func(s *series)) {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("%s: %d label values of %d labels", f.name, len(values), len(f.labels)))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k := key(values)
+	s, ok := f.series[k]
+	if !ok {
+		s = &series{values: append([]string{}, values...), bounds: f.buckets}
+		s.counts = make([]uint64, len(f.buckets))
+		f.series[k] = s
+	}
+	update(s)
+}
+
+func (f *family) value(values []string) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s, ok := f.series[key(values)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (f *family) write(w io.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escape(f.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := f.series[k]
+		if f.typ != TypeHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.pairs(s.values, ""), format(s.value))
+			continue
+		}
+
+		var n uint64
+		for i, b := range s.bounds {
+			n += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.pairs(s.values, format(b)), n)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.pairs(s.values, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.pairs(s.values, ""), format(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.pairs(s.values, ""), s.count)
+	}
+}
+
+// pairs return {name="value",...} of labels, le is the bucket label of
+// histograms if not empty
+func (f *family) pairs(values []string, le string) string {
+	var ps []string
+	for i, v := range values {
+		ps = append(ps, f.labels[i]+`="`+escape(v, true)+`"`)
+	}
+	if le != "" {
+		ps = append(ps, `le="`+le+`"`)
+	}
+	if len(ps) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(ps, ",") + "}"
+}
+
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// escape escape backslashes and line feeds, and double quotes of label values
+func escape(s string, quote bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func format(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
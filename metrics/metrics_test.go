@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("should write metrics in the Prometheus text format", t, func(c C) {
+		r := NewRegistry()
+		orders := r.Counter("cts_orders_total", "Orders placed.", "bot", "type")
+		equity := r.Gauge("cts_equity", "Equity of a symbol.", "symbol", "quote")
+		latency := r.Histogram("cts_request_seconds", "Latency.", []float64{0.1, 1}, "endpoint")
+		up := r.Gauge("cts_up", "Whether it is up.")
+
+		orders.Inc("doge", "buy-market")
+		orders.Add(2, "doge", "buy-market")
+		orders.Inc("x\"y\\z\n", "sell-market")
+		equity.Set(1.5, "doge_usdt", "usdt")
+		latency.Observe(0.05, "/v1/order")
+		latency.Observe(0.5, "/v1/order")
+		latency.Observe(3, "/v1/order")
+		r.Collect(func() { up.Set(1) })
+
+		c.So(orders.Value("doge", "buy-market"), ShouldEqual, 3)
+		c.So(latency.Count("/v1/order"), ShouldEqual, 3)
+		c.So(func() { orders.Inc("doge") }, ShouldPanic)
+		c.So(func() { r.Gauge("cts_up", "") }, ShouldPanic)
+
+		var b bytes.Buffer
+		c.So(r.Write(&b), ShouldBeNil)
+		c.So(b.String(), ShouldEqual, `# HELP cts_orders_total Orders placed.
+# TYPE cts_orders_total counter
+cts_orders_total{bot="doge",type="buy-market"} 3
+cts_orders_total{bot="x\"y\\z\n",type="sell-market"} 1
+# HELP cts_equity Equity of a symbol.
+# TYPE cts_equity gauge
+cts_equity{symbol="doge_usdt",quote="usdt"} 1.5
+# HELP cts_request_seconds Latency.
+# TYPE cts_request_seconds histogram
+cts_request_seconds_bucket{endpoint="/v1/order",le="0.1"} 1
+cts_request_seconds_bucket{endpoint="/v1/order",le="1"} 2
+cts_request_seconds_bucket{endpoint="/v1/order",le="+Inf"} 3
+cts_request_seconds_sum{endpoint="/v1/order"} 3.55
+cts_request_seconds_count{endpoint="/v1/order"} 3
+# HELP cts_up Whether it is up.
+# TYPE cts_up gauge
+cts_up 1
+`)
+
+		w := httptest.NewRecorder()
+		r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		c.So(w.Header().Get("Content-Type"), ShouldStartWith, "text/plain; version=0.0.4")
+		c.So(w.Body.String(), ShouldContainSubstring, "cts_up 1\n")
+	})
+}
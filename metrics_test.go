@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/sim"
+	"github.com/modood/cts/strategy"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("should meter signals, orders, borrows and requests", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Fee = 0
+		e.Leverage = 3
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+
+		venue = e
+		defer func() { venue = fakeExchange{} }()
+		strategies = map[string]strategy.Strategy{"fake": fakeStrategy{}}
+		defer func() { strategies = strategy.Strategies() }()
+		bots = []*bot{{name: "metered", symbol: "doge_usdt", strategy: "fake"}}
+		defer func() { bots = nil }()
+
+		c.So(bots[0].step(ctx), ShouldBeNil)
+		c.So(meters.signals.Value("metered", "rise"), ShouldEqual, 1)
+		c.So(meters.orders.Value("metered", "doge_usdt", "buy-market"), ShouldEqual, 1)
+		c.So(meters.fills.Value("metered", "doge_usdt", "buy-market"), ShouldEqual, 1)
+		c.So(meters.lastCycle.Value("metered"), ShouldBeGreaterThan, 0)
+
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(track(s, "metered", "doge_usdt").Borrow("usdt", 30), ShouldBeNil)
+		c.So(meters.borrowed.Value("doge_usdt", "usdt"), ShouldEqual, 30)
+
+		bots[0].handle(errors.New("boom"))
+		c.So(meters.errors.Value("metered"), ShouldEqual, 1)
+
+		observe("huobi")("/v1/order/orders/{id}", time.Millisecond, errors.New("timeout"))
+		c.So(meters.requestErrors.Value("huobi", "/v1/order/orders/{id}"), ShouldEqual, 1)
+
+		// scrapes send no requests to the exchange
+		venue = nil
+		w := httptest.NewRecorder()
+		registry.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		body := w.Body.String()
+		c.So(body, ShouldContainSubstring, `cts_equity{symbol="doge_usdt",quote="usdt"} 100`)
+		c.So(body, ShouldContainSubstring, `cts_position{symbol="doge_usdt"} 50`)
+		c.So(body, ShouldContainSubstring, `cts_bot_paused{bot="metered"} 0`)
+		c.So(body, ShouldContainSubstring,
+			`cts_exchange_request_duration_seconds_count{exchange="huobi",endpoint="/v1/order/orders/{id}"} 1`)
+	})
+}
@@ -0,0 +1,68 @@
+package mock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// robot handle messages of dingtalk group chat robots
+func (s *Server) robot(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	token := q.Get("access_token")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, ok := s.robots[token]
+	if !ok {
+		reply(w, map[string]interface{}{"errcode": 300001, "errmsg": "token is not exist"})
+		return
+	}
+	if secret != "" && !s.signed(q.Get("timestamp"), q.Get("sign"), secret) {
+		reply(w, map[string]interface{}{"errcode": 310000, "errmsg": "sign not match"})
+		return
+	}
+
+	bs, err := ioutil.ReadAll(r.Body)
+	m := map[string]interface{}{}
+	if err == nil {
+		err = json.Unmarshal(bs, &m)
+	}
+	if err != nil {
+		reply(w, map[string]interface{}{"errcode": 43004, "errmsg": "invalid json"})
+		return
+	}
+
+	msg := Message{Token: token, Body: m}
+	msg.Type, _ = m["msgtype"].(string)
+	for _, k := range []string{"content", "text"} {
+		if v, ok := m[msg.Type].(map[string]interface{}); ok {
+			if t, ok := v[k].(string); ok {
+				msg.Text = t
+			}
+		}
+	}
+	s.messages = append(s.messages, msg)
+	reply(w, map[string]interface{}{"errcode": 0, "errmsg": "ok"})
+}
+
+// signed return whether a message is signed by secret within an hour
+func (s *Server) signed(timestamp, sign, secret string) bool {
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	d := s.Now().Sub(time.Unix(0, ms*int64(time.Millisecond)))
+	if d > time.Hour || d < -time.Hour {
+		return false
+	}
+
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp + "\n" + secret))
+	return hmac.Equal([]byte(sign), []byte(base64.StdEncoding.EncodeToString(h.Sum(nil))))
+}
@@ -0,0 +1,41 @@
+package mock
+
+import (
+	"net/http"
+	"strings"
+)
+
+// gateio handle tickers of gateio
+func (s *Server) gateio(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := strings.TrimPrefix(r.URL.Path, "/api2/1/")
+	switch {
+	case p == "tickers":
+		m := map[string]interface{}{}
+		for k, v := range s.tickers {
+			m[k] = pair(v)
+		}
+		reply(w, m)
+	case strings.HasPrefix(p, "ticker/"):
+		t, ok := s.tickers[strings.TrimPrefix(p, "ticker/")]
+		if !ok {
+			reply(w, map[string]interface{}{"result": "false", "code": 7, "message": "Error: Currency is not supported"})
+			return
+		}
+		reply(w, pair(t))
+	default:
+		reply(w, map[string]interface{}{"result": "false", "code": 1, "message": "Error: Invalid request"})
+	}
+}
+
+func pair(t Ticker) map[string]interface{} {
+	return map[string]interface{}{
+		"result":        "true",
+		"last":          t.Last,
+		"lowestAsk":     t.LowestAsk,
+		"highestBid":    t.HighestBid,
+		"percentChange": t.PercentChange,
+	}
+}
@@ -0,0 +1,627 @@
+package mock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/modood/cts/util"
+)
+
+type (
+	// Order is an order of huobi
+	Order struct {
+		ID              uint64  `json:"id"`
+		AccountID       uint64  `json:"account-id"`
+		ClientOrderID   string  `json:"client-order-id"`
+		Source          string  `json:"source"`
+		Symbol          string  `json:"symbol"` // e.g., dogeusdt
+		Type            string  `json:"type"`
+		State           string  `json:"state"`
+		Amount          float64 `json:"amount"`
+		Price           float64 `json:"price"`
+		FieldAmount     float64 `json:"field-amount"`
+		FieldCashAmount float64 `json:"field-cash-amount"`
+		FieldFees       float64 `json:"field-fees"`
+		CreatedAt       int64   `json:"created-at"`
+		CanceledAt      int64   `json:"canceled-at"`
+
+		key      string
+		symbol   string  // e.g., doge_usdt
+		currency string  // frozen by the order
+		frozen   float64 // until it is canceled
+	}
+
+	// Loan is a loan order of huobi, loan-amount is unpaid like loan-balance
+	Loan struct {
+		ID              uint64  `json:"id"`
+		State           string  `json:"state"` // accrual or cleared
+		AccountID       uint64  `json:"account-id"`
+		Symbol          string  `json:"symbol"`
+		Currency        string  `json:"currency"`
+		LoanAmount      float64 `json:"loan-amount"`
+		LoanBalance     float64 `json:"loan-balance"`
+		InterestAmount  float64 `json:"interest-amount"`
+		InterestBalance float64 `json:"interest-balance"`
+		CreatedAt       int64   `json:"created-at"`
+
+		key    string
+		symbol string
+	}
+
+	// apiError is an error of huobi, e.g., order-accountbalance-error
+	apiError struct {
+		code string
+		msg  string
+	}
+)
+
+// signTTL is how long a signed request is valid
+const signTTL = time.Minute * 5
+
+func (e *apiError) Error() string { return e.code + ": " + e.msg }
+
+func fail(code, format string, a ...interface{}) error {
+	return &apiError{code: code, msg: fmt.Sprintf(format, a...)}
+}
+
+// huobi handle signed requests of accounts and orders
+func (s *Server) huobi(w http.ResponseWriter, r *http.Request) {
+	data, err := s.serveHuobi(r)
+	if err != nil {
+		e, ok := err.(*apiError)
+		if !ok {
+			e = &apiError{code: "bad-request", msg: err.Error()}
+		}
+		reply(w, map[string]interface{}{"status": "error", "err-code": e.code, "err-msg": e.msg})
+		return
+	}
+	reply(w, map[string]interface{}{"status": "ok", "data": data})
+}
+
+func (s *Server) serveHuobi(r *http.Request) (interface{}, error) {
+	key, err := s.verify(r)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{}
+	if r.Method == http.MethodPost {
+		bs, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(bs) > 0 {
+			if err = json.Unmarshal(bs, &params); err != nil {
+				return nil, fail("invalid-parameter", "%v", err)
+			}
+		}
+	} else {
+		for k, v := range r.URL.Query() {
+			params[k] = v[0]
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := r.URL.Path
+	var id uint64
+	if ss := strings.Split(p, "/"); len(ss) > 4 {
+		id, _ = strconv.ParseUint(ss[4], 10, 64)
+	}
+	switch r.Method + " " + util.Endpoint(p) {
+	case "GET /v1/common/symbols":
+		return s.symbols(), nil
+	case "GET /v1/common/exchange":
+		symbol, err := s.symbol(params["symbol"])
+		if err != nil {
+			return nil, err
+		}
+		return s.limit(symbol), nil
+	case "GET /v1/margin/accounts/balance":
+		return s.balances(key, params["symbol"])
+	case "GET /v1/order/matchresults":
+		return s.matches(key, params["symbol"]), nil
+	case "GET /v1/order/orders":
+		return s.openOrders(key, params["symbol"], params["states"]), nil
+	case "GET /v1/order/orders/getClientOrder":
+		for _, v := range s.orders {
+			if v.key == key && v.ClientOrderID == params["clientOrderId"] {
+				return v, nil
+			}
+		}
+		return nil, fail("base-record-invalid", "order not found")
+	case "GET /v1/order/orders/{id}":
+		return s.order(key, id)
+	case "POST /v1/order/orders/place":
+		return s.place(key, params)
+	case "POST /v1/order/orders/{id}/submitcancel":
+		return s.cancel(key, id)
+	case "GET /v1/margin/loan-orders":
+		return s.loanOrders(key, params["symbol"], params["states"]), nil
+	case "POST /v1/margin/orders":
+		return s.borrow(key, params)
+	case "POST /v1/margin/orders/{id}/repay":
+		return s.repay(key, id, params["amount"])
+	}
+	return nil, fail("invalid-command", "%s %s", r.Method, p)
+}
+
+// verify return the api key of a request signed by its secret
+func (s *Server) verify(r *http.Request) (string, error) {
+	q := r.URL.Query()
+	signature := q.Get("Signature")
+	q.Del("Signature")
+
+	key := q.Get("AccessKeyId")
+	s.mu.Lock()
+	secret, ok := s.keys[key]
+	s.mu.Unlock()
+	if !ok {
+		return "", fail("api-signature-not-valid", "unknown access key: %q", key)
+	}
+
+	ts, err := time.Parse("2006-01-02T15:04:05", q.Get("Timestamp"))
+	if err != nil || math.Abs(float64(s.Now().Sub(ts))) > float64(signTTL) {
+		return "", fail("api-signature-not-valid", "invalid timestamp: %q", q.Get("Timestamp"))
+	}
+
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = url.QueryEscape(k) + "=" + url.QueryEscape(q.Get(k))
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(r.Method + "\n" + host + "\n" + r.URL.EscapedPath() + "\n" + strings.Join(pairs, "&")))
+	want := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	if !hmac.Equal([]byte(signature), []byte(want)) {
+		return "", fail("api-signature-not-valid", "signature mismatch")
+	}
+	return key, nil
+}
+
+// symbol return the symbol of a huobi name, e.g., doge_usdt of dogeusdt
+func (s *Server) symbol(name string) (string, error) {
+	for k := range s.tickers {
+		if strings.Replace(k, "_", "", 1) == name {
+			return k, nil
+		}
+	}
+	return "", fail("base-symbol-error", "invalid symbol: %q", name)
+}
+
+func (s *Server) symbols() []map[string]interface{} {
+	r := []map[string]interface{}{}
+	for k := range s.tickers {
+		base, quote := currencies(k)
+		r = append(r, map[string]interface{}{
+			"base-currency":    base,
+			"quote-currency":   quote,
+			"price-precision":  8,
+			"amount-precision": 4,
+			"symbol-partition": "main",
+		})
+	}
+	return r
+}
+
+// debt return unpaid loans and interest of currency
+func (s *Server) debt(key, symbol, currency string) (loan, interest float64) {
+	for _, v := range s.loans {
+		if v.key == key && v.symbol == symbol && v.Currency == currency {
+			loan += v.LoanBalance
+			interest += v.InterestBalance
+		}
+	}
+	return loan, interest
+}
+
+// value return assets and debts of the margin account in quote currency
+func (s *Server) value(key, symbol string) (assets, debts float64) {
+	a := s.account(key, symbol)
+	base, quote := currencies(symbol)
+	price := s.tickers[symbol].Last
+	assets = a.balances[quote] + a.frozen[quote] + (a.balances[base]+a.frozen[base])*price
+
+	l, i := s.debt(key, symbol, quote)
+	debts = l + i
+	l, i = s.debt(key, symbol, base)
+	debts += (l + i) * price
+	return assets, debts
+}
+
+// available return how much currency can be borrowed
+func (s *Server) available(key, symbol, currency string) float64 {
+	assets, debts := s.value(key, symbol)
+	avail := (assets-debts)*(s.Leverage-1) - debts
+	if base, _ := currencies(symbol); currency == base {
+		avail /= s.tickers[symbol].Last
+	}
+	return math.Max(avail, 0)
+}
+
+func (s *Server) balances(key, name string) (interface{}, error) {
+	symbol, err := s.symbol(name)
+	if err != nil {
+		return nil, err
+	}
+
+	a := s.account(key, symbol)
+	base, quote := currencies(symbol)
+	var list []map[string]interface{}
+	for _, c := range []string{base, quote} {
+		loan, interest := s.debt(key, symbol, c)
+		for _, v := range []struct {
+			typ     string
+			balance float64
+		}{
+			{"trade", a.balances[c]},
+			{"frozen", a.frozen[c]},
+			{"loan", loan},
+			{"interest", interest},
+			{"transfer-out-available", a.balances[c]},
+			{"loan-available", s.available(key, symbol, c)},
+		} {
+			list = append(list, map[string]interface{}{"currency": c, "type": v.typ, "balance": v.balance})
+		}
+	}
+
+	var risk float64
+	if assets, debts := s.value(key, symbol); debts > 0 {
+		risk = assets / debts
+	}
+	return []map[string]interface{}{{
+		"id":        a.id,
+		"type":      "margin",
+		"state":     "working",
+		"symbol":    name,
+		"risk-rate": risk,
+		"list":      list,
+	}}, nil
+}
+
+func (s *Server) order(key string, id uint64) (*Order, error) {
+	for _, v := range s.orders {
+		if v.key == key && v.ID == id {
+			return v, nil
+		}
+	}
+	return nil, fail("base-record-invalid", "order not found: %d", id)
+}
+
+func (s *Server) openOrders(key, name, states string) []*Order {
+	r := []*Order{}
+	for _, v := range s.orders {
+		if v.key == key && (name == "" || v.Symbol == name) && in(v.State, states) {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+func (s *Server) matches(key, name string) []map[string]interface{} {
+	r := []map[string]interface{}{}
+	for _, v := range s.orders {
+		if v.key != key || v.Symbol != name || v.FieldAmount == 0 {
+			continue
+		}
+		r = append(r, map[string]interface{}{
+			"id":            v.ID,
+			"order-id":      v.ID,
+			"match-id":      v.ID,
+			"symbol":        v.Symbol,
+			"type":          v.Type,
+			"price":         v.FieldCashAmount / v.FieldAmount,
+			"filled-amount": v.FieldAmount,
+			"filled-fees":   v.FieldFees,
+			"created-at":    v.CreatedAt,
+		})
+	}
+	return r
+}
+
+// place place an order, market orders are filled at once by the ratio of
+// SetFill, limit orders are never filled
+func (s *Server) place(key string, params map[string]string) (interface{}, error) {
+	symbol, err := s.symbol(params["symbol"])
+	if err != nil {
+		return nil, err
+	}
+	a := s.account(key, symbol)
+	if params["account-id"] != strconv.FormatUint(a.id, 10) {
+		return nil, fail("account-get-accounts-inexist-error", "invalid account-id: %q", params["account-id"])
+	}
+	cid := params["client-order-id"]
+	for _, v := range s.orders {
+		if cid != "" && v.key == key && v.ClientOrderID == cid {
+			return nil, fail("invalid-client-order-id", "duplicate client-order-id: %q", cid)
+		}
+	}
+	amount, err := strconv.ParseFloat(params["amount"], 64)
+	if err != nil || amount <= 0 {
+		return nil, fail("invalid-parameter", "invalid amount: %q", params["amount"])
+	}
+
+	base, quote := currencies(symbol)
+	t := s.tickers[symbol]
+	l := s.limit(symbol)
+	s.nextID++
+	o := &Order{
+		ID:            s.nextID,
+		AccountID:     a.id,
+		ClientOrderID: cid,
+		Source:        params["source"],
+		Symbol:        params["symbol"],
+		Type:          params["type"],
+		State:         "submitted",
+		Amount:        amount,
+		CreatedAt:     s.Now().UnixNano() / int64(time.Millisecond),
+		key:           key,
+		symbol:        symbol,
+	}
+
+	switch o.Type {
+	case "buy-market":
+		if amount < l.BuyGT || amount > l.BuyLT {
+			return nil, fail("order-marketorder-amount-error", "amount out of limit: %v", amount)
+		}
+		if a.balances[quote] < amount {
+			return nil, fail("order-accountbalance-error", "insufficient %s", quote)
+		}
+		cash := amount * s.fill
+		o.FieldCashAmount = cash
+		o.FieldAmount = cash / t.LowestAsk
+		o.FieldFees = o.FieldAmount * s.Fee
+		o.currency, o.frozen = quote, amount-cash
+		a.balances[quote] -= amount
+		a.balances[base] += o.FieldAmount - o.FieldFees
+	case "sell-market":
+		if amount < l.SellGT || amount > l.SellLT {
+			return nil, fail("order-marketorder-amount-error", "amount out of limit: %v", amount)
+		}
+		if a.balances[base] < amount {
+			return nil, fail("order-accountbalance-error", "insufficient %s", base)
+		}
+		o.FieldAmount = amount * s.fill
+		o.FieldCashAmount = o.FieldAmount * t.HighestBid
+		o.FieldFees = o.FieldCashAmount * s.Fee
+		o.currency, o.frozen = base, amount-o.FieldAmount
+		a.balances[base] -= amount
+		a.balances[quote] += o.FieldCashAmount - o.FieldFees
+	case "buy-limit", "sell-limit":
+		price, err := strconv.ParseFloat(params["price"], 64)
+		if err != nil || price <= 0 {
+			return nil, fail("invalid-parameter", "invalid price: %q", params["price"])
+		}
+		o.Price = price
+		o.currency, o.frozen = base, amount
+		if o.Type == "buy-limit" {
+			o.currency, o.frozen = quote, amount*price
+		}
+		if a.balances[o.currency] < o.frozen {
+			return nil, fail("order-accountbalance-error", "insufficient %s", o.currency)
+		}
+		a.balances[o.currency] -= o.frozen
+	default:
+		return nil, fail("invalid-parameter", "invalid type: %q", o.Type)
+	}
+	a.frozen[o.currency] += o.frozen
+
+	if o.FieldAmount > 0 {
+		o.State = "partial-filled"
+		if o.frozen == 0 {
+			o.State = "filled"
+		}
+	}
+	s.orders = append(s.orders, o)
+	return strconv.FormatUint(o.ID, 10), nil
+}
+
+func (s *Server) cancel(key string, id uint64) (interface{}, error) {
+	o, err := s.order(key, id)
+	if err != nil {
+		return nil, err
+	}
+	if !in(o.State, "submitted,partial-filled") {
+		return nil, fail("order-orderstate-error", "order is %s", o.State)
+	}
+
+	a := s.account(key, o.symbol)
+	a.frozen[o.currency] -= o.frozen
+	a.balances[o.currency] += o.frozen
+	o.frozen = 0
+	o.State = "canceled"
+	if o.FieldAmount > 0 {
+		o.State = "partial-canceled"
+	}
+	o.CanceledAt = s.Now().UnixNano() / int64(time.Millisecond)
+	return strconv.FormatUint(o.ID, 10), nil
+}
+
+func (s *Server) loanOrders(key, name, states string) []*Loan {
+	r := []*Loan{}
+	for _, v := range s.loans {
+		if v.key == key && v.Symbol == name && (states == "" || in(v.State, states)) {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+func (s *Server) borrow(key string, params map[string]string) (interface{}, error) {
+	symbol, err := s.symbol(params["symbol"])
+	if err != nil {
+		return nil, err
+	}
+	currency := params["currency"]
+	if base, quote := currencies(symbol); currency != base && currency != quote {
+		return nil, fail("base-currency-error", "invalid currency: %q", currency)
+	}
+	amount, err := strconv.ParseFloat(params["amount"], 64)
+	if err != nil || amount <= 0 {
+		return nil, fail("invalid-parameter", "invalid amount: %q", params["amount"])
+	}
+	if amount > s.available(key, symbol, currency) {
+		return nil, fail("account-loan-balance-insufficient-error", "insufficient loan-available")
+	}
+
+	a := s.account(key, symbol)
+	s.nextID++
+	l := &Loan{
+		ID:          s.nextID,
+		State:       "accrual",
+		AccountID:   a.id,
+		Symbol:      params["symbol"],
+		Currency:    currency,
+		LoanAmount:  amount,
+		LoanBalance: amount,
+		CreatedAt:   s.Now().UnixNano() / int64(time.Millisecond),
+		key:         key,
+		symbol:      symbol,
+	}
+	s.loans = append(s.loans, l)
+	a.balances[currency] += amount
+	return l.ID, nil
+}
+
+// repay repay a loan by amount at most, interest first
+func (s *Server) repay(key string, id uint64, amount string) (interface{}, error) {
+	var l *Loan
+	for _, v := range s.loans {
+		if v.key == key && v.ID == id && v.State == "accrual" {
+			l = v
+		}
+	}
+	if l == nil {
+		return nil, fail("base-record-invalid", "loan not found: %d", id)
+	}
+	pay, err := strconv.ParseFloat(amount, 64)
+	if err != nil || pay <= 0 {
+		return nil, fail("invalid-parameter", "invalid amount: %q", amount)
+	}
+
+	a := s.account(key, l.symbol)
+	pay = math.Min(pay, l.LoanBalance+l.InterestBalance)
+	if a.balances[l.Currency] < pay {
+		return nil, fail("account-repay-balance-insufficient-error", "insufficient %s", l.Currency)
+	}
+	a.balances[l.Currency] -= pay
+
+	interest := math.Min(pay, l.InterestBalance)
+	l.InterestBalance -= interest
+	l.InterestAmount = l.InterestBalance
+	l.LoanBalance -= pay - interest
+	l.LoanAmount = l.LoanBalance
+	if l.LoanBalance <= 0 && l.InterestBalance <= 0 {
+		l.State = "cleared"
+	}
+	return l.ID, nil
+}
+
+// market handle public market data of huobi
+func (s *Server) market(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	symbol, err := s.symbol(q.Get("symbol"))
+	if err != nil {
+		e := err.(*apiError)
+		reply(w, map[string]interface{}{"status": "error", "err-code": e.code, "err-msg": e.msg})
+		return
+	}
+	t := s.tickers[symbol]
+	now := s.Now()
+	ms := now.UnixNano() / int64(time.Millisecond)
+	size, _ := strconv.Atoi(q.Get("size"))
+
+	m := map[string]interface{}{"status": "ok", "ts": ms}
+	switch r.URL.Path {
+	case "/market/detail/merged":
+		m["tick"] = map[string]interface{}{
+			"id": ms, "open": t.Last, "close": t.Last, "low": t.Last, "high": t.Last,
+			"amount": 0, "vol": 0, "count": 0,
+			"bid": []float64{t.HighestBid, 1}, "ask": []float64{t.LowestAsk, 1},
+		}
+	case "/market/depth":
+		m["tick"] = map[string]interface{}{
+			"ts": ms, "version": ms,
+			"bids": [][]float64{{t.HighestBid, 1}}, "asks": [][]float64{{t.LowestAsk, 1}},
+		}
+	case "/market/history/kline":
+		// flat klines of the last price, newest first
+		d := period(q.Get("period"))
+		var ks []map[string]interface{}
+		for i := 0; i < size; i++ {
+			ks = append(ks, map[string]interface{}{
+				"id": now.Truncate(d).Add(-d * time.Duration(i)).Unix(), "open": t.Last,
+				"close": t.Last, "low": t.Last, "high": t.Last, "amount": 0, "vol": 0, "count": 0,
+			})
+		}
+		m["data"] = ks
+	case "/market/history/trade":
+		var ts []map[string]interface{}
+		for i := 0; i < size; i++ {
+			ts = append(ts, map[string]interface{}{"data": []map[string]interface{}{{
+				"id": i + 1, "ts": ms, "price": t.Last, "amount": 1, "direction": "buy",
+			}}})
+		}
+		m["data"] = ts
+	default:
+		m = map[string]interface{}{"status": "error", "err-code": "invalid-command", "err-msg": r.URL.Path}
+	}
+	reply(w, m)
+}
+
+// period return the duration of a kline period, e.g., 1min
+func period(p string) time.Duration {
+	switch p {
+	case "5min":
+		return time.Minute * 5
+	case "15min":
+		return time.Minute * 15
+	case "30min":
+		return time.Minute * 30
+	case "60min":
+		return time.Hour
+	case "1day":
+		return time.Hour * 24
+	case "1week":
+		return time.Hour * 24 * 7
+	case "1mon":
+		return time.Hour * 24 * 30
+	case "1year":
+		return time.Hour * 24 * 365
+	}
+	return time.Minute
+}
+
+// in return whether v is one of comma separated values
+func in(v, values string) bool {
+	for _, s := range strings.Split(values, ",") {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,322 @@
+package mock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/modood/cts/util"
+)
+
+type (
+	// Server is a fake of the huobi, gateio and dingtalk APIs, so that tests
+	// need no network. every symbol of every api key has an isolated margin
+	// account, and market orders are filled at once by tickers.
+	Server struct {
+		*httptest.Server
+
+		Fee      float64          // taker fee rate, 0.002 by default
+		Leverage float64          // loans are at most equity * (Leverage - 1), 3 by default
+		Now      func() time.Time // clock, time.Now by default
+
+		mu       sync.Mutex
+		keys     map[string]string // secrets of huobi by api key
+		robots   map[string]string // secrets of dingtalk by access token, unsigned if empty
+		tickers  map[string]Ticker // by symbol, e.g., doge_usdt
+		limits   map[string]Limit
+		accounts map[string]*account // by api key and symbol
+		orders   []*Order
+		loans    []*Loan
+		messages []Message
+		faults   map[string][]*Fault
+		requests map[string]int // by endpoint
+		fill     float64
+		nextID   uint64
+	}
+
+	// Ticker is a ticker of gateio, which also prices orders of huobi
+	Ticker struct {
+		Last          float64 `json:"last"`
+		LowestAsk     float64 `json:"lowestAsk"`
+		HighestBid    float64 `json:"highestBid"`
+		PercentChange float64 `json:"percentChange"`
+	}
+
+	// Limit is the trade limit of market orders of a symbol
+	Limit struct {
+		BuyGT  float64 `json:"market-buy-order-must-greater-than"`
+		BuyLT  float64 `json:"market-buy-order-must-less-than"`
+		SellGT float64 `json:"market-sell-order-must-greater-than"`
+		SellLT float64 `json:"market-sell-order-must-less-than"`
+	}
+
+	// Fault is a scripted failure of requests to an endpoint
+	Fault struct {
+		// Delay is the latency of the response, the request is handled
+		// before it even if the client gives up, e.g., an order is placed
+		// but the response is lost
+		Delay time.Duration
+
+		Status int    // responded with Body instead of handling the request if not 0
+		Body   string // e.g., a huobi error
+		Times  int    // how many requests it applies to, all if 0
+	}
+
+	// Message is a message received by a dingtalk robot
+	Message struct {
+		Token string
+		Type  string                 // msgtype, e.g., text
+		Text  string                 // content of text, or text of markdown and action cards
+		Body  map[string]interface{} // the whole message
+	}
+
+	account struct {
+		id       uint64
+		balances map[string]float64
+		frozen   map[string]float64
+	}
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// NewServer start a fake server, which should be closed by Close
+func NewServer() *Server {
+	s := &Server{
+		Fee:      0.002,
+		Leverage: 3,
+		Now:      time.Now,
+		keys:     map[string]string{},
+		robots:   map[string]string{},
+		tickers:  map[string]Ticker{},
+		limits:   map[string]Limit{},
+		accounts: map[string]*account{},
+		faults:   map[string][]*Fault{},
+		requests: map[string]int{},
+		fill:     1,
+		nextID:   100000, // ids of at least 3 digits are {id} of endpoints
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/", s.huobi)
+	mux.HandleFunc("/market/", s.market)
+	mux.HandleFunc("/api2/1/", s.gateio)
+	mux.HandleFunc("/robot/send", s.robot)
+	s.Server = httptest.NewServer(s.inject(mux))
+	return s
+}
+
+// AddKey add a huobi api key
+func (s *Server) AddKey(key, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key] = secret
+}
+
+// AddRobot add a dingtalk robot, whose messages must be signed by secret
+// unless it is empty
+func (s *Server) AddRobot(token, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.robots[token] = secret
+}
+
+// SetTicker set the ticker of a symbol, e.g., doge_usdt, which is also
+// tradable on huobi. LowestAsk and HighestBid are Last if 0.
+func (s *Server) SetTicker(symbol string, t Ticker) {
+	if t.LowestAsk == 0 {
+		t.LowestAsk = t.Last
+	}
+	if t.HighestBid == 0 {
+		t.HighestBid = t.Last
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tickers[symbol] = t
+}
+
+// SetLimit set the trade limit of a symbol, which is 1 - 1000000 of both
+// currencies by default
+func (s *Server) SetLimit(symbol string, l Limit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limits[symbol] = l
+}
+
+// SetFill set the ratio of market orders filled at once, the rest is never
+// filled until the order is canceled. it is 1 by default.
+func (s *Server) SetFill(ratio float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fill = ratio
+}
+
+// Inject script a fault of requests to an endpoint, whose ids are {id},
+// e.g., /v1/order/orders/{id}. faults of an endpoint apply in order.
+func (s *Server) Inject(endpoint string, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults[endpoint] = append(s.faults[endpoint], &f)
+}
+
+// Deposit add amount of currency to the margin account of a symbol
+func (s *Server) Deposit(key, symbol, currency string, amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.account(key, symbol).balances[currency] += amount
+}
+
+// Balance return the trade balance of currency of the margin account
+func (s *Server) Balance(key, symbol, currency string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.account(key, symbol).balances[currency]
+}
+
+// Debt return the unpaid loans and interest of currency of the margin account
+func (s *Server) Debt(key, symbol, currency string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var d float64
+	for _, v := range s.loans {
+		if v.key == key && v.symbol == symbol && v.Currency == currency {
+			d += v.LoanBalance + v.InterestBalance
+		}
+	}
+	return d
+}
+
+// Orders return copies of all orders of an api key, oldest first
+func (s *Server) Orders(key string) []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var r []Order
+	for _, v := range s.orders {
+		if v.key == key {
+			r = append(r, *v)
+		}
+	}
+	return r
+}
+
+// Requests return how many requests of an endpoint have been received,
+// e.g., /v1/order/orders/place
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[endpoint]
+}
+
+// Messages return messages received by robots, oldest first
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// inject apply faults before requests are handled
+func (s *Server) inject(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := s.fault(util.Endpoint(r.URL.Path))
+		if f == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		if f.Status != 0 {
+			rec.WriteHeader(f.Status)
+			rec.WriteString(f.Body)
+		} else {
+			h.ServeHTTP(rec, r)
+		}
+		select {
+		case <-time.After(f.Delay):
+		case <-r.Context().Done(): // the client has given up
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	})
+}
+
+// fault count a request and take the next fault of its endpoint, nil if
+// none
+func (s *Server) fault(endpoint string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[endpoint]++
+	fs := s.faults[endpoint]
+	if len(fs) == 0 {
+		return nil
+	}
+	f := *fs[0]
+	if fs[0].Times > 0 {
+		if fs[0].Times--; fs[0].Times == 0 {
+			s.faults[endpoint] = fs[1:]
+		}
+	}
+	return &f
+}
+
+// account return the margin account of a symbol, it must be called with mu
+// locked
+func (s *Server) account(key, symbol string) *account {
+	k := key + "/" + symbol
+	a, ok := s.accounts[k]
+	if !ok {
+		s.nextID++
+		a = &account{
+			id:       s.nextID,
+			balances: map[string]float64{},
+			frozen:   map[string]float64{},
+		}
+		s.accounts[k] = a
+	}
+	return a
+}
+
+// limit return the trade limit of a symbol, it must be called with mu locked
+func (s *Server) limit(symbol string) Limit {
+	if l, ok := s.limits[symbol]; ok {
+		return l
+	}
+	return Limit{BuyGT: 1, BuyLT: 1000000, SellGT: 1, SellLT: 1000000}
+}
+
+// currencies return base and quote currencies of a symbol, e.g., doge_usdt
+func currencies(symbol string) (base, quote string) {
+	ss := strings.SplitN(symbol, "_", 2)
+	if len(ss) != 2 {
+		return symbol, ""
+	}
+	return ss[0], ss[1]
+}
+
+func reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	bs, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(bs)
+}
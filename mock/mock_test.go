@@ -0,0 +1,191 @@
+package mock
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/dingtalk"
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/huobi"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+func TestGateio(t *testing.T) {
+	Convey("should serve tickers of gateio", t, func(c C) {
+		s := NewServer()
+		defer s.Close()
+		s.SetTicker("doge_usdt", Ticker{Last: 0.002, PercentChange: 1.5})
+		s.SetTicker("xrp_usdt", Ticker{Last: 0.5, PercentChange: -2})
+
+		g := gateio.NewClient(s.URL, nil)
+		p, err := g.Ticker(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(p.Result, ShouldBeTrue)
+		c.So(p.Last, ShouldEqual, 0.002)
+		c.So(p.LowestAsk, ShouldEqual, 0.002)
+
+		_, err = g.Ticker(ctx, "abc_usdt")
+		c.So(errors.Is(err, gateio.ErrUnsupported), ShouldBeTrue)
+
+		rise, fall, err := g.Trend(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(rise, ShouldEqual, 1)
+		c.So(fall, ShouldEqual, 1)
+	})
+}
+
+func TestHuobi(t *testing.T) {
+	Convey("should verify signatures of huobi", t, func(c C) {
+		s := NewServer()
+		defer s.Close()
+		s.AddKey("key", "secret")
+		s.SetTicker("doge_usdt", Ticker{Last: 0.002})
+
+		ss, err := huobi.NewClient(s.URL, "key", "secret", nil, nil).Symbols(ctx)
+		c.So(err, ShouldBeNil)
+		c.So(ss, ShouldHaveLength, 1)
+		c.So(ss[0].BaseCurrency, ShouldEqual, "doge")
+
+		_, err = huobi.NewClient(s.URL, "key", "wrong", nil, nil).Symbols(ctx)
+		c.So(errors.Is(err, huobi.ErrInvalidSignature), ShouldBeTrue)
+		_, err = huobi.NewClient(s.URL, "nobody", "secret", nil, nil).Symbols(ctx)
+		c.So(errors.Is(err, huobi.ErrInvalidSignature), ShouldBeTrue)
+
+		// signatures expire
+		old := func() time.Time { return time.Now().Add(-time.Hour) }
+		_, err = huobi.NewClient(s.URL, "key", "secret", nil, old).Symbols(ctx)
+		c.So(errors.Is(err, huobi.ErrInvalidSignature), ShouldBeTrue)
+	})
+
+	Convey("should trade with the margin account of huobi", t, func(c C) {
+		s := NewServer()
+		defer s.Close()
+		s.AddKey("key", "secret")
+		s.SetTicker("doge_usdt", Ticker{Last: 0.002, LowestAsk: 0.0025, HighestBid: 0.002})
+		s.Deposit("key", "doge_usdt", "usdt", 100)
+
+		h := huobi.NewClient(s.URL, "key", "secret", nil, nil)
+		sym, err := h.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		avail, err := sym.BorrowAvailable(ctx, "usdt")
+		c.So(err, ShouldBeNil)
+		c.So(avail, ShouldEqual, 200)
+		c.So(sym.Borrow(ctx, "usdt", 300), ShouldNotBeNil)
+		c.So(sym.Borrow(ctx, "usdt", 100), ShouldBeNil)
+		c.So(s.Debt("key", "doge_usdt", "usdt"), ShouldEqual, 100)
+
+		f, err := sym.Trade(ctx, "BUY", 200)
+		c.So(err, ShouldBeNil)
+		c.So(f.State, ShouldEqual, "filled")
+		c.So(f.FilledAmount, ShouldAlmostEqual, 80000)
+		c.So(f.Price, ShouldAlmostEqual, 0.0025)
+		c.So(s.Balance("key", "doge_usdt", "usdt"), ShouldEqual, 0)
+		c.So(s.Balance("key", "doge_usdt", "doge"), ShouldAlmostEqual, 80000*0.998)
+
+		_, err = sym.Trade(ctx, "BUY", 10)
+		c.So(errors.Is(err, huobi.ErrInsufficientBalance), ShouldBeTrue)
+
+		f, err = sym.Trade(ctx, "SELL", 79000)
+		c.So(err, ShouldBeNil)
+		c.So(f.FilledCashAmount, ShouldAlmostEqual, 158)
+		c.So(sym.Repay(ctx, "usdt"), ShouldBeNil)
+		c.So(s.Debt("key", "doge_usdt", "usdt"), ShouldEqual, 0)
+		c.So(s.Balance("key", "doge_usdt", "usdt"), ShouldAlmostEqual, 158*0.998-100)
+
+		bos, err := sym.BorrowOrders(ctx, "cleared")
+		c.So(err, ShouldBeNil)
+		c.So(bos, ShouldHaveLength, 1)
+		c.So(s.Orders("key"), ShouldHaveLength, 2)
+		c.So(s.Orders("other"), ShouldBeEmpty)
+	})
+
+	Convey("should keep an order placed once when its response is lost", t, func(c C) {
+		s := NewServer()
+		defer s.Close()
+		s.AddKey("key", "secret")
+		s.SetTicker("doge_usdt", Ticker{Last: 0.002})
+		s.Deposit("key", "doge_usdt", "usdt", 100)
+		s.Inject("/v1/order/orders/place", Fault{Delay: time.Millisecond * 500, Times: 1})
+
+		h := huobi.NewClient(s.URL, "key", "secret", &http.Client{Timeout: time.Millisecond * 100}, nil)
+		sym, err := h.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		f, err := sym.Trade(ctx, "BUY", 50)
+		c.So(err, ShouldBeNil)
+		c.So(f.State, ShouldEqual, "filled")
+		c.So(s.Orders("key"), ShouldHaveLength, 1)
+		c.So(s.Balance("key", "doge_usdt", "usdt"), ShouldEqual, 50)
+	})
+
+	Convey("should cancel the leftover of a partial fill", t, func(c C) {
+		s := NewServer()
+		defer s.Close()
+		s.AddKey("key", "secret")
+		s.SetTicker("doge_usdt", Ticker{Last: 0.002})
+		s.Deposit("key", "doge_usdt", "usdt", 100)
+		s.SetFill(0.5)
+
+		h := huobi.NewClient(s.URL, "key", "secret", nil, nil)
+		h.TradeTimeout = 0
+		sym, err := h.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		f, err := sym.Trade(ctx, "BUY", 100)
+		c.So(err, ShouldBeNil)
+		c.So(f.State, ShouldEqual, "partial-canceled")
+		c.So(f.FilledCashAmount, ShouldEqual, 50)
+		c.So(s.Balance("key", "doge_usdt", "usdt"), ShouldEqual, 50)
+	})
+
+	Convey("should respond with injected errors", t, func(c C) {
+		s := NewServer()
+		defer s.Close()
+		s.AddKey("key", "secret")
+		s.SetTicker("doge_usdt", Ticker{Last: 0.002})
+		s.Inject("/v1/common/symbols", Fault{
+			Status: http.StatusOK,
+			Body:   `{"status":"error","err-code":"gateway-internal-error","err-msg":"busy"}`,
+			Times:  1,
+		})
+
+		h := huobi.NewClient(s.URL, "key", "secret", nil, nil)
+		_, err := h.Symbols(ctx)
+		c.So(errors.Is(err, huobi.ErrBusy), ShouldBeTrue)
+		_, err = h.Symbols(ctx)
+		c.So(err, ShouldBeNil)
+	})
+}
+
+func TestRobot(t *testing.T) {
+	Convey("should receive messages of signed robots", t, func(c C) {
+		s := NewServer()
+		defer s.Close()
+		s.AddRobot("token", "secret")
+
+		d := dingtalk.NewClient(s.URL+"/robot/send", "token", "secret", nil, nil)
+		c.So(d.Push(ctx, "你好", false), ShouldBeNil)
+		c.So(d.PushMarkdown(ctx, "标题", "**加粗**", dingtalk.At{}), ShouldBeNil)
+
+		ms := s.Messages()
+		c.So(ms, ShouldHaveLength, 2)
+		c.So(ms[0].Token, ShouldEqual, "token")
+		c.So(ms[0].Type, ShouldEqual, dingtalk.TypeText)
+		c.So(ms[0].Text, ShouldEqual, "你好")
+		c.So(ms[1].Type, ShouldEqual, dingtalk.TypeMarkdown)
+		c.So(ms[1].Text, ShouldEqual, "**加粗**")
+
+		err := dingtalk.NewClient(s.URL+"/robot/send", "token", "wrong", nil, nil).Push(ctx, "x", false)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "sign not match")
+		err = dingtalk.NewClient(s.URL+"/robot/send", "nobody", "", nil, nil).Push(ctx, "x", false)
+		c.So(err, ShouldNotBeNil)
+		c.So(s.Messages(), ShouldHaveLength, 2)
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/modood/cts/config"
+	"github.com/modood/cts/dingtalk"
+	"github.com/modood/cts/notify"
+)
+
+// newNotifier return a router of all configured notifiers
+func newNotifier(cfg *config.Config) *notify.Router {
+	r := notify.NewRouter()
+	if cfg.DingTalk.Token != "" {
+		r.Add(notify.DingTalk{
+			Client:   dingtalk.NewClient("", cfg.DingTalk.Token, cfg.DingTalk.Secret, nil, nil),
+			Markdown: cfg.DingTalk.Format == "markdown",
+			Mobiles:  cfg.DingTalk.Mobiles,
+		}, cfg.DingTalk.Events...)
+	}
+	if cfg.Telegram.Token != "" {
+		r.Add(notify.Telegram{Token: cfg.Telegram.Token, ChatID: cfg.Telegram.ChatID},
+			cfg.Telegram.Events...)
+	}
+	if cfg.Slack.Webhook != "" {
+		r.Add(notify.Slack{Webhook: cfg.Slack.Webhook}, cfg.Slack.Events...)
+	}
+	if cfg.SMTP.Addr != "" {
+		r.Add(notify.SMTP{
+			Addr:     cfg.SMTP.Addr,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+			To:       cfg.SMTP.To,
+		}, cfg.SMTP.Events...)
+	}
+	if cfg.Webhook.URL != "" {
+		r.Add(notify.Webhook{URL: cfg.Webhook.URL}, cfg.Webhook.Events...)
+	}
+	return r
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/modood/cts/config"
+	"github.com/modood/cts/notify"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewNotifier(t *testing.T) {
+	Convey("should add configured notifiers only", t, func(c C) {
+		cfg := config.Default()
+		c.So(newNotifier(cfg).Len(), ShouldEqual, 0)
+
+		cfg.Telegram.Token, cfg.Telegram.ChatID = "123:abc", "42"
+		cfg.Slack.Webhook = "https://hooks.slack.com/services/x"
+		cfg.Slack.Events = []string{notify.Error}
+		c.So(newNotifier(cfg).Len(), ShouldEqual, 2)
+	})
+
+	Convey("should route events of the cron job and risk alerts", t, func(c C) {
+		f := &notify.Fake{}
+		alerts = notify.NewRouter()
+		alerts.Add(f, notify.Report)
+		defer func() { alerts = nil }()
+
+		alerts.Post(notify.Error, "boom", true)
+		alerts.Post(notify.Report, "report", false)
+		c.So(f.Messages(), ShouldResemble, []notify.Message{{Event: notify.Report, Text: "report"}})
+	})
+}
@@ -0,0 +1,217 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/modood/cts/dingtalk"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// DingTalk send messages by a group chat robot
+	DingTalk struct {
+		Client   *dingtalk.Client
+		Markdown bool     // send tables of dingtalk.Table instead of text
+		Mobiles  []string // mentioned by urgent messages instead of everyone
+	}
+
+	// Telegram send messages by a bot to a chat
+	Telegram struct {
+		Token  string
+		ChatID string
+		API    string // https://api.telegram.org if empty
+	}
+
+	// Slack send messages to an incoming webhook
+	Slack struct {
+		Webhook string
+	}
+
+	// SMTP send messages by email
+	SMTP struct {
+		Addr     string // host:port, e.g., smtp.example.com:587
+		Username string // no authentication if empty
+		Password string
+		From     string
+		To       []string
+	}
+
+	// Webhook post messages as JSON: {"event", "text", "urgent", "time"}
+	Webhook struct {
+		URL string
+	}
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	client = &http.Client{Timeout: time.Second * 5}
+)
+
+// Name return dingtalk
+func (DingTalk) Name() string { return "dingtalk" }
+
+// Send send a text or markdown message, mobiles or everyone are mentioned
+// if it is urgent
+func (d DingTalk) Send(m Message) error {
+	at := dingtalk.At{AtMobiles: []string{}}
+	if m.Urgent {
+		at.IsAtAll = len(d.Mobiles) == 0
+		if !at.IsAtAll {
+			at.AtMobiles = d.Mobiles
+		}
+	}
+
+	var err error
+	if d.Markdown {
+		title := "[" + m.Event + "] " + strings.SplitN(m.Text, "\n", 2)[0]
+		err = d.Client.PushMarkdown(context.Background(), title, dingtalk.Table(m.Text), at)
+	} else {
+		err = d.Client.Send(context.Background(), dingtalk.Message{
+			Type: dingtalk.TypeText,
+			Text: &dingtalk.Text{Content: m.Text},
+			At:   &at,
+		})
+	}
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// Name return telegram
+func (t Telegram) Name() string { return "telegram" }
+
+// Send send a text message, it is silent unless urgent
+func (t Telegram) Send(m Message) error {
+	api := t.API
+	if api == "" {
+		api = "https://api.telegram.org"
+	}
+	body := map[string]interface{}{
+		"chat_id":              t.ChatID,
+		"text":                 m.Text,
+		"disable_notification": !m.Urgent,
+	}
+	if err := post(api+"/bot"+t.Token+"/sendMessage", body); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// Name return slack
+func (s Slack) Name() string { return "slack" }
+
+// Send send a text message, the channel is mentioned if it is urgent
+func (s Slack) Send(m Message) error {
+	text := m.Text
+	if m.Urgent {
+		text = "<!channel> " + text
+	}
+	if err := post(s.Webhook, map[string]interface{}{"text": text}); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// Name return smtp
+func (s SMTP) Name() string { return "smtp" }
+
+// Send send a plain text email, whose subject is the event
+func (s SMTP) Send(m Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	err := smtp.SendMail(s.Addr, auth, s.From, s.To, s.message(m, time.Now()))
+	if err != nil {
+		return errors.Wrap(util.RedactError(err), util.FuncName())
+	}
+	return nil
+}
+
+func (s SMTP) message(m Message, now time.Time) []byte {
+	subject := "[cts] " + m.Event
+	if m.Urgent {
+		subject += " !"
+	}
+	first := strings.SplitN(m.Text, "\n", 2)[0]
+	if len(first) > 0 && len(first) <= 60 {
+		subject += ": " + first
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&b, "Subject: =?UTF-8?B?%s?=\r\n", encode(subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	enc := encode(m.Text)
+	for len(enc) > 76 {
+		b.WriteString(enc[:76] + "\r\n")
+		enc = enc[76:]
+	}
+	b.WriteString(enc + "\r\n")
+	return b.Bytes()
+}
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// Name return webhook
+func (w Webhook) Name() string { return "webhook" }
+
+// Send post a message as JSON
+func (w Webhook) Send(m Message) error {
+	body := map[string]interface{}{
+		"event":  m.Event,
+		"text":   m.Text,
+		"urgent": m.Urgent,
+		"time":   time.Now().Format(time.RFC3339),
+	}
+	if err := post(w.URL, body); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// post post JSON to url, a status other than 2xx is an error. urls of
+// backends usually contain tokens, so they are redacted from errors.
+func post(url string, body interface{}) error {
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(bs))
+	if err != nil {
+		return errors.Wrap(util.RedactError(err), util.FuncName())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(bs)))
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
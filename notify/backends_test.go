@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/dingtalk"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackends(t *testing.T) {
+	Convey("should post messages to http backends", t, func(c C) {
+		var path string
+		var body map[string]interface{}
+		status := http.StatusOK
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			bs, _ := ioutil.ReadAll(r.Body)
+			body = nil
+			json.Unmarshal(bs, &body)
+			w.WriteHeader(status)
+			w.Write([]byte(`{"ok":true}`))
+		}))
+		defer ts.Close()
+
+		m := Message{Event: Trade, Text: "buy doge", Urgent: true}
+
+		c.So(Telegram{Token: "123:abc", ChatID: "42", API: ts.URL}.Send(m), ShouldBeNil)
+		c.So(path, ShouldEqual, "/bot123:abc/sendMessage")
+		c.So(body["chat_id"], ShouldEqual, "42")
+		c.So(body["text"], ShouldEqual, "buy doge")
+		c.So(body["disable_notification"], ShouldEqual, false)
+
+		c.So(Slack{Webhook: ts.URL + "/services/x"}.Send(m), ShouldBeNil)
+		c.So(path, ShouldEqual, "/services/x")
+		c.So(body["text"], ShouldEqual, "<!channel> buy doge")
+
+		c.So(Webhook{URL: ts.URL + "/hook"}.Send(m), ShouldBeNil)
+		c.So(body["event"], ShouldEqual, Trade)
+		c.So(body["urgent"], ShouldEqual, true)
+
+		status = http.StatusForbidden
+		err := Webhook{URL: ts.URL}.Send(m)
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "403")
+	})
+}
+
+func TestDingTalk(t *testing.T) {
+	Convey("should send text or markdown to dingtalk", t, func(c C) {
+		var body map[string]interface{}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bs, _ := ioutil.ReadAll(r.Body)
+			body = nil
+			json.Unmarshal(bs, &body)
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}))
+		defer ts.Close()
+		cl := dingtalk.NewClient(ts.URL, "accesstoken", "", nil, nil)
+
+		m := Message{Event: Trade, Text: "2018-03-01 08:00:00\n类型：borrow", Urgent: true}
+		c.So(DingTalk{Client: cl}.Send(m), ShouldBeNil)
+		c.So(body["msgtype"], ShouldEqual, "text")
+		c.So(body["at"], ShouldResemble, map[string]interface{}{"atMobiles": []interface{}{}, "isAtAll": true})
+
+		c.So(DingTalk{Client: cl, Markdown: true, Mobiles: []string{"13800000000"}}.Send(m), ShouldBeNil)
+		c.So(body["msgtype"], ShouldEqual, "markdown")
+		md := body["markdown"].(map[string]interface{})
+		c.So(md["title"], ShouldEqual, "[trade] 2018-03-01 08:00:00")
+		c.So(md["text"], ShouldEqual, dingtalk.Table(m.Text)+"\n\n@13800000000")
+		c.So(body["at"], ShouldResemble, map[string]interface{}{
+			"atMobiles": []interface{}{"13800000000"}, "isAtAll": false})
+
+		m.Urgent = false
+		c.So(DingTalk{Client: cl, Markdown: true, Mobiles: []string{"13800000000"}}.Send(m), ShouldBeNil)
+		c.So(body["markdown"].(map[string]interface{})["text"], ShouldEqual, dingtalk.Table(m.Text))
+	})
+}
+
+func TestSMTPMessage(t *testing.T) {
+	Convey("should format an email", t, func(c C) {
+		s := SMTP{From: "cts@example.com", To: []string{"a@example.com", "b@example.com"}}
+		now := time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)
+		bs := s.message(Message{Event: Error, Text: "风控：doge_usdt 触发止损\n持仓：100"}, now)
+
+		msg := string(bs)
+		c.So(msg, ShouldContainSubstring, "To: a@example.com, b@example.com\r\n")
+		c.So(msg, ShouldContainSubstring, "Date: Thu, 01 Mar 2018 08:00:00 +0000\r\n")
+		c.So(msg, ShouldContainSubstring, "Subject: =?UTF-8?B?"+
+			base64.StdEncoding.EncodeToString([]byte("[cts] error: 风控：doge_usdt 触发止损"))+"?=\r\n")
+
+		parts := strings.SplitN(msg, "\r\n\r\n", 2)
+		text, err := base64.StdEncoding.DecodeString(strings.Replace(parts[1], "\r\n", "", -1))
+		c.So(err, ShouldBeNil)
+		c.So(string(text), ShouldEqual, "风控：doge_usdt 触发止损\n持仓：100")
+	})
+}
@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// Events
+const (
+	Trade  = "trade"  // orders, borrows and repays
+	Error  = "error"  // errors and risk alerts
+	Report = "report" // scheduled reports and the final state on exit
+)
+
+type (
+	// Message is a notification of an event
+	Message struct {
+		Event  string
+		Text   string
+		Urgent bool // mention everyone if the backend supports it
+	}
+
+	// Notifier is a notification backend
+	Notifier interface {
+		Name() string
+		Send(m Message) error
+	}
+
+	// Router send messages to notifiers which subscribe their events
+	Router struct {
+		mu     sync.RWMutex
+		routes []route
+	}
+
+	route struct {
+		n      Notifier
+		events map[string]bool // all events if empty
+	}
+
+	// Fake record messages instead of sending them, it is for tests
+	Fake struct {
+		Err error // returned by Send if not nil
+
+		mu       sync.Mutex
+		messages []Message
+	}
+)
+
+var (
+	errUnknownEvent = errors.New("unknown event, it should be trade, error or report")
+)
+
+// Events return all events
+func Events() []string {
+	return []string{Trade, Error, Report}
+}
+
+// CheckEvents return an error if any event is unknown
+func CheckEvents(events []string) error {
+	for _, v := range events {
+		ok := false
+		for _, e := range Events() {
+			ok = ok || v == e
+		}
+		if !ok {
+			err := fmt.Errorf("%v: %q", errUnknownEvent, v)
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+	return nil
+}
+
+// NewRouter return a router without notifiers
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Add subscribe events by a notifier, all events if none
+func (r *Router) Add(n Notifier, events ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rt := route{n: n, events: map[string]bool{}}
+	for _, v := range events {
+		rt.events[v] = true
+	}
+	r.routes = append(r.routes, rt)
+}
+
+// Len return the number of notifiers
+func (r *Router) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.routes)
+}
+
+// Send send a message to all notifiers of its event, secrets in the text are
+// redacted. it fails if any notifier fails, but all of them are tried.
+func (r *Router) Send(m Message) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m.Text = util.Redact(m.Text)
+	var errs []string
+	for _, v := range r.routes {
+		if len(v.events) != 0 && !v.events[m.Event] {
+			continue
+		}
+		if err := v.n.Send(m); err != nil {
+			errs = append(errs, v.n.Name()+": "+err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Wrap(errors.New(strings.Join(errs, "; ")), util.FuncName())
+	}
+	return nil
+}
+
+// Post send a message and log errors, the text is logged if there is no
+// notifier. it is safe to call on a nil router.
+func (r *Router) Post(event, text string, urgent bool) {
+	if r == nil || r.Len() == 0 {
+		log.Println(text)
+		return
+	}
+	if err := r.Send(Message{Event: event, Text: text, Urgent: urgent}); err != nil {
+		log.Println(err)
+	}
+}
+
+// Name return fake
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Send record a message
+func (f *Fake) Send(m Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.messages = append(f.messages, m)
+	return f.Err
+}
+
+// Messages return recorded messages
+func (f *Fake) Messages() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Message(nil), f.messages...)
+}
@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/modood/cts/util"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRouter(t *testing.T) {
+	Convey("should route messages by events", t, func(c C) {
+		all, trades, broken := &Fake{}, &Fake{}, &Fake{Err: errors.New("offline")}
+		r := NewRouter()
+		r.Add(all)
+		r.Add(trades, Trade)
+		r.Add(broken, Error)
+		c.So(r.Len(), ShouldEqual, 3)
+
+		c.So(r.Send(Message{Event: Trade, Text: "buy", Urgent: true}), ShouldBeNil)
+		c.So(r.Send(Message{Event: Report, Text: "report"}), ShouldBeNil)
+		err := r.Send(Message{Event: Error, Text: "boom"})
+		c.So(err, ShouldNotBeNil)
+		c.So(err.Error(), ShouldContainSubstring, "fake: offline")
+
+		c.So(all.Messages(), ShouldResemble, []Message{
+			{Event: Trade, Text: "buy", Urgent: true},
+			{Event: Report, Text: "report"},
+			{Event: Error, Text: "boom"},
+		})
+		c.So(trades.Messages(), ShouldResemble, []Message{{Event: Trade, Text: "buy", Urgent: true}})
+		c.So(len(broken.Messages()), ShouldEqual, 1)
+	})
+
+	Convey("should redact secrets", t, func(c C) {
+		util.AddSecret("notify-secret")
+		f := &Fake{}
+		r := NewRouter()
+		r.Add(f)
+		r.Post(Trade, "key: notify-secret", false)
+		c.So(f.Messages()[0].Text, ShouldEqual, "key: "+util.Redacted)
+
+		// nothing but logs
+		var nr *Router
+		nr.Post(Trade, "nobody", false)
+	})
+}
+
+func TestCheckEvents(t *testing.T) {
+	Convey("should check events", t, func(c C) {
+		c.So(CheckEvents(nil), ShouldBeNil)
+		c.So(CheckEvents([]string{Trade, Report}), ShouldBeNil)
+		c.So(CheckEvents([]string{"trades"}), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/notify"
+	"github.com/modood/cts/sim"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// newPaper return a simulated exchange priced by gateio realtime tickers,
+// which models huobi margin account: 3x leverage, 0.2% fee and
+// 0.098% daily interest. every symbol has its own capital, and the trade
+// limit of real if possible.
+func newPaper(ctx context.Context, symbols []string, capital float64, price sim.Pricer, real exchange.Exchange) (*sim.Exchange, error) {
+	e := sim.NewExchange(price)
+	e.Fee = 0.002
+	e.Leverage = 3
+	e.Interest = 0.00098
+	e.Notify = func(text string) { alerts.Post(notify.Trade, text, false) }
+
+	e.Limits = map[string]exchange.Limit{}
+	seen := map[string]bool{}
+	for _, symbol := range symbols {
+		if seen[symbol] {
+			// bots of the same symbol share an account
+			continue
+		}
+		seen[symbol] = true
+
+		s, err := e.Symbol(ctx, symbol)
+		if err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		if err = e.Deposit(symbol, s.QuoteCurrency(), capital); err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+
+		// use the real trade limit if possible
+		l := &exchange.Limit{}
+		if s, err = real.Symbol(ctx, symbol); err == nil {
+			l, err = s.Limit()
+		}
+		if err != nil {
+			log.Println("paper: no trade limit of huobi,", err)
+			continue
+		}
+		e.Limits[symbol] = *l
+	}
+
+	return e, nil
+}
+
+// paperReport return virtual positions of all symbols
+func paperReport(ctx context.Context, e *sim.Exchange) string {
+	ss, err := e.Symbols(ctx)
+	if err != nil {
+		return err.Error()
+	}
+
+	var r []string
+	for _, v := range ss {
+		s, err := e.Symbol(ctx, v)
+		if err != nil {
+			r = append(r, err.Error())
+			continue
+		}
+		msg, err := s.(*sim.Symbol).Report()
+		if err != nil {
+			r = append(r, err.Error())
+			continue
+		}
+		r = append(r, msg)
+	}
+	return strings.Join(r, "\n")
+}
+
+// paperJournal return the journal file of paper trading, which is name with
+// .paper inserted before its extension, e.g., .cts-journal.paper.jsonl
+func paperJournal(name string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + ".paper" + ext
+}
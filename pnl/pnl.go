@@ -0,0 +1,188 @@
+package pnl
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/journal"
+)
+
+type (
+	// Lot is an open part of a position, its price includes fees
+	Lot struct {
+		Time   time.Time
+		Amount float64 // base currency, negative if short
+		Price  float64 // quote currency per base currency
+	}
+
+	// Position is FIFO lots and P&L of a symbol, P&L is quote currency
+	Position struct {
+		Lots     []Lot
+		Realised float64 // fees and interest are deducted
+		Fees     float64
+		Interest float64
+		Closed   int // lots or parts of them closed by opposite fills
+		Wins     int // closed with profit, fees are deducted
+
+		last float64 // last fill price, which values interest of base currency
+	}
+
+	// Book is positions by symbol name, e.g., doge_usdt
+	Book struct {
+		Positions map[string]*Position
+	}
+
+	// Summary is P&L of positions, quote currency
+	Summary struct {
+		Realised   float64
+		Unrealised float64
+		Fees       float64
+		Interest   float64
+	}
+)
+
+// dust is the amount which is regarded as zero
+const dust = 1e-12
+
+// NewBook return an empty book
+func NewBook() *Book {
+	return &Book{Positions: map[string]*Position{}}
+}
+
+// Build return a book of fills and interest of journal entries, which are
+// in time order
+func Build(es []journal.Entry) *Book {
+	b := NewBook()
+	for _, e := range es {
+		b.Apply(e)
+	}
+	return b
+}
+
+// Apply add an order or a repay entry to the book, others are ignored
+func (b *Book) Apply(e journal.Entry) {
+	switch e.Kind {
+	case journal.Order:
+		if e.FilledAmount <= 0 {
+			return
+		}
+		buy := e.Type == exchange.Buy || strings.HasPrefix(e.Type, "buy")
+		b.Fill(e.Symbol, e.Time, buy, e.FilledAmount, e.FilledCashAmount, e.Fees)
+	case journal.Repay:
+		if e.Interest > 0 {
+			b.Pay(e.Symbol, e.Currency, e.Interest)
+		}
+	}
+}
+
+// Fill add a filled order, amount is base currency, cash is quote currency,
+// fees are in the received currency
+func (b *Book) Fill(symbol string, t time.Time, buy bool, amount, cash, fees float64) {
+	p := b.position(symbol)
+	p.last = cash / amount
+
+	if buy {
+		// fees of base currency make the received less expensive
+		received := amount - fees
+		p.Fees += fees * p.last
+		p.fill(t, received, cash/received)
+		return
+	}
+
+	p.Fees += fees
+	p.fill(t, -amount, (cash-fees)/amount)
+}
+
+// Pay add interest of a loan of a symbol, which is valued at the last fill
+// price if it is base currency
+func (b *Book) Pay(symbol, currency string, interest float64) {
+	p := b.position(symbol)
+	if !strings.HasSuffix(symbol, "_"+currency) {
+		interest *= p.last
+	}
+	p.Interest += interest
+	p.Realised -= interest
+}
+
+// Summary return P&L of all positions, prices are by symbol name, a
+// position without price has no unrealised P&L
+func (b *Book) Summary(prices map[string]float64) Summary {
+	var s Summary
+	for k, p := range b.Positions {
+		s.Realised += p.Realised
+		s.Fees += p.Fees
+		s.Interest += p.Interest
+		if price, ok := prices[k]; ok {
+			s.Unrealised += p.Unrealised(price)
+		}
+	}
+	return s
+}
+
+// Symbols return names of all positions, sorted
+func (b *Book) Symbols() []string {
+	r := make([]string, 0, len(b.Positions))
+	for k := range b.Positions {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (b *Book) position(symbol string) *Position {
+	p, ok := b.Positions[symbol]
+	if !ok {
+		p = &Position{}
+		b.Positions[symbol] = p
+	}
+	return p
+}
+
+// Amount return the open amount, base currency, negative if short
+func (p *Position) Amount() float64 {
+	var r float64
+	for _, v := range p.Lots {
+		r += v.Amount
+	}
+	return r
+}
+
+// Unrealised return P&L of open lots at price
+func (p *Position) Unrealised(price float64) float64 {
+	var r float64
+	for _, v := range p.Lots {
+		r += v.Amount * (price - v.Price)
+	}
+	return r
+}
+
+// fill close opposite lots first in, and open a lot by the rest
+func (p *Position) fill(t time.Time, amount, price float64) {
+	for len(p.Lots) > 0 && amount*p.Lots[0].Amount < 0 && math.Abs(amount) > dust {
+		l := &p.Lots[0]
+		n := math.Min(math.Abs(amount), math.Abs(l.Amount))
+		if l.Amount < 0 {
+			n = -n
+		}
+
+		// a long lot is sold at price, or a short lot is bought back
+		r := n * (price - l.Price)
+		p.Realised += r
+		p.Closed++
+		if r > 0 {
+			p.Wins++
+		}
+		l.Amount -= n
+		amount += n
+		if math.Abs(l.Amount) <= dust {
+			p.Lots = p.Lots[1:]
+		}
+	}
+
+	if math.Abs(amount) > dust {
+		p.Lots = append(p.Lots, Lot{Time: t, Amount: amount, Price: price})
+	}
+}
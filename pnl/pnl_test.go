@@ -0,0 +1,87 @@
+package pnl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/modood/cts/journal"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFill(t *testing.T) {
+	Convey("should realise P&L of FIFO lots", t, func(c C) {
+		now := time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)
+		b := NewBook()
+
+		// buy 100 at 1 and 100 at 2, no fees
+		b.Fill("doge_usdt", now, true, 100, 100, 0)
+		b.Fill("doge_usdt", now, true, 100, 200, 0)
+		p := b.Positions["doge_usdt"]
+		c.So(p.Amount(), ShouldEqual, 200)
+
+		// the first lot is sold first
+		b.Fill("doge_usdt", now, false, 150, 450, 0)
+		c.So(p.Realised, ShouldAlmostEqual, 100*2+50*1)
+		c.So(p.Lots, ShouldResemble, []Lot{{Time: now, Amount: 50, Price: 2}})
+		c.So(p.Unrealised(4), ShouldAlmostEqual, 100)
+
+		// reverse to a short of 50 at 3
+		b.Fill("doge_usdt", now, false, 100, 300, 0)
+		c.So(p.Realised, ShouldAlmostEqual, 250+50)
+		c.So(p.Amount(), ShouldAlmostEqual, -50)
+		c.So(p.Unrealised(2), ShouldAlmostEqual, 50)
+
+		// cover the short at 2
+		b.Fill("doge_usdt", now, true, 50, 100, 0)
+		c.So(p.Realised, ShouldAlmostEqual, 350)
+		c.So(p.Lots, ShouldBeEmpty)
+		c.So(p.Closed, ShouldEqual, 4)
+		c.So(p.Wins, ShouldEqual, 4)
+	})
+
+	Convey("should deduct fees and interest", t, func(c C) {
+		now := time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)
+		b := NewBook()
+
+		// buy 100 doge by 100 usdt, 1 doge of fees
+		b.Fill("doge_usdt", now, true, 100, 100, 1)
+		p := b.Positions["doge_usdt"]
+		c.So(p.Amount(), ShouldEqual, 99)
+		c.So(p.Fees, ShouldAlmostEqual, 1)
+
+		// sell 99 doge at 1, 0.99 usdt of fees
+		b.Fill("doge_usdt", now, false, 99, 99, 0.99)
+		c.So(p.Fees, ShouldAlmostEqual, 1.99)
+		c.So(p.Realised, ShouldAlmostEqual, -1.99)
+		c.So(p.Closed, ShouldEqual, 1)
+		c.So(p.Wins, ShouldEqual, 0)
+
+		b.Pay("doge_usdt", "usdt", 0.5)
+		b.Pay("doge_usdt", "doge", 1)
+		c.So(p.Interest, ShouldAlmostEqual, 1.5)
+		c.So(p.Realised, ShouldAlmostEqual, -3.49)
+	})
+}
+
+func TestBuild(t *testing.T) {
+	Convey("should build a book from journal entries", t, func(c C) {
+		now := time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)
+		b := Build([]journal.Entry{
+			{Time: now, Kind: journal.Signal, Symbol: "doge_usdt", Signal: "rise"},
+			{Time: now, Kind: journal.Order, Symbol: "doge_usdt", Type: "buy-market",
+				FilledAmount: 100, FilledCashAmount: 100},
+			{Time: now, Kind: journal.Order, Symbol: "doge_usdt", Type: "SELL", Error: "timeout"},
+			{Time: now, Kind: journal.Order, Symbol: "xrp_usdt", Type: "sell-market",
+				FilledAmount: 10, FilledCashAmount: 20},
+			{Time: now, Kind: journal.Repay, Symbol: "xrp_usdt", Currency: "xrp", Amount: 10, Interest: 0.1},
+		})
+		c.So(b.Symbols(), ShouldResemble, []string{"doge_usdt", "xrp_usdt"})
+		c.So(b.Positions["doge_usdt"].Amount(), ShouldEqual, 100)
+		c.So(b.Positions["xrp_usdt"].Amount(), ShouldEqual, -10)
+
+		s := b.Summary(map[string]float64{"doge_usdt": 1.5, "xrp_usdt": 1})
+		c.So(s.Unrealised, ShouldAlmostEqual, 50+10)
+		c.So(s.Interest, ShouldAlmostEqual, 0.2)
+		c.So(s.Realised, ShouldAlmostEqual, -0.2)
+	})
+}
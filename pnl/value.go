@@ -0,0 +1,101 @@
+package pnl
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/journal"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Valuation is the value of an account, whose quote currency is USDT
+	Valuation struct {
+		Equity   float64
+		Rate     float64 // CNY per USDT, 0 if unknown
+		Holdings []Holding
+	}
+
+	// Holding is the position of a symbol
+	Holding struct {
+		Symbol string
+		Amount float64 // base currency, negative if short
+		Price  float64
+		Equity float64
+	}
+)
+
+// Value return the valuation of symbols by name, e.g., doge_usdt. rate is
+// the exchange rate of USDT/CNY, e.g., Rate of a gateio.Client, its error is
+// not fatal but CNY is unknown.
+func Value(ss map[string]exchange.Symbol, rate func() (float64, error)) (*Valuation, error) {
+	names := make([]string, 0, len(ss))
+	for k := range ss {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	v := &Valuation{}
+	for _, k := range names {
+		pos, equity, price, err := exchange.Position(ss[k])
+		if err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		v.Equity += equity
+		v.Holdings = append(v.Holdings, Holding{Symbol: k, Amount: pos, Price: price, Equity: equity})
+	}
+
+	if rate != nil {
+		if r, err := rate(); err == nil {
+			v.Rate = r
+		}
+	}
+	return v, nil
+}
+
+// CNY return equity in CNY, 0 if the rate is unknown
+func (v *Valuation) CNY() float64 {
+	return v.Equity * v.Rate
+}
+
+// Exposure return the absolute value of all positions
+func (v *Valuation) Exposure() float64 {
+	var r float64
+	for _, h := range v.Holdings {
+		r += math.Abs(h.Amount * h.Price)
+	}
+	return r
+}
+
+// Prices return prices of holdings by symbol name
+func (v *Valuation) Prices() map[string]float64 {
+	r := map[string]float64{}
+	for _, h := range v.Holdings {
+		r[h.Symbol] = h.Price
+	}
+	return r
+}
+
+// Opening return the equity at the start of a day from equity entries of a
+// journal: the last one before the day, or the first one of the day
+func Opening(es []journal.Entry, day time.Time) (float64, bool) {
+	var r float64
+	var ok bool
+	for _, e := range es {
+		if e.Kind != journal.Equity {
+			continue
+		}
+		if e.Time.Before(day) {
+			r, ok = e.Amount, true
+			continue
+		}
+		if !ok {
+			return e.Amount, true
+		}
+		break
+	}
+	return r, ok
+}
@@ -0,0 +1,71 @@
+package pnl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/journal"
+	"github.com/modood/cts/sim"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+func TestValue(t *testing.T) {
+	Convey("should value an account in USDT and CNY", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Leverage = 3
+		e.Fee = 0
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		c.So(e.Deposit("xrp_usdt", "usdt", 100), ShouldBeNil)
+		doge, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+		xrp, err := e.Symbol(ctx, "xrp_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(doge.Borrow("usdt", 100), ShouldBeNil)
+		_, err = doge.Trade(exchange.Buy, 200)
+		c.So(err, ShouldBeNil)
+
+		ss := map[string]exchange.Symbol{"doge_usdt": doge, "xrp_usdt": xrp}
+		v, err := Value(ss, func() (float64, error) { return 6.5, nil })
+		c.So(err, ShouldBeNil)
+		c.So(v.Equity, ShouldAlmostEqual, 200)
+		c.So(v.CNY(), ShouldAlmostEqual, 1300)
+		c.So(v.Exposure(), ShouldAlmostEqual, 200)
+		c.So(v.Holdings[0].Symbol, ShouldEqual, "doge_usdt")
+		c.So(v.Holdings[0].Amount, ShouldAlmostEqual, 100)
+		c.So(v.Prices(), ShouldResemble, map[string]float64{"doge_usdt": 2, "xrp_usdt": 2})
+
+		v, err = Value(ss, func() (float64, error) { return 0, errors.New("timeout") })
+		c.So(err, ShouldBeNil)
+		c.So(v.CNY(), ShouldEqual, 0)
+	})
+}
+
+func TestOpening(t *testing.T) {
+	Convey("should return the equity at the start of a day", t, func(c C) {
+		day := time.Date(2018, 3, 2, 0, 0, 0, 0, time.UTC)
+		es := []journal.Entry{
+			{Time: day.Add(-time.Hour * 2), Kind: journal.Equity, Amount: 100},
+			{Time: day.Add(-time.Hour), Kind: journal.Equity, Amount: 110},
+			{Time: day.Add(-time.Minute), Kind: journal.Order},
+			{Time: day.Add(time.Hour), Kind: journal.Equity, Amount: 120},
+		}
+
+		v, ok := Opening(es, day)
+		c.So(ok, ShouldBeTrue)
+		c.So(v, ShouldEqual, 110)
+
+		v, ok = Opening(es, day.Add(-time.Hour*24))
+		c.So(ok, ShouldBeTrue)
+		c.So(v, ShouldEqual, 100)
+
+		_, ok = Opening(es[2:3], day)
+		c.So(ok, ShouldBeFalse)
+	})
+}
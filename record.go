@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	ossignal "os/signal"
+	"syscall"
+	"time"
+
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/history"
+	"github.com/modood/cts/huobi"
+	"github.com/modood/cts/indicator"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func recordCommand() cli.Command {
+	return cli.Command{
+		Name:  "record",
+		Usage: "poll gateio tickers and archive snapshots for backtesting",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "dir",
+				Value: "data",
+				Usage: "directory of archived files",
+			},
+			cli.DurationFlag{
+				Name:  "interval",
+				Value: time.Second * 5,
+				Usage: "poll interval",
+			},
+			cli.StringSliceFlag{
+				Name:  "klines",
+				Usage: "also record huobi klines of symbol(e.g., btc_usdt), can be repeated",
+			},
+			cli.StringFlag{
+				Name:  "period",
+				Value: huobi.Period1Min,
+				Usage: "period of huobi klines",
+			},
+			cli.DurationFlag{
+				Name:  "rotate",
+				Value: time.Hour,
+				Usage: "create a new file every rotate period",
+			},
+		},
+		Action: recordAction,
+	}
+}
+
+func recordAction(c *cli.Context) error {
+	w, err := history.NewWriter(c.String("dir"), "tickers", c.Duration("rotate"))
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	ctx := context.Background()
+	quotes := gateio.NewClient("", nil)
+	market := huobi.NewClient("", "", "", nil, nil)
+
+	var symbols []*huobi.Symbol
+	for _, v := range c.StringSlice("klines") {
+		s, err := market.Symbol(ctx, v)
+		if err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		symbols = append(symbols, s)
+	}
+	period := c.String("period")
+
+	interval := c.Duration("interval")
+	if interval <= 0 {
+		interval = time.Second * 5
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	quit := make(chan os.Signal, 1)
+	ossignal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	log.Println("recording...")
+	var last time.Time
+	for {
+		select {
+		case <-quit:
+			log.Println("stopped")
+			return nil
+		case <-t.C:
+		}
+
+		now := time.Now()
+		m, err := quotes.Tickers(ctx)
+		if err != nil {
+			log.Println(errors.Wrap(err, util.FuncName()))
+			continue
+		}
+
+		if !last.IsZero() && now.Sub(last) > interval*2 {
+			log.Printf("gap: no snapshot from %s to %s", last.Format(time.RFC3339), now.Format(time.RFC3339))
+		}
+		last = now
+
+		snap := history.Snapshot{Time: now, Tickers: m}
+		for _, s := range symbols {
+			// the last closed and the current candle
+			cs, err := s.Candles(ctx, period, 2)
+			if err != nil {
+				log.Println(errors.Wrap(err, util.FuncName()))
+				continue
+			}
+			if snap.Klines == nil {
+				snap.Klines = make(map[string][]indicator.Candle)
+			}
+			snap.Klines[s.BaseCurrency+"_"+s.QuoteCurrency] = cs
+		}
+
+		err = w.Write(&snap)
+		if err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/journal"
+	"github.com/modood/cts/pnl"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// usdtCNY return the exchange rate of USDT/CNY
+var usdtCNY = func() (float64, error) {
+	return quotes.Rate(context.Background())
+}
+
+// opening is the equity at the start of the day, which is used only if the
+// journal has no equity of the day
+var opening struct {
+	mu     sync.Mutex
+	day    time.Time
+	equity float64
+}
+
+// accountReport return equity, daily P&L and open exposure of symbols of all
+// bots. the equity of the scheduled report is appended to the journal as the
+// daily P&L base of tomorrow and after restarts, but not of queries.
+func accountReport(ctx context.Context, scheduled bool) (string, error) {
+	ss := map[string]exchange.Symbol{}
+	for _, v := range bots {
+		s, err := venue.Symbol(ctx, v.symbol)
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+		ss[v.symbol] = s
+	}
+	val, err := pnl.Value(ss, usdtCNY)
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+
+	var es []journal.Entry
+	if records != nil {
+		es, err = journal.Read(records.Name(), journal.Filter{
+			Kinds: []string{journal.Order, journal.Repay, journal.Equity},
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	now := time.Now()
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	base, ok := pnl.Opening(es, today)
+	if !ok {
+		opening.mu.Lock()
+		if !opening.day.Equal(today) {
+			opening.day, opening.equity = today, val.Equity
+		}
+		base = opening.equity
+		opening.mu.Unlock()
+	}
+
+	if scheduled {
+		err = records.Append(journal.Entry{Time: now, Kind: journal.Equity, Currency: "usdt", Amount: val.Equity})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	lines := []string{fmt.Sprintf("净值：%.4f USDT", val.Equity)}
+	if val.Rate > 0 {
+		lines[0] += fmt.Sprintf("（%.2f CNY）", val.CNY())
+	}
+	daily := fmt.Sprintf("今日盈亏：%+.4f USDT", val.Equity-base)
+	if base > 0 {
+		daily += fmt.Sprintf("（%+.2f%%）", (val.Equity-base)/base*100)
+	}
+	lines = append(lines, daily)
+
+	if records != nil {
+		s := pnl.Build(es).Summary(val.Prices())
+		lines = append(lines, fmt.Sprintf("累计盈亏：已实现 %.4f，未实现 %.4f，手续费 %.4f，利息 %.4f",
+			s.Realised, s.Unrealised, s.Fees, s.Interest))
+	}
+
+	lines = append(lines, fmt.Sprintf("敞口：%.4f USDT", val.Exposure()))
+	for _, h := range val.Holdings {
+		if math.Abs(h.Amount) < 1e-8 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("  %s：%.4f @ %.6f", h.Symbol, h.Amount, h.Price))
+	}
+	return strings.Join(lines, "\n"), nil
+}
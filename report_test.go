@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/journal"
+	"github.com/modood/cts/sim"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAccountReport(t *testing.T) {
+	Convey("should report equity, daily P&L and exposure", t, func(c C) {
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		records, err = journal.Open(filepath.Join(dir, "journal"))
+		c.So(err, ShouldBeNil)
+		defer func() { records.Close(); records = nil }()
+
+		defer func(f func() (float64, error)) { usdtCNY = f }(usdtCNY)
+		usdtCNY = func() (float64, error) { return 6.5, nil }
+
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Fee = 0
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		venue = e
+		defer func() { venue = fakeExchange{} }()
+		bots = []*bot{{name: "doge", symbol: "doge_usdt"}}
+		defer func() { bots = nil }()
+
+		msg, err := accountReport(ctx, true)
+		c.So(err, ShouldBeNil)
+		c.So(msg, ShouldContainSubstring, "净值：100.0000 USDT（650.00 CNY）")
+		c.So(msg, ShouldContainSubstring, "今日盈亏：+0.0000 USDT")
+		c.So(msg, ShouldContainSubstring, "敞口：0.0000 USDT")
+
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+		_, err = journal.Wrap(s, records, "doge", "doge_usdt").Trade(exchange.Buy, 100)
+		c.So(err, ShouldBeNil)
+		p.Last, p.LowestAsk, p.HighestBid = 2.2, 2.2, 2.2
+
+		msg, err = accountReport(ctx, true)
+		c.So(err, ShouldBeNil)
+		c.So(msg, ShouldContainSubstring, "净值：110.0000 USDT")
+		c.So(msg, ShouldContainSubstring, "今日盈亏：+10.0000 USDT（+10.00%）")
+		c.So(msg, ShouldContainSubstring, "累计盈亏：已实现 0.0000，未实现 10.0000")
+		c.So(msg, ShouldContainSubstring, "doge_usdt：50.0000 @ 2.200000")
+	})
+
+	Convey("should journal equity of scheduled reports only", t, func(c C) {
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		name := filepath.Join(dir, "journal")
+		records, err = journal.Open(name)
+		c.So(err, ShouldBeNil)
+		defer func() { records.Close(); records = nil }()
+
+		defer func(f func() (float64, error)) { usdtCNY = f }(usdtCNY)
+		usdtCNY = func() (float64, error) { return 6.5, nil }
+
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		venue = e
+		defer func() { venue = fakeExchange{} }()
+		bots = []*bot{{name: "doge", symbol: "doge_usdt"}}
+		defer func() { bots = nil }()
+
+		// queries of chat and api at the same time
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := accountReport(ctx, false)
+				c.So(err, ShouldBeNil)
+			}()
+		}
+		wg.Wait()
+		es, err := journal.Read(name, journal.Filter{Kinds: []string{journal.Equity}})
+		c.So(err, ShouldBeNil)
+		c.So(es, ShouldBeEmpty)
+
+		_, err = accountReport(ctx, true)
+		c.So(err, ShouldBeNil)
+		es, err = journal.Read(name, journal.Filter{Kinds: []string{journal.Equity}})
+		c.So(err, ShouldBeNil)
+		c.So(es, ShouldHaveLength, 1)
+	})
+}
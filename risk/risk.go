@@ -0,0 +1,439 @@
+package risk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/strategy"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// Rules
+const (
+	StopLoss     = "stop-loss"
+	TrailingStop = "trailing-stop"
+	TakeProfit   = "take-profit"
+	MaxDailyLoss = "max-daily-loss"
+)
+
+type (
+	// Manager watch positions between signals and flatten them when a rule
+	// is triggered, all rules are fractions and disabled if 0, e.g.,
+	// StopLoss 0.05 means closing a position which loses 5%.
+	Manager struct {
+		StopLoss     float64 // loss of entry price
+		TrailingStop float64 // retreat from the best price since entry
+		TakeProfit   float64 // profit of entry price
+		MaxDailyLoss float64 // loss of equity of a symbol, not the account, since the start of the day, its trading is halted until tomorrow
+
+		Notify func(text string) // alert when a rule is triggered, log if nil
+		Now    func() time.Time  // time.Now if nil
+
+		mu     sync.Mutex
+		states map[string]*state
+		limits map[string]*exchange.Limit // trade limits by symbol, see flat
+		file   string                     // where states are saved, see SetStateFile
+	}
+
+	// Status is the risk status of a symbol
+	Status struct {
+		Position   float64 // base currency, negative if short
+		Entry      float64 // average entry price
+		Price      float64
+		Unrealised float64 // quote currency
+		Equity     float64 // quote currency
+		DayEquity  float64 // equity at the start of the day
+		Halted     bool
+	}
+
+	state struct {
+		pos   float64
+		entry float64
+		best  float64 // highest price of a long position, lowest of a short one
+
+		price  float64 // last checked
+		equity float64
+
+		// direction of the position closed by a rule, which is not reopened
+		// until the strategy changes its mind
+		blocked float64
+
+		day       time.Time
+		dayEquity float64
+		halted    bool
+	}
+
+	// saved is a state in the state file
+	saved struct {
+		Pos       float64   `json:"pos"`
+		Entry     float64   `json:"entry"`
+		Best      float64   `json:"best"`
+		Blocked   float64   `json:"blocked,omitempty"`
+		Day       time.Time `json:"day"`
+		DayEquity float64   `json:"day_equity"`
+		Halted    bool      `json:"halted,omitempty"`
+	}
+)
+
+// dust is the position which is always regarded as flat, see flat
+const dust = 1e-8
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// NewManager return a risk manager
+func NewManager(stopLoss, trailingStop, takeProfit, maxDailyLoss float64) *Manager {
+	return &Manager{
+		StopLoss:     stopLoss,
+		TrailingStop: trailingStop,
+		TakeProfit:   takeProfit,
+		MaxDailyLoss: maxDailyLoss,
+	}
+}
+
+// SetStateFile set the file where states of symbols are saved, and load
+// them, so that entry prices, best prices, blocked directions and halts are
+// kept across restarts
+func (m *Manager) SetStateFile(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.file = name
+	m.states = map[string]*state{}
+	if name == "" {
+		return nil
+	}
+
+	bs, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if len(bs) == 0 {
+		return nil
+	}
+	ss := map[string]saved{}
+	if err = json.Unmarshal(bs, &ss); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	for k, v := range ss {
+		m.states[k] = &state{
+			pos:       v.Pos,
+			entry:     v.Entry,
+			best:      v.Best,
+			blocked:   v.Blocked,
+			day:       v.Day,
+			dayEquity: v.DayEquity,
+			halted:    v.Halted,
+		}
+	}
+	return nil
+}
+
+// Enabled return whether any rule is enabled
+func (m *Manager) Enabled() bool {
+	return m.StopLoss > 0 || m.TrailingStop > 0 || m.TakeProfit > 0 || m.MaxDailyLoss > 0
+}
+
+// Check update the position of a symbol and flatten it if a rule is
+// triggered, the triggered rule is returned, or empty if none
+func (m *Manager) Check(s exchange.Symbol) (string, error) {
+	pos, equity, price, err := exchange.Position(s)
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+	l, err := m.limit(s)
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+	if flat(pos, price, l) {
+		pos = 0
+	}
+
+	m.mu.Lock()
+	st := m.state(s.Name())
+	st.update(pos, equity, price, m.now())
+	rule := m.rule(st, equity, price)
+	if rule == MaxDailyLoss {
+		st.halted = true
+	}
+	entry := st.entry
+	m.save()
+	m.mu.Unlock()
+
+	if rule == "" {
+		return "", nil
+	}
+
+	err = exchange.Rebalance(s, 0, false)
+	if err == nil && rule != MaxDailyLoss {
+		// nothing is traded, e.g., the position is frozen. it is neither
+		// alerted nor blocked, and checked again next time
+		after, _, _, err := exchange.Position(s)
+		if err != nil {
+			return rule, errors.Wrap(err, util.FuncName())
+		}
+		if after == pos {
+			log.Printf("risk: %s triggers %s but nothing is traded, position: %.8f", s.Name(), rule, pos)
+			return "", nil
+		}
+	}
+	msg := fmt.Sprintf("风控：%s 触发%s\n持仓：%.8f\n开仓价：%.8f\n现价：%.8f\n净值：%.4f",
+		s.Name(), name(rule), pos, entry, price, equity)
+	if err != nil {
+		msg += "\n平仓失败：" + err.Error()
+	}
+	m.notify(msg)
+	if err != nil {
+		return rule, errors.Wrap(err, util.FuncName())
+	}
+
+	m.mu.Lock()
+	if rule != MaxDailyLoss {
+		st.blocked = math.Copysign(1, pos)
+	}
+	st.reset()
+	m.save()
+	m.mu.Unlock()
+	return rule, nil
+}
+
+// Allowed return whether a signal can be traded, trading is not allowed
+// when it is halted, or the signal reopens a position just closed by a rule
+func (m *Manager) Allowed(symbol string, signal uint8) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	if st.halted && st.day.Equal(day(m.now())) {
+		return false
+	}
+
+	var dir float64
+	switch signal {
+	case strategy.SigRise, strategy.SigBull:
+		dir = 1
+	case strategy.SigBear:
+		dir = -1
+	case strategy.SigFall:
+		dir = 0
+	default:
+		return true
+	}
+	if st.blocked != 0 && dir == st.blocked {
+		return false
+	}
+	if st.blocked != 0 {
+		st.blocked = 0
+		m.save()
+	}
+	return true
+}
+
+// Halted return whether trading of a symbol is halted for the rest of the day
+func (m *Manager) Halted(symbol string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	return st.halted && st.day.Equal(day(m.now()))
+}
+
+// Status return the last checked status of a symbol
+func (m *Manager) Status(symbol string) Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol)
+	return Status{
+		Position:   st.pos,
+		Entry:      st.entry,
+		Price:      st.price,
+		Unrealised: st.unrealised(st.price),
+		Equity:     st.equity,
+		DayEquity:  st.dayEquity,
+		Halted:     st.halted && st.day.Equal(day(m.now())),
+	}
+}
+
+func (m *Manager) rule(st *state, equity, price float64) string {
+	if m.MaxDailyLoss > 0 && st.dayEquity > 0 && !st.halted &&
+		equity <= st.dayEquity*(1-m.MaxDailyLoss) {
+		return MaxDailyLoss
+	}
+	if math.Abs(st.pos) < dust || st.entry <= 0 {
+		return ""
+	}
+
+	sign := 1.0
+	if st.pos < 0 {
+		sign = -1
+	}
+	r := (price/st.entry - 1) * sign
+	switch {
+	case m.StopLoss > 0 && r <= -m.StopLoss:
+		return StopLoss
+	case m.TakeProfit > 0 && r >= m.TakeProfit:
+		return TakeProfit
+	case m.TrailingStop > 0 && (st.best-price)/st.best*sign >= m.TrailingStop:
+		return TrailingStop
+	}
+	return ""
+}
+
+// limit return trade limits of a symbol, which are fetched once
+func (m *Manager) limit(s exchange.Symbol) (*exchange.Limit, error) {
+	m.mu.Lock()
+	l, ok := m.limits[s.Name()]
+	m.mu.Unlock()
+	if ok {
+		return l, nil
+	}
+
+	l, err := s.Limit()
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	m.mu.Lock()
+	if m.limits == nil {
+		m.limits = map[string]*exchange.Limit{}
+	}
+	m.limits[s.Name()] = l
+	m.mu.Unlock()
+	return l, nil
+}
+
+func (m *Manager) state(symbol string) *state {
+	if m.states == nil {
+		m.states = map[string]*state{}
+	}
+	st, ok := m.states[symbol]
+	if !ok {
+		st = &state{}
+		m.states[symbol] = st
+	}
+	return st
+}
+
+// save write states to the state file if any, errors are only logged so that
+// rules are applied anyway. it is called with mu held.
+func (m *Manager) save() {
+	if m.file == "" {
+		return
+	}
+
+	ss := map[string]saved{}
+	for k, v := range m.states {
+		ss[k] = saved{
+			Pos:       v.pos,
+			Entry:     v.entry,
+			Best:      v.best,
+			Blocked:   v.blocked,
+			Day:       v.day,
+			DayEquity: v.dayEquity,
+			Halted:    v.halted,
+		}
+	}
+	bs, err := json.Marshal(ss)
+	if err != nil {
+		log.Println(errors.Wrap(err, util.FuncName()))
+		return
+	}
+
+	// write a temporary file and rename, so that the file is never broken
+	tmp := m.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, bs, 0600); err != nil {
+		log.Println(errors.Wrap(err, util.FuncName()))
+		return
+	}
+	if err = os.Rename(tmp, m.file); err != nil {
+		log.Println(errors.Wrap(err, util.FuncName()))
+	}
+}
+
+func (m *Manager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+func (m *Manager) notify(text string) {
+	if m.Notify == nil {
+		log.Println(text)
+		return
+	}
+	m.Notify(text)
+}
+
+// update track entry price and the best price of the position
+func (st *state) update(pos, equity, price float64, now time.Time) {
+	if d := day(now); !d.Equal(st.day) {
+		st.day, st.dayEquity, st.halted = d, equity, false
+	}
+	st.price, st.equity = price, equity
+
+	switch {
+	case math.Abs(pos) < dust:
+		st.reset()
+		return
+	case math.Abs(st.pos) < dust || pos*st.pos < 0:
+		// opened or reversed
+		st.entry, st.best = price, price
+	case math.Abs(pos) > math.Abs(st.pos):
+		// increased, average the entry price
+		st.entry = (st.entry*st.pos + price*(pos-st.pos)) / pos
+	}
+	st.pos = pos
+
+	if (pos > 0 && price > st.best) || (pos < 0 && price < st.best) {
+		st.best = price
+	}
+}
+
+// flat return whether a position is too small to be traded, e.g., what is
+// left by precision of amounts, fees or unpaid interest, below the minimum
+// amount to sell or the minimum value to buy
+func flat(pos, price float64, l *exchange.Limit) bool {
+	a := math.Abs(pos)
+	return a < dust || a < l.SellGT || a*price < l.BuyGT
+}
+
+func (st *state) reset() {
+	st.pos, st.entry, st.best = 0, 0, 0
+}
+
+func (st *state) unrealised(price float64) float64 {
+	if st.entry <= 0 {
+		return 0
+	}
+	return (price - st.entry) * st.pos
+}
+
+func day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func name(rule string) string {
+	switch rule {
+	case StopLoss:
+		return "止损"
+	case TrailingStop:
+		return "移动止损"
+	case TakeProfit:
+		return "止盈"
+	case MaxDailyLoss:
+		return "单日最大亏损"
+	}
+	return rule
+}
@@ -0,0 +1,218 @@
+package risk
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/sim"
+	"github.com/modood/cts/strategy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+func newSymbol(c C, p *gateio.Pair) exchange.Symbol {
+	e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+	e.Fee = 0
+	e.Leverage = 3
+	c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+	s, err := e.Symbol(ctx, "doge_usdt")
+	c.So(err, ShouldBeNil)
+	return s
+}
+
+func TestStopLoss(t *testing.T) {
+	Convey("should close a losing position and block reopening", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		s := newSymbol(c, p)
+		var alerts []string
+		m := NewManager(0.1, 0, 0.5, 0)
+		m.Notify = func(text string) { alerts = append(alerts, text) }
+
+		c.So(exchange.Apply(s, strategy.SigRise, nil), ShouldBeNil)
+		rule, err := m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(rule, ShouldEqual, "")
+		c.So(m.Status("dogeusdt").Entry, ShouldEqual, 2)
+
+		p.Last, p.HighestBid = 1.9, 1.9
+		rule, err = m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(rule, ShouldEqual, "")
+		c.So(m.Status("dogeusdt").Unrealised, ShouldAlmostEqual, -5)
+
+		p.Last, p.HighestBid = 1.7, 1.7
+		rule, err = m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(rule, ShouldEqual, StopLoss)
+		c.So(alerts, ShouldHaveLength, 1)
+		c.So(alerts[0], ShouldContainSubstring, "止损")
+
+		pos, _, _, err := exchange.Position(s)
+		c.So(err, ShouldBeNil)
+		c.So(pos, ShouldEqual, 0)
+
+		c.So(m.Allowed("dogeusdt", strategy.SigBull), ShouldBeFalse)
+		c.So(m.Allowed("dogeusdt", strategy.SigFall), ShouldBeTrue)
+		c.So(m.Allowed("dogeusdt", strategy.SigRise), ShouldBeTrue)
+	})
+}
+
+// frozen is a symbol whose base currency is frozen, it can not be sold
+type frozen struct{ exchange.Symbol }
+
+func (s frozen) Balance(currency string) (*exchange.Balance, error) {
+	b, err := s.Symbol.Balance(currency)
+	if err == nil && currency == s.BaseCurrency() {
+		b.Frozen, b.Trade = b.Frozen+b.Trade, 0
+	}
+	return b, err
+}
+
+func TestDust(t *testing.T) {
+	Convey("should ignore positions too small to be traded", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := sim.NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Limits = map[string]exchange.Limit{
+			"doge_usdt": {BuyGT: 1, BuyLT: 1e6, SellGT: 1, SellLT: 1e6},
+		}
+		c.So(e.Deposit("doge_usdt", "doge", 0.5), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+		var alerts []string
+		m := NewManager(0.1, 0, 0, 0)
+		m.Notify = func(text string) { alerts = append(alerts, text) }
+
+		_, err = m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(m.Status("dogeusdt").Entry, ShouldEqual, 0)
+
+		p.Last, p.HighestBid = 1, 1
+		rule, err := m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(rule, ShouldEqual, "")
+		c.So(alerts, ShouldBeEmpty)
+		c.So(m.Allowed("dogeusdt", strategy.SigRise), ShouldBeTrue)
+	})
+
+	Convey("should neither alert nor block if nothing is traded", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		s := newSymbol(c, p)
+		var alerts []string
+		m := NewManager(0.1, 0, 0, 0)
+		m.Notify = func(text string) { alerts = append(alerts, text) }
+
+		c.So(exchange.Apply(s, strategy.SigRise, nil), ShouldBeNil)
+		_, err := m.Check(s)
+		c.So(err, ShouldBeNil)
+
+		p.Last, p.HighestBid = 1.7, 1.7
+		rule, err := m.Check(frozen{s})
+		c.So(err, ShouldBeNil)
+		c.So(rule, ShouldEqual, "")
+		c.So(alerts, ShouldBeEmpty)
+		c.So(m.Allowed("dogeusdt", strategy.SigRise), ShouldBeTrue)
+
+		// sold once it is not frozen
+		rule, err = m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(rule, ShouldEqual, StopLoss)
+		c.So(alerts, ShouldHaveLength, 1)
+	})
+}
+
+func TestTrailingStop(t *testing.T) {
+	Convey("should close a short position retreating from its best price", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		s := newSymbol(c, p)
+		m := NewManager(0, 0.1, 0, 0)
+
+		c.So(exchange.Apply(s, strategy.SigBear, exchange.Fraction(1)), ShouldBeNil)
+		_, err := m.Check(s)
+		c.So(err, ShouldBeNil)
+
+		p.Last, p.LowestAsk = 1, 1
+		rule, err := m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(rule, ShouldEqual, "")
+
+		p.Last, p.LowestAsk = 1.15, 1.15
+		rule, err = m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(rule, ShouldEqual, TrailingStop)
+
+		ls, err := s.Loans()
+		c.So(err, ShouldBeNil)
+		c.So(ls, ShouldBeEmpty)
+		c.So(m.Allowed("dogeusdt", strategy.SigBear), ShouldBeFalse)
+	})
+}
+
+func TestMaxDailyLoss(t *testing.T) {
+	Convey("should halt trading until tomorrow", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		s := newSymbol(c, p)
+		now := time.Date(2018, 6, 1, 10, 0, 0, 0, time.Local)
+		m := NewManager(0, 0, 0, 0.2)
+		m.Now = func() time.Time { return now }
+
+		_, err := m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(exchange.Apply(s, strategy.SigRise, nil), ShouldBeNil)
+
+		p.Last, p.HighestBid = 1.5, 1.5
+		rule, err := m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(rule, ShouldEqual, MaxDailyLoss)
+		c.So(m.Halted("dogeusdt"), ShouldBeTrue)
+		c.So(m.Allowed("dogeusdt", strategy.SigRise), ShouldBeFalse)
+
+		now = now.Add(time.Hour * 24)
+		c.So(m.Halted("dogeusdt"), ShouldBeFalse)
+		c.So(m.Allowed("dogeusdt", strategy.SigRise), ShouldBeTrue)
+	})
+}
+
+func TestStateFile(t *testing.T) {
+	Convey("should keep states of symbols across restarts", t, func(c C) {
+		dir, err := ioutil.TempDir("", "risk")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "risk.json")
+
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		s := newSymbol(c, p)
+		m := NewManager(0.1, 0, 0, 0)
+		m.Notify = func(string) {}
+		c.So(m.SetStateFile(name), ShouldBeNil)
+
+		c.So(exchange.Apply(s, strategy.SigRise, nil), ShouldBeNil)
+		_, err = m.Check(s)
+		c.So(err, ShouldBeNil)
+
+		// restart after the price falls
+		p.Last, p.HighestBid = 1.7, 1.7
+		m = NewManager(0.1, 0, 0, 0)
+		m.Notify = func(string) {}
+		c.So(m.SetStateFile(name), ShouldBeNil)
+		c.So(m.Status("dogeusdt").Entry, ShouldEqual, 2)
+		rule, err := m.Check(s)
+		c.So(err, ShouldBeNil)
+		c.So(rule, ShouldEqual, StopLoss)
+
+		// restart after the stop loss
+		m = NewManager(0.1, 0, 0, 0)
+		c.So(m.SetStateFile(name), ShouldBeNil)
+		c.So(m.Allowed("dogeusdt", strategy.SigRise), ShouldBeFalse)
+		c.So(m.Allowed("dogeusdt", strategy.SigFall), ShouldBeTrue)
+
+		c.So(m.SetStateFile(""), ShouldBeNil)
+		c.So(m.Status("dogeusdt").Entry, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,256 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// Reference prefixes, a value without them is the secret itself
+const (
+	Env      = "env:"      // env:HUOBI_SECRET
+	File     = "file:"     // file:/run/secrets/huobi_secret
+	Keystore = "keystore:" // keystore:huobi-secret
+)
+
+type (
+	// Store is a passphrase encrypted file of named secrets
+	Store struct {
+		path   string
+		key    []byte
+		salt   []byte
+		iter   int
+		values map[string]string
+	}
+
+	// sealed is the file format of Store
+	sealed struct {
+		Version    int    `json:"version"`
+		Iterations int    `json:"iterations"`
+		Salt       []byte `json:"salt"`
+		Nonce      []byte `json:"nonce"`
+		Data       []byte `json:"data"`
+	}
+)
+
+var (
+	// iterations of PBKDF2 to derive the key from passphrase
+	iterations = 200000
+
+	errNoPassphrase = errors.New("no passphrase of keystore")
+	errPassphrase   = errors.New("wrong passphrase or broken keystore")
+	errNotFound     = errors.New("secret not found")
+	errNoKeystore   = errors.New("keystore is not available here")
+
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+)
+
+// Resolve return the secret which ref refers to, open is called to get the
+// keystore only if ref refers to it. the secret is registered to be
+// redacted from logs.
+func Resolve(ref string, open func() (*Store, error)) (string, error) {
+	var v string
+	switch {
+	case strings.HasPrefix(ref, Env):
+		name := strings.TrimPrefix(ref, Env)
+		v = os.Getenv(name)
+		if v == "" {
+			err := fmt.Errorf("%v: environment variable %s", errNotFound, name)
+			return "", errors.Wrap(err, util.FuncName())
+		}
+	case strings.HasPrefix(ref, File):
+		bs, err := ioutil.ReadFile(strings.TrimPrefix(ref, File))
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+		v = strings.TrimRight(string(bs), "\r\n")
+	case strings.HasPrefix(ref, Keystore):
+		if open == nil {
+			return "", errors.Wrap(errNoKeystore, util.FuncName())
+		}
+		s, err := open()
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+		v, err = s.Get(strings.TrimPrefix(ref, Keystore))
+		if err != nil {
+			return "", errors.Wrap(err, util.FuncName())
+		}
+	default:
+		v = ref
+	}
+
+	util.AddSecret(v)
+	return v, nil
+}
+
+// Open return the keystore of path, which is empty if the file does not exist
+func Open(path, passphrase string) (*Store, error) {
+	if passphrase == "" {
+		return nil, errors.Wrap(errNoPassphrase, util.FuncName())
+	}
+	util.AddSecret(passphrase)
+
+	s := &Store{path: path, values: map[string]string{}}
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		s.salt = make([]byte, 16)
+		if _, err = rand.Read(s.salt); err != nil {
+			return nil, errors.Wrap(err, util.FuncName())
+		}
+		s.iter = iterations
+		s.key = pbkdf2([]byte(passphrase), s.salt, s.iter, 32)
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	var f sealed
+	if err = json.Unmarshal(bs, &f); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	s.salt, s.iter = f.Salt, f.Iterations
+	s.key = pbkdf2([]byte(passphrase), s.salt, s.iter, 32)
+
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, errors.Wrap(errPassphrase, util.FuncName())
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, errors.Wrap(errPassphrase, util.FuncName())
+	}
+	if err = json.Unmarshal(plain, &s.values); err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	for _, v := range s.values {
+		util.AddSecret(v)
+	}
+	return s, nil
+}
+
+// Get return a secret by name
+func (s *Store) Get(name string) (string, error) {
+	v, ok := s.values[name]
+	if !ok {
+		err := fmt.Errorf("%v: %s in %s", errNotFound, name, s.path)
+		return "", errors.Wrap(err, util.FuncName())
+	}
+	return v, nil
+}
+
+// Set add or replace a secret, it is not saved until Save
+func (s *Store) Set(name, value string) {
+	util.AddSecret(value)
+	s.values[name] = value
+}
+
+// Delete remove a secret, it is not saved until Save
+func (s *Store) Delete(name string) {
+	delete(s.values, name)
+}
+
+// Names return names of all secrets, sorted
+func (s *Store) Names() []string {
+	r := make([]string, 0, len(s.values))
+	for k := range s.values {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// Save encrypt and write the keystore, which is readable only by the owner
+func (s *Store) Save() error {
+	plain, err := json.Marshal(s.values)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	gcm, err := s.gcm()
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	f := sealed{
+		Version:    1,
+		Iterations: s.iter,
+		Salt:       s.salt,
+		Nonce:      make([]byte, gcm.NonceSize()),
+	}
+	if _, err = rand.Read(f.Nonce); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	f.Data = gcm.Seal(nil, f.Nonce, plain, nil)
+
+	bs, err := json.Marshal(f)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+
+	// write a temporary file and rename, so that the file is never broken
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, bs, 0600); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+func (s *Store) gcm() (cipher.AEAD, error) {
+	b, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	gcm, err := cipher.NewGCM(b)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return gcm, nil
+}
+
+// pbkdf2 derive a key from password with HMAC-SHA256, see RFC 8018
+func pbkdf2(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	n := (keyLen + prf.Size() - 1) / prf.Size()
+
+	var dk []byte
+	buf := make([]byte, 4)
+	for block := 1; block <= n; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf, uint32(block))
+		prf.Write(buf)
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		dk = append(dk, t...)
+	}
+	return dk[:keyLen]
+}
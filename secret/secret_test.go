@@ -0,0 +1,94 @@
+package secret
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modood/cts/util"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPBKDF2(t *testing.T) {
+	Convey("should match RFC 7914 test vectors", t, func(c C) {
+		dk := pbkdf2([]byte("passwd"), []byte("salt"), 1, 64)
+		c.So(hex.EncodeToString(dk), ShouldEqual,
+			"55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"+
+				"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783")
+	})
+}
+
+func TestStore(t *testing.T) {
+	Convey("should save and open an encrypted keystore", t, func(c C) {
+		iterations = 10
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "keystore")
+
+		_, err = Open(name, "")
+		c.So(err, ShouldNotBeNil)
+
+		s, err := Open(name, "correct horse")
+		c.So(err, ShouldBeNil)
+		c.So(s.Names(), ShouldBeEmpty)
+		s.Set("huobi-secret", "s3cr3t-value")
+		s.Set("dingtalk", "t0ken-value")
+		c.So(s.Save(), ShouldBeNil)
+
+		bs, err := ioutil.ReadFile(name)
+		c.So(err, ShouldBeNil)
+		c.So(string(bs), ShouldNotContainSubstring, "s3cr3t-value")
+
+		_, err = Open(name, "wrong")
+		c.So(err, ShouldNotBeNil)
+
+		s, err = Open(name, "correct horse")
+		c.So(err, ShouldBeNil)
+		c.So(s.Names(), ShouldResemble, []string{"dingtalk", "huobi-secret"})
+		v, err := s.Get("huobi-secret")
+		c.So(err, ShouldBeNil)
+		c.So(v, ShouldEqual, "s3cr3t-value")
+
+		s.Delete("dingtalk")
+		_, err = s.Get("dingtalk")
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestResolve(t *testing.T) {
+	Convey("should resolve secret references and redact them", t, func(c C) {
+		dir, err := ioutil.TempDir("", "cts")
+		c.So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		v, err := Resolve("plain-value", nil)
+		c.So(err, ShouldBeNil)
+		c.So(v, ShouldEqual, "plain-value")
+
+		os.Setenv("CTS_TEST_SECRET", "from-env-value")
+		defer os.Unsetenv("CTS_TEST_SECRET")
+		v, err = Resolve("env:CTS_TEST_SECRET", nil)
+		c.So(err, ShouldBeNil)
+		c.So(v, ShouldEqual, "from-env-value")
+		_, err = Resolve("env:CTS_TEST_NONE", nil)
+		c.So(err, ShouldNotBeNil)
+
+		name := filepath.Join(dir, "secret")
+		c.So(ioutil.WriteFile(name, []byte("from-file-value\n"), 0600), ShouldBeNil)
+		v, err = Resolve("file:"+name, nil)
+		c.So(err, ShouldBeNil)
+		c.So(v, ShouldEqual, "from-file-value")
+
+		_, err = Resolve("keystore:x", nil)
+		c.So(err, ShouldNotBeNil)
+		s := &Store{values: map[string]string{"x": "from-keystore-value"}}
+		v, err = Resolve("keystore:x", func() (*Store, error) { return s, nil })
+		c.So(err, ShouldBeNil)
+		c.So(v, ShouldEqual, "from-keystore-value")
+
+		c.So(util.Redact("a from-env-value b from-file-value"), ShouldEqual, "a ****** b ******")
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/modood/cts/config"
+	"github.com/modood/cts/dingtalk"
+	"github.com/modood/cts/notify"
+)
+
+// serve start HTTP servers of the chat, the api and metrics, which share one
+// if their addresses are the same. they are closed by the caller.
+func serve(cfg *config.Config) []*http.Server {
+	var addrs []string
+	muxes := map[string]*http.ServeMux{}
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+			addrs = append(addrs, addr)
+		}
+		return muxes[addr]
+	}
+
+	if cfg.Chat.Listen != "" {
+		h := dingtalk.Handler(cfg.Chat.Secret, newChat(cfg.Chat.Users).handle)
+		mux(cfg.Chat.Listen).Handle(cfg.Chat.Path, h)
+	}
+	if cfg.API.Listen != "" {
+		mux(cfg.API.Listen).Handle("/api/", newAPI(cfg.API.Token).handler())
+	}
+	if cfg.Metrics.Listen != "" {
+		mux(cfg.Metrics.Listen).Handle("/metrics", registry.Handler())
+	}
+
+	var r []*http.Server
+	for _, addr := range addrs {
+		srv := &http.Server{Addr: addr, Handler: muxes[addr]}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				alerts.Post(notify.Error, "http: "+err.Error(), true)
+			}
+		}()
+		r = append(r, srv)
+	}
+	return r
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/modood/cts/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestServe(t *testing.T) {
+	Convey("should share a server of the same address", t, func(c C) {
+		cfg := config.Default()
+		c.So(len(serve(cfg)), ShouldEqual, 0)
+
+		cfg.Chat.Listen, cfg.API.Listen = "127.0.0.1:0", "127.0.0.1:0"
+		srvs := serve(cfg)
+		c.So(len(srvs), ShouldEqual, 1)
+		for _, v := range srvs {
+			c.So(v.Close(), ShouldBeNil)
+		}
+
+		cfg.API.Listen = "localhost:0"
+		srvs = serve(cfg)
+		c.So(len(srvs), ShouldEqual, 2)
+		for _, v := range srvs {
+			c.So(v.Close(), ShouldBeNil)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modood/cts/config"
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/notify"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+var (
+	errForced = errors.New("forced to stop by another signal")
+)
+
+// shutdown wait for bots to finish their trades, then leave every symbol
+// following the exit policy and report what is left. it gives up waiting
+// after the timeout, and a second signal stops it at once.
+func shutdown(wg *sync.WaitGroup, quit <-chan os.Signal, cfg config.Shutdown) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	status := "正常"
+	select {
+	case <-done:
+	case <-time.After(cfg.Timeout):
+		status = "等待交易超时（" + cfg.Timeout.String() + "）"
+		log.Println("shutdown: timeout waiting for bots")
+	case <-quit:
+		return errors.Wrap(errForced, util.FuncName())
+	}
+
+	msg := fmt.Sprintf("%s\n停止：%s\n策略：%s\n%s",
+		time.Now().Format("2006-01-02 15:04:05"), status, cfg.Policy, leave(context.Background(), cfg.Policy))
+	alerts.Post(notify.Report, msg, true)
+	return nil
+}
+
+// leave apply the exit policy to symbols of all bots, and return their states,
+// trades of bots of a symbol in progress are waited for
+func leave(ctx context.Context, policy string) string {
+	var r []string
+	seen := map[string]bool{}
+	for _, v := range bots {
+		if seen[v.symbol] {
+			continue
+		}
+		seen[v.symbol] = true
+
+		r = append(r, "品种："+v.symbol)
+		s, err := venue.Symbol(ctx, v.symbol)
+		if err != nil {
+			r = append(r, err.Error())
+			continue
+		}
+		s = track(s, "shutdown", v.symbol)
+		unlock := lock(v.symbol)
+		err = exchange.Exit(s, policy)
+		unlock()
+		if err != nil {
+			r = append(r, "退出失败："+err.Error())
+		}
+		state, err := exchange.State(s)
+		if err != nil {
+			r = append(r, err.Error())
+			continue
+		}
+		r = append(r, state)
+	}
+	return strings.Join(r, "\n")
+}
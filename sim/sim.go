@@ -0,0 +1,559 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Pricer return the latest ticker of a symbol, e.g., btc_usdt
+	Pricer func(symbol string) (*gateio.Pair, error)
+
+	// Exchange is a simulated margin exchange, every symbol has an isolated
+	// margin account like huobi. market orders are filled immediately at the
+	// best price of the ticker.
+	Exchange struct {
+		Fee      float64                   // taker fee rate, e.g., 0.002
+		Leverage float64                   // max position value / equity, no loan if less than or equal to 1
+		Interest float64                   // daily interest rate of loans, e.g., 0.001
+		Limits   map[string]exchange.Limit // trade limits by symbol name(e.g., btc_usdt), no limit if absent
+		Notify   func(text string)         // called after every trade, borrow and repay if not nil
+		Now      func() time.Time          // clock, time.Now if nil
+
+		mu       sync.Mutex
+		price    Pricer
+		accounts map[string]*account
+		nextID   uint64
+	}
+
+	// Symbol is a simulated margin trading pair, it implements exchange.Symbol
+	Symbol struct {
+		e     *Exchange
+		name  string
+		base  string
+		quote string
+	}
+
+	account struct {
+		balances map[string]float64
+		deposits map[string]float64
+		loans    []loan
+		orders   []exchange.Order
+	}
+
+	loan struct {
+		exchange.Loan
+		accrued time.Time // interest has been accrued until
+	}
+)
+
+var (
+	errInvalidSymbol   = errors.New("invalid symbol name, A valid name should look like: btc_usdt")
+	errInvalidCurrency = errors.New("invalid currency")
+	errInvalidAmount   = errors.New("invalid amount")
+	errInsufficient    = errors.New("insufficient balance")
+	errNoPrice         = errors.New("no price")
+	errNoOrder         = errors.New("order not found")
+	errAmountLimit     = errors.New("order amount out of limit")
+	errUnkownTradeType = errors.New("unknown trade type, it should be `BUY` or `SELL`")
+)
+
+// NewExchange return a simulated exchange priced by p
+func NewExchange(p Pricer) *Exchange {
+	return &Exchange{
+		Fee:      0.002,
+		Leverage: 1,
+		price:    p,
+		accounts: make(map[string]*account),
+	}
+}
+
+// Name return exchange name
+func (e *Exchange) Name() string {
+	return "sim"
+}
+
+// Symbols return all symbols which have been deposited
+func (e *Exchange) Symbols(ctx context.Context) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r := make([]string, 0, len(e.accounts))
+	for k := range e.accounts {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r, nil
+}
+
+// Symbol return a simulated symbol by name, e.g., btc_usdt
+func (e *Exchange) Symbol(ctx context.Context, name string) (exchange.Symbol, error) {
+	s, err := e.symbol(name)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return s, nil
+}
+
+// Deposit transfer currency into margin account of a symbol
+func (e *Exchange) Deposit(symbol, currency string, amount float64) error {
+	s, err := e.symbol(symbol)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if currency != s.base && currency != s.quote {
+		return errors.Wrap(errInvalidCurrency, util.FuncName())
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	a := e.account(symbol)
+	a.balances[currency] += amount
+	a.deposits[currency] += amount
+	return nil
+}
+
+func (e *Exchange) symbol(name string) (*Symbol, error) {
+	n := strings.Split(name, "_")
+	if len(n) != 2 || n[0] == "" || n[1] == "" {
+		return nil, errors.Wrap(errInvalidSymbol, util.FuncName())
+	}
+
+	return &Symbol{e: e, name: name, base: n[0], quote: n[1]}, nil
+}
+
+// account return margin account of a symbol with interest accrued,
+// caller must hold e.mu
+func (e *Exchange) account(symbol string) *account {
+	a, ok := e.accounts[symbol]
+	if !ok {
+		a = &account{
+			balances: make(map[string]float64),
+			deposits: make(map[string]float64),
+		}
+		e.accounts[symbol] = a
+	}
+
+	now := e.now()
+	for i := range a.loans {
+		v := &a.loans[i]
+		if d := now.Sub(v.accrued); d > 0 {
+			v.Interest += v.Amount * e.Interest * d.Hours() / 24
+			v.accrued = now
+		}
+	}
+	return a
+}
+
+func (e *Exchange) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
+func (e *Exchange) notify(text string) {
+	if e.Notify != nil {
+		e.Notify(text)
+	}
+}
+
+// Name return symbol name, e.g., btcusdt
+func (s *Symbol) Name() string { return s.base + s.quote }
+
+// BaseCurrency return base currency
+func (s *Symbol) BaseCurrency() string { return s.base }
+
+// QuoteCurrency return quote currency
+func (s *Symbol) QuoteCurrency() string { return s.quote }
+
+// Price return the latest price of the symbol
+func (s *Symbol) Price() (float64, error) {
+	p, err := s.e.price(s.name)
+	if err != nil {
+		return 0, errors.Wrap(err, util.FuncName())
+	}
+	if p.Last <= 0 {
+		return 0, errors.Wrap(errNoPrice, util.FuncName())
+	}
+	return p.Last, nil
+}
+
+// Equity return net asset value in quote currency
+func (s *Symbol) Equity() (float64, error) {
+	price, err := s.Price()
+	if err != nil {
+		return 0, errors.Wrap(err, util.FuncName())
+	}
+
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+
+	return s.equity(s.e.account(s.name), price), nil
+}
+
+func (s *Symbol) equity(a *account, price float64) float64 {
+	eq := a.balances[s.quote] + a.balances[s.base]*price
+	for _, v := range a.loans {
+		debt := v.Amount + v.Interest
+		if v.Currency == s.base {
+			debt *= price
+		}
+		eq -= debt
+	}
+	return eq
+}
+
+// Balance return balance of specific currency
+func (s *Symbol) Balance(currency string) (*exchange.Balance, error) {
+	if currency != s.base && currency != s.quote {
+		return nil, errors.Wrap(errInvalidCurrency, util.FuncName())
+	}
+
+	price, err := s.Price()
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+
+	a := s.e.account(s.name)
+	b := exchange.Balance{Trade: a.balances[currency]}
+
+	var debt float64 // in quote currency
+	for _, v := range a.loans {
+		d := v.Amount + v.Interest
+		if v.Currency == s.base {
+			d *= price
+		}
+		debt += d
+
+		if v.Currency == currency {
+			b.Loan += v.Amount
+			b.Interest += v.Interest
+		}
+	}
+
+	if s.e.Leverage > 1 {
+		avail := s.equity(a, price)*(s.e.Leverage-1) - debt
+		if currency == s.base {
+			avail /= price
+		}
+		if avail > 0 {
+			b.LoanAvailable = avail
+		}
+	}
+
+	return &b, nil
+}
+
+// Limit return trade limit of the symbol
+func (s *Symbol) Limit() (*exchange.Limit, error) {
+	if l, ok := s.e.Limits[s.name]; ok {
+		return &l, nil
+	}
+	return &exchange.Limit{
+		BuyGT:  0,
+		BuyLT:  1e12,
+		SellGT: 0,
+		SellLT: 1e12,
+	}, nil
+}
+
+// Trade place a market order, amount is quote currency when buying and
+// base currency when selling
+func (s *Symbol) Trade(cmd string, amount float64) (*exchange.Fill, error) {
+	if amount <= 0 {
+		return nil, errors.Wrap(errInvalidAmount, util.FuncName())
+	}
+
+	p, err := s.e.price(s.name)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	l, err := s.Limit()
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	o, err := s.trade(cmd, amount, p, l)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	s.e.notify(fmt.Sprintf("%s\n[模拟]\n订单：%d\n状态：%s\n类型：%s\n品种：%s\n价格：$%.4f\n数量：$%.2f",
+		s.e.now().Format("2006-01-02 15:04:05"), o.ID, o.State,
+		strings.ToLower(cmd), o.Symbol, o.Price, o.FilledCashAmount))
+
+	return &exchange.Fill{
+		OrderID:          o.ID,
+		Type:             o.Type,
+		State:            o.State,
+		Amount:           o.Amount,
+		FilledAmount:     o.FilledAmount,
+		FilledCashAmount: o.FilledCashAmount,
+		Fees:             o.FilledFees,
+		Price:            o.Price,
+	}, nil
+}
+
+func (s *Symbol) trade(cmd string, amount float64, p *gateio.Pair, l *exchange.Limit) (*exchange.Order, error) {
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+
+	a := s.e.account(s.name)
+	o := exchange.Order{Symbol: s.Name(), State: "filled", Amount: amount}
+
+	switch cmd {
+	case exchange.Buy:
+		if amount < l.BuyGT || amount > l.BuyLT {
+			return nil, errors.Wrap(errAmountLimit, util.FuncName())
+		}
+		price := p.LowestAsk
+		if price <= 0 {
+			price = p.Last
+		}
+		if price <= 0 {
+			return nil, errors.Wrap(errNoPrice, util.FuncName())
+		}
+		if a.balances[s.quote] < amount {
+			return nil, errors.Wrap(errInsufficient, util.FuncName())
+		}
+
+		filled := amount / price
+		o.Type = "buy-market"
+		o.Price = price
+		o.FilledAmount = filled
+		o.FilledCashAmount = amount
+		o.FilledFees = filled * s.e.Fee
+
+		a.balances[s.quote] -= amount
+		a.balances[s.base] += filled - o.FilledFees
+	case exchange.Sell:
+		if amount < l.SellGT || amount > l.SellLT {
+			return nil, errors.Wrap(errAmountLimit, util.FuncName())
+		}
+		price := p.HighestBid
+		if price <= 0 {
+			price = p.Last
+		}
+		if price <= 0 {
+			return nil, errors.Wrap(errNoPrice, util.FuncName())
+		}
+		if a.balances[s.base] < amount {
+			return nil, errors.Wrap(errInsufficient, util.FuncName())
+		}
+
+		cash := amount * price
+		o.Type = "sell-market"
+		o.Price = price
+		o.FilledAmount = amount
+		o.FilledCashAmount = cash
+		o.FilledFees = cash * s.e.Fee
+
+		a.balances[s.base] -= amount
+		a.balances[s.quote] += cash - o.FilledFees
+	default:
+		return nil, errors.Wrap(errUnkownTradeType, util.FuncName())
+	}
+
+	s.e.nextID++
+	o.ID = s.e.nextID
+	a.orders = append(a.orders, o)
+
+	return &o, nil
+}
+
+// Order return order detail by ID
+func (s *Symbol) Order(ID uint64) (*exchange.Order, error) {
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+
+	for _, v := range s.e.account(s.name).orders {
+		if v.ID == ID {
+			o := v
+			return &o, nil
+		}
+	}
+	err := fmt.Errorf("%v: %d", errNoOrder, ID)
+	return nil, errors.Wrap(err, util.FuncName())
+}
+
+// Orders return all filled orders
+func (s *Symbol) Orders() []exchange.Order {
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+
+	return append([]exchange.Order(nil), s.e.account(s.name).orders...)
+}
+
+// OpenOrders return pendding orders, market orders are never pendding
+func (s *Symbol) OpenOrders() ([]exchange.Order, error) {
+	return nil, nil
+}
+
+// Cancel cancel an open order by ID
+func (s *Symbol) Cancel(ID uint64) error {
+	err := fmt.Errorf("%v: %d", errNoOrder, ID)
+	return errors.Wrap(err, util.FuncName())
+}
+
+// CancelAll cancel all open orders
+func (s *Symbol) CancelAll() error {
+	return nil
+}
+
+// Loans return accruing loans
+func (s *Symbol) Loans() ([]exchange.Loan, error) {
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+
+	a := s.e.account(s.name)
+	r := make([]exchange.Loan, 0, len(a.loans))
+	for _, v := range a.loans {
+		r = append(r, v.Loan)
+	}
+	return r, nil
+}
+
+// Borrow borrow money
+func (s *Symbol) Borrow(currency string, amount float64) error {
+	if amount <= 0 {
+		return errors.Wrap(errInvalidAmount, util.FuncName())
+	}
+
+	b, err := s.Balance(currency)
+	if err != nil {
+		return errors.Wrap(err, util.FuncName())
+	}
+	if amount > b.LoanAvailable {
+		return errors.Wrap(errInsufficient, util.FuncName())
+	}
+
+	s.e.mu.Lock()
+	a := s.e.account(s.name)
+	s.e.nextID++
+	a.loans = append(a.loans, loan{
+		Loan: exchange.Loan{
+			ID:       s.e.nextID,
+			Currency: currency,
+			Amount:   amount,
+		},
+		accrued: s.e.now(),
+	})
+	a.balances[currency] += amount
+	s.e.mu.Unlock()
+
+	s.e.notify(fmt.Sprintf("%s\n[模拟]\n类型：%s\n品种：%s\n数量：%.4f %s",
+		s.e.now().Format("2006-01-02 15:04:05"), "borrow", s.name, amount, currency))
+
+	return nil
+}
+
+// Repay repay debt of currency up to amount as much as possible, interest first
+func (s *Symbol) Repay(currency string, amount float64) error {
+	if currency != s.base && currency != s.quote {
+		return errors.Wrap(errInvalidCurrency, util.FuncName())
+	}
+
+	s.e.mu.Lock()
+	var paid, interest float64
+	a := s.e.account(s.name)
+	loans := a.loans[:0]
+	for _, v := range a.loans {
+		if v.Currency != currency {
+			loans = append(loans, v)
+			continue
+		}
+
+		pay := min(min(a.balances[currency], amount), v.Interest)
+		v.Interest -= pay
+		a.balances[currency] -= pay
+		interest += pay
+		amount -= pay
+
+		pay = min(min(a.balances[currency], amount), v.Amount)
+		v.Amount -= pay
+		a.balances[currency] -= pay
+		paid += pay
+		amount -= pay
+
+		if v.Amount > 0 || v.Interest > 0 {
+			loans = append(loans, v)
+		}
+	}
+	a.loans = loans
+	s.e.mu.Unlock()
+
+	if paid > 0 || interest > 0 {
+		s.e.notify(fmt.Sprintf("%s\n[模拟]\n类型：%s\n品种：%s\n数量：%.4f %s\n利息：%.6f %s",
+			s.e.now().Format("2006-01-02 15:04:05"), "repay", s.name, paid, currency, interest, currency))
+	}
+
+	return nil
+}
+
+// PnL return equity and profit and loss since deposit in quote currency
+func (s *Symbol) PnL() (equity, pnl float64, err error) {
+	price, err := s.Price()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, util.FuncName())
+	}
+
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+
+	a := s.e.account(s.name)
+	equity = s.equity(a, price)
+	pnl = equity - a.deposits[s.quote] - a.deposits[s.base]*price
+	return equity, pnl, nil
+}
+
+// Report return virtual positions and profit and loss as plain text
+func (s *Symbol) Report() (string, error) {
+	equity, pnl, err := s.PnL()
+	if err != nil {
+		return "", errors.Wrap(err, util.FuncName())
+	}
+
+	s.e.mu.Lock()
+	defer s.e.mu.Unlock()
+
+	a := s.e.account(s.name)
+	loans, interests := map[string]float64{}, map[string]float64{}
+	for _, v := range a.loans {
+		loans[v.Currency] += v.Amount
+		interests[v.Currency] += v.Interest
+	}
+
+	msg := fmt.Sprintf("[模拟] %s\n权益：%.4f %s\n盈亏：%.4f %s",
+		s.name, equity, s.quote, pnl, s.quote)
+	if base := equity - pnl; base > 0 {
+		msg += fmt.Sprintf(" (%.2f%%)", pnl/base*100)
+	}
+	for _, c := range []string{s.base, s.quote} {
+		msg += fmt.Sprintf("\n持仓：%.4f %s", a.balances[c], c)
+		if loans[c] > 0 || interests[c] > 0 {
+			msg += fmt.Sprintf(", 借贷：%.4f, 利息：%.6f", loans[c], interests[c])
+		}
+	}
+	return msg, nil
+}
+
+func min(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
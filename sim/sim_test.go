@@ -0,0 +1,206 @@
+package sim
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/exchange"
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/strategy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+func TestTrade(t *testing.T) {
+	Convey("should fill market orders at best price", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Fee = 0.01
+
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		c.So(e.Deposit("doge_usdt", "btc", 1), ShouldNotBeNil)
+
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(s.Name(), ShouldEqual, "dogeusdt")
+
+		_, err = s.Trade(exchange.Buy, 200)
+		c.So(err, ShouldNotBeNil)
+
+		_, err = s.Trade(exchange.Buy, 100)
+		c.So(err, ShouldBeNil)
+
+		b, err := s.Balance("doge")
+		c.So(err, ShouldBeNil)
+		c.So(b.Trade, ShouldAlmostEqual, 49.5)
+
+		p.Last, p.HighestBid = 4, 4
+		_, err = s.Trade(exchange.Sell, b.Trade)
+		c.So(err, ShouldBeNil)
+
+		b, err = s.Balance("usdt")
+		c.So(err, ShouldBeNil)
+		c.So(b.Trade, ShouldAlmostEqual, 196.02)
+
+		o, err := s.Order(2)
+		c.So(err, ShouldBeNil)
+		c.So(o.Type, ShouldEqual, "sell-market")
+		c.So(o.FilledCashAmount, ShouldAlmostEqual, 198)
+
+		_, err = s.Order(3)
+		c.So(err, ShouldNotBeNil)
+
+		_, err = s.Trade("HOLD", 1)
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestBorrow(t *testing.T) {
+	Convey("should borrow within leverage and repay", t, func(c C) {
+		p := &gateio.Pair{Last: 2}
+		e := NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Leverage = 3
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		b, err := s.Balance("doge")
+		c.So(err, ShouldBeNil)
+		c.So(b.LoanAvailable, ShouldAlmostEqual, 100)
+
+		c.So(s.Borrow("doge", 101), ShouldNotBeNil)
+		c.So(s.Borrow("doge", 100), ShouldBeNil)
+
+		b, err = s.Balance("usdt")
+		c.So(err, ShouldBeNil)
+		c.So(b.LoanAvailable, ShouldAlmostEqual, 0)
+
+		ls, err := s.Loans()
+		c.So(err, ShouldBeNil)
+		c.So(ls, ShouldHaveLength, 1)
+
+		eq, err := s.(*Symbol).Equity()
+		c.So(err, ShouldBeNil)
+		c.So(eq, ShouldAlmostEqual, 100)
+
+		c.So(s.Repay("doge", 40), ShouldBeNil)
+		ls, err = s.Loans()
+		c.So(err, ShouldBeNil)
+		c.So(ls[0].Amount, ShouldAlmostEqual, 60)
+
+		c.So(s.Repay("doge", math.MaxFloat64), ShouldBeNil)
+		ls, err = s.Loans()
+		c.So(err, ShouldBeNil)
+		c.So(ls, ShouldBeEmpty)
+	})
+}
+
+func TestInterest(t *testing.T) {
+	Convey("should accrue interest of loans and report pnl", t, func(c C) {
+		now := time.Date(2018, 3, 1, 8, 0, 0, 0, time.UTC)
+		p := &gateio.Pair{Last: 1}
+		e := NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Leverage = 3
+		e.Interest = 0.001
+		e.Now = func() time.Time { return now }
+
+		var msgs []string
+		e.Notify = func(text string) { msgs = append(msgs, text) }
+
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		c.So(s.Borrow("usdt", 200), ShouldBeNil)
+		now = now.Add(48 * time.Hour)
+
+		b, err := s.Balance("usdt")
+		c.So(err, ShouldBeNil)
+		c.So(b.Loan, ShouldAlmostEqual, 200)
+		c.So(b.Interest, ShouldAlmostEqual, 0.4)
+
+		equity, pnl, err := s.(*Symbol).PnL()
+		c.So(err, ShouldBeNil)
+		c.So(equity, ShouldAlmostEqual, 99.6)
+		c.So(pnl, ShouldAlmostEqual, -0.4)
+
+		msg, err := s.(*Symbol).Report()
+		c.So(err, ShouldBeNil)
+		c.So(msg, ShouldContainSubstring, "借贷：200.0000")
+
+		c.So(s.Repay("usdt", math.MaxFloat64), ShouldBeNil)
+		b, err = s.Balance("usdt")
+		c.So(err, ShouldBeNil)
+		c.So(b.Trade, ShouldAlmostEqual, 99.6)
+		c.So(b.Loan, ShouldEqual, 0)
+		c.So(msgs, ShouldHaveLength, 2)
+	})
+}
+
+func TestLimit(t *testing.T) {
+	Convey("should reject orders out of limit", t, func(c C) {
+		p := &gateio.Pair{Last: 1}
+		e := NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Limits = map[string]exchange.Limit{
+			"doge_usdt": {BuyGT: 10, BuyLT: 50, SellGT: 10, SellLT: 50},
+		}
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		l, err := s.Limit()
+		c.So(err, ShouldBeNil)
+		c.So(l.BuyLT, ShouldEqual, 50)
+
+		_, err = s.Trade(exchange.Buy, 5)
+		c.So(err, ShouldNotBeNil)
+		_, err = s.Trade(exchange.Buy, 60)
+		c.So(err, ShouldNotBeNil)
+		f, err := s.Trade(exchange.Buy, 50)
+		c.So(err, ShouldBeNil)
+		c.So(f.FilledAmount, ShouldEqual, 50)
+		c.So(f.Received(), ShouldAlmostEqual, 49.9)
+	})
+}
+
+func TestSized(t *testing.T) {
+	Convey("should trade toward sized positions with loans", t, func(c C) {
+		p := &gateio.Pair{Last: 2, LowestAsk: 2, HighestBid: 2}
+		e := NewExchange(func(string) (*gateio.Pair, error) { return p, nil })
+		e.Fee = 0
+		e.Leverage = 3
+		c.So(e.Deposit("doge_usdt", "usdt", 100), ShouldBeNil)
+		s, err := e.Symbol(ctx, "doge_usdt")
+		c.So(err, ShouldBeNil)
+
+		// long 200 usdt, half of it is borrowed
+		sz := exchange.Fraction(2)
+		c.So(exchange.Apply(s, strategy.SigBull, sz), ShouldBeNil)
+		pos, eq, _, err := exchange.Position(s)
+		c.So(err, ShouldBeNil)
+		c.So(pos, ShouldAlmostEqual, 100)
+		c.So(eq, ShouldAlmostEqual, 100)
+
+		// short 200 usdt, the usdt loan is repaid
+		c.So(exchange.Apply(s, strategy.SigBear, sz), ShouldBeNil)
+		pos, eq, _, err = exchange.Position(s)
+		c.So(err, ShouldBeNil)
+		c.So(pos, ShouldAlmostEqual, -100)
+		c.So(eq, ShouldAlmostEqual, 100)
+		b, err := s.Balance("usdt")
+		c.So(err, ShouldBeNil)
+		c.So(b.Loan, ShouldEqual, 0)
+
+		// flat, the doge loan is repaid
+		c.So(exchange.Apply(s, strategy.SigFall, sz), ShouldBeNil)
+		pos, _, _, err = exchange.Position(s)
+		c.So(err, ShouldBeNil)
+		c.So(pos, ShouldAlmostEqual, 0)
+		ls, err := s.Loans()
+		c.So(err, ShouldBeNil)
+		c.So(ls, ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,75 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+// Cache is a Feed which fetches all tickers at most once in TTL, so that
+// strategies of many bots share one request of market data
+type Cache struct {
+	TTL   time.Duration
+	Fetch func() (map[string]*gateio.Pair, error)
+
+	mu      sync.Mutex
+	at      time.Time
+	tickers map[string]*gateio.Pair
+}
+
+var errNoTicker = errors.New("no ticker")
+
+// NewCache return a cache of tickers of a gateio client
+func NewCache(ttl time.Duration, c *gateio.Client) *Cache {
+	return &Cache{TTL: ttl, Fetch: func() (map[string]*gateio.Pair, error) {
+		return c.Tickers(context.Background())
+	}}
+}
+
+// Tickers return all tickers, which are fetched again if expired
+func (c *Cache) Tickers() (map[string]*gateio.Pair, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tickers != nil && time.Since(c.at) < c.TTL {
+		return c.tickers, nil
+	}
+
+	m, err := c.Fetch()
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	c.tickers, c.at = m, time.Now()
+	return m, nil
+}
+
+// Ticker return ticker of a symbol
+func (c *Cache) Ticker(symbol string) (*gateio.Pair, error) {
+	m, err := c.Tickers()
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+
+	p, ok := m[symbol]
+	if !ok || p == nil {
+		err = fmt.Errorf("%v: %s", errNoTicker, symbol)
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	return p, nil
+}
+
+// Trend return market trend
+func (c *Cache) Trend() (rise, fall uint16, err error) {
+	m, err := c.Tickers()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, util.FuncName())
+	}
+
+	rise, fall = gateio.TrendOf(m)
+	return rise, fall, nil
+}
@@ -0,0 +1,58 @@
+package strategy
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modood/cts/gateio"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCache(t *testing.T) {
+	Convey("should share tickers until expired", t, func(c C) {
+		var mu sync.Mutex
+		var n int
+		var fail bool
+		cache := &Cache{TTL: time.Hour, Fetch: func() (map[string]*gateio.Pair, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if fail {
+				return nil, errors.New("timeout")
+			}
+			n++
+			return map[string]*gateio.Pair{
+				"doge_usdt": {PercentChange: 1},
+				"xrp_usdt":  {PercentChange: -1},
+				"eth_btc":   {PercentChange: 1},
+			}, nil
+		}}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cache.Ticker("doge_usdt")
+			}()
+		}
+		wg.Wait()
+		c.So(n, ShouldEqual, 1)
+
+		p, err := cache.Ticker("doge_usdt")
+		c.So(err, ShouldBeNil)
+		c.So(p.PercentChange, ShouldEqual, 1)
+		_, err = cache.Ticker("btc_usdt")
+		c.So(err, ShouldNotBeNil)
+
+		rise, fall, err := cache.Trend()
+		c.So(err, ShouldBeNil)
+		c.So(rise, ShouldEqual, 1)
+		c.So(fall, ShouldEqual, 1)
+
+		cache.TTL, fail = 0, true
+		_, err = cache.Ticker("doge_usdt")
+		c.So(err, ShouldNotBeNil)
+	})
+}
@@ -4,13 +4,18 @@ import (
 	"log"
 	"strconv"
 
-	"github.com/modood/cts/gateio"
 	"github.com/modood/cts/util"
 	"github.com/pkg/errors"
 )
 
 // RippleDoge is a simple strategy refers to ripple and doge
-type RippleDoge struct{}
+type RippleDoge struct {
+	Feed Feed // market data, Live if nil
+
+	Rise   uint16  `mapstructure:"rise"`   // the market is rising if more pairs than it rise, 66 if 0
+	Fall   uint16  `mapstructure:"fall"`   // the market is falling if less pairs than it rise, 44 if 0
+	Change float64 `mapstructure:"change"` // percent change of doge and xrp in a bull or bear market, 4.4 if 0
+}
 
 // Name return strategy name
 func (s RippleDoge) Name() string {
@@ -19,38 +24,71 @@ func (s RippleDoge) Name() string {
 
 // Signal return strategy signal
 func (s RippleDoge) Signal() (uint8, error) {
-	doge, err := gateio.Ticker("doge_usdt")
+	sig, _, err := s.Explain()
 	if err != nil {
 		return SigNone, errors.Wrap(err, util.FuncName())
 	}
+	return sig, nil
+}
+
+// Explain return strategy signal and its inputs: pairs rise and fall, percent
+// changes of doge and xrp
+func (s RippleDoge) Explain() (uint8, map[string]float64, error) {
+	f := s.Feed
+	if f == nil {
+		f = Live
+	}
 
-	xrp, err := gateio.Ticker("xrp_usdt")
+	doge, err := f.Ticker("doge_usdt")
 	if err != nil {
-		return SigNone, errors.Wrap(err, util.FuncName())
+		return SigNone, nil, errors.Wrap(err, util.FuncName())
 	}
 
-	rise, fall, err := gateio.Trend()
+	xrp, err := f.Ticker("xrp_usdt")
 	if err != nil {
-		return SigNone, errors.Wrap(err, util.FuncName())
+		return SigNone, nil, errors.Wrap(err, util.FuncName())
+	}
+
+	rise, fall, err := f.Trend()
+	if err != nil {
+		return SigNone, nil, errors.Wrap(err, util.FuncName())
 	}
 
 	log.Println(strconv.FormatUint(uint64(rise), 10) + "↑, " + strconv.FormatUint(uint64(fall), 10) +
 		"↓, doge: " + strconv.FormatFloat(doge.PercentChange, 'f', 4, 64) +
 		"%, xrp: " + strconv.FormatFloat(xrp.PercentChange, 'f', 4, 64) + "%")
 
+	inputs := map[string]float64{
+		"rise": float64(rise),
+		"fall": float64(fall),
+		"doge": doge.PercentChange,
+		"xrp":  xrp.PercentChange,
+	}
+
+	up, down, change := s.Rise, s.Fall, s.Change
+	if up == 0 {
+		up = 66
+	}
+	if down == 0 {
+		down = 44
+	}
+	if change == 0 {
+		change = 4.4
+	}
+
 	// a simple strategy, just one example
-	if rise > 66 {
-		if doge.PercentChange > 4.4 && xrp.PercentChange > 4.4 {
-			return SigBull, nil
+	if rise > up {
+		if doge.PercentChange > change && xrp.PercentChange > change {
+			return SigBull, inputs, nil
 		}
-		return SigRise, nil
+		return SigRise, inputs, nil
 	}
-	if rise < 44 {
-		if doge.PercentChange < -4.4 && xrp.PercentChange < -4.4 {
-			return SigBear, nil
+	if rise < down {
+		if doge.PercentChange < -change && xrp.PercentChange < -change {
+			return SigBear, inputs, nil
 		}
-		return SigFall, nil
+		return SigFall, inputs, nil
 	}
 
-	return SigNone, nil
+	return SigNone, inputs, nil
 }
@@ -3,15 +3,22 @@ package strategy
 import (
 	"testing"
 
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/mock"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
 func TestRippleDoge(t *testing.T) {
 	Convey("should work successfully(strategy: ripdog)", t, func(c C) {
+		srv := mock.NewServer()
+		defer srv.Close()
+		srv.SetTicker("doge_usdt", mock.Ticker{Last: 0.002, PercentChange: 3})
+		srv.SetTicker("xrp_usdt", mock.Ticker{Last: 0.5, PercentChange: 2})
+
 		ch := make(chan uint8)
 
 		go func() {
-			s := RippleDoge{}
+			s := RippleDoge{Feed: NewLive(gateio.NewClient(srv.URL, nil))}
 
 			name := s.Name()
 			c.So(name, ShouldEqual, "ripdog")
@@ -26,3 +33,42 @@ func TestRippleDoge(t *testing.T) {
 		c.So(Signals(), ShouldContain, <-ch)
 	})
 }
+
+type feed struct {
+	doge, xrp  float64
+	rise, fall uint16
+}
+
+func (f feed) Ticker(symbol string) (*gateio.Pair, error) {
+	if symbol == "doge_usdt" {
+		return &gateio.Pair{PercentChange: f.doge}, nil
+	}
+	return &gateio.Pair{PercentChange: f.xrp}, nil
+}
+
+func (f feed) Trend() (uint16, uint16, error) { return f.rise, f.fall, nil }
+
+func TestRippleDogeFeed(t *testing.T) {
+	Convey("should signal by market data of feed", t, func(c C) {
+		cases := []struct {
+			f   feed
+			sig uint8
+		}{
+			{feed{5, 5, 70, 30}, SigBull},
+			{feed{5, 1, 70, 30}, SigRise},
+			{feed{-5, -5, 40, 60}, SigBear},
+			{feed{-5, 1, 40, 60}, SigFall},
+			{feed{5, 5, 50, 50}, SigNone},
+		}
+		for _, v := range cases {
+			sig, err := RippleDoge{Feed: v.f}.Signal()
+			c.So(err, ShouldBeNil)
+			c.So(sig, ShouldEqual, v.sig)
+		}
+
+		sig, inputs, err := RippleDoge{Feed: feed{5, 1, 70, 30}}.Explain()
+		c.So(err, ShouldBeNil)
+		c.So(sig, ShouldEqual, SigRise)
+		c.So(inputs, ShouldResemble, map[string]float64{"rise": 70, "fall": 30, "doge": 5, "xrp": 1})
+	})
+}
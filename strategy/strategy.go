@@ -1,5 +1,16 @@
 package strategy
 
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/modood/cts/gateio"
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
 // Signals
 const (
 	SigNone = iota // none
@@ -15,15 +26,77 @@ type Strategy interface {
 	Signal() (uint8, error)
 }
 
+// Explainer is a strategy which also tells the inputs of its signal
+type Explainer interface {
+	Explain() (sig uint8, inputs map[string]float64, err error)
+}
+
+// Feed provides market data to strategies
+type Feed interface {
+	Ticker(symbol string) (*gateio.Pair, error)
+	Trend() (rise, fall uint16, err error)
+}
+
+type live struct {
+	c *gateio.Client
+}
+
+// NewLive return the realtime market data of a gateio client
+func NewLive(c *gateio.Client) Feed {
+	return live{c}
+}
+
+func (l live) Ticker(symbol string) (*gateio.Pair, error) {
+	return l.c.Ticker(context.Background(), symbol)
+}
+
+func (l live) Trend() (rise, fall uint16, err error) {
+	return l.c.Trend(context.Background())
+}
+
+// Live is the realtime market data of gateio
+var Live = NewLive(gateio.NewClient("", nil))
+
 // Strategies return all available strategy
 func Strategies() map[string]Strategy {
-	ripdog := RippleDoge{}
+	return NewStrategies(Live)
+}
+
+// NewStrategies return all available strategy reading market data from f
+func NewStrategies(f Feed) map[string]Strategy {
+	ripdog := RippleDoge{Feed: f}
 
 	return map[string]Strategy{
 		ripdog.Name(): &ripdog,
 	}
 }
 
+// Configure set parameters of strategies by strategy name, an unknown
+// strategy or parameter is an error
+func Configure(ss map[string]Strategy, params map[string]map[string]interface{}) error {
+	for name, p := range params {
+		s, ok := ss[name]
+		if !ok {
+			err := fmt.Errorf("unknown strategy: %s", name)
+			return errors.Wrap(err, util.FuncName())
+		}
+
+		d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			ErrorUnused:      true,
+			WeaklyTypedInput: true,
+			Result:           s,
+		})
+		if err != nil {
+			return errors.Wrap(err, util.FuncName())
+		}
+		if err = d.Decode(p); err != nil {
+			err = fmt.Errorf("%s: %v", name, err)
+			return errors.Wrap(err, util.FuncName())
+		}
+	}
+	return nil
+}
+
 // Available return all available strategy name
 func Available() []string {
 	m := Strategies()
@@ -36,6 +109,23 @@ func Available() []string {
 	return keys
 }
 
+// SignalName return the name of a signal, e.g., rise
+func SignalName(sig uint8) string {
+	switch sig {
+	case SigNone:
+		return "none"
+	case SigRise:
+		return "rise"
+	case SigFall:
+		return "fall"
+	case SigBull:
+		return "bull"
+	case SigBear:
+		return "bear"
+	}
+	return strconv.FormatUint(uint64(sig), 10)
+}
+
 // Signals return all available signal
 func Signals() []uint8 {
 	return []uint8{
@@ -7,26 +7,53 @@ import (
 )
 
 func TestStrategies(t *testing.T) {
-	Convey("should return all available strategy", t, func() {
+	Convey("should return all available strategy", t, func(c C) {
 		m := Strategies()
 
 		ripdog, ok := m["ripdog"]
-		So(ok, ShouldBeTrue)
-		So(ripdog.Name(), ShouldEqual, "ripdog")
-		So(ripdog.(*RippleDoge), ShouldHaveSameTypeAs, &RippleDoge{})
+		c.So(ok, ShouldBeTrue)
+		c.So(ripdog.Name(), ShouldEqual, "ripdog")
+		c.So(ripdog.(*RippleDoge), ShouldHaveSameTypeAs, &RippleDoge{})
 	})
 }
 
 func TestAvailable(t *testing.T) {
-	Convey("should return all available strategy name", t, func() {
+	Convey("should return all available strategy name", t, func(c C) {
 		s := Available()
-		So(s, ShouldNotBeEmpty)
+		c.So(s, ShouldNotBeEmpty)
 	})
 }
 
 func TestSignals(t *testing.T) {
-	Convey("should return all available signal", t, func() {
+	Convey("should return all available signal", t, func(c C) {
 		s := Signals()
-		So(s, ShouldNotBeEmpty)
+		c.So(s, ShouldNotBeEmpty)
+	})
+}
+
+func TestSignalName(t *testing.T) {
+	Convey("should return names of signals", t, func(c C) {
+		c.So(SignalName(SigNone), ShouldEqual, "none")
+		c.So(SignalName(SigBear), ShouldEqual, "bear")
+		c.So(SignalName(99), ShouldEqual, "99")
+	})
+}
+
+func TestConfigure(t *testing.T) {
+	Convey("should set parameters of strategies", t, func(c C) {
+		m := Strategies()
+
+		err := Configure(m, map[string]map[string]interface{}{
+			"ripdog": {"rise": "70", "change": 3.3},
+		})
+		c.So(err, ShouldBeNil)
+		c.So(m["ripdog"].(*RippleDoge).Rise, ShouldEqual, 70)
+		c.So(m["ripdog"].(*RippleDoge).Change, ShouldEqual, 3.3)
+
+		err = Configure(m, map[string]map[string]interface{}{"ripdog": {"xxx": 1}})
+		c.So(err, ShouldNotBeNil)
+
+		err = Configure(m, map[string]map[string]interface{}{"xxx": {}})
+		c.So(err, ShouldNotBeNil)
 	})
 }
@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Limiter is a token bucket of every host: Rate tokens are added per
+	// second up to Burst, and a request takes one
+	Limiter struct {
+		Rate  float64
+		Burst int
+		Now   func() time.Time // time.Now if nil
+
+		mu      sync.Mutex
+		buckets map[string]*bucket
+	}
+
+	bucket struct {
+		tokens float64 // negative if requests are waiting
+		last   time.Time
+	}
+)
+
+// NewLimiter return a limiter of rate requests per second and bursts of
+// burst requests
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{Rate: rate, Burst: burst}
+}
+
+// Wait wait for a token of host, or until ctx is done, in which case the
+// token is returned
+func (l *Limiter) Wait(ctx context.Context, host string) error {
+	d := l.reserve(host)
+	if d <= 0 {
+		return nil
+	}
+	if err := sleep(ctx, d); err != nil {
+		l.cancel(host)
+		return errors.Wrap(err, util.FuncName())
+	}
+	return nil
+}
+
+// reserve take a token of host and return how long to wait for it
+func (l *Limiter) reserve(host string) time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.Now != nil {
+		now = l.Now()
+	}
+	if l.buckets == nil {
+		l.buckets = map[string]*bucket{}
+	}
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[host] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.Rate
+	if max := float64(l.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.Rate * float64(time.Second))
+}
+
+// cancel return a token of host which is reserved but not used
+func (l *Limiter) cancel(host string) {
+	if l.Rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[host]; ok && b.tokens < float64(l.Burst) {
+		b.tokens++
+	}
+}
@@ -0,0 +1,236 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/modood/cts/util"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Client send requests with retries, backoff and rate limiting, it is
+	// shared by clients of exchanges and notifiers. a request is retried
+	// only if it is safe: it did not reach the server, it was rejected by
+	// 429 Too Many Requests, or it is idempotent.
+	Client struct {
+		HTTP     *http.Client  // http.DefaultClient if nil
+		Timeout  time.Duration // of an attempt, only the context if 0
+		Attempts int           // 1 if 0
+		Backoff  Backoff
+		Limiter  *Limiter // no limit if nil
+
+		// Observe receive the latency and error of every request to an
+		// endpoint, whose ids are {id}, e.g., for metrics
+		Observe func(endpoint string, d time.Duration, err error)
+	}
+
+	// Backoff is exponential with jitter: the nth retry waits a random time
+	// between half of and Base * 2^(n-1), which is at most Max unless Max is
+	// 0
+	Backoff struct {
+		Base time.Duration
+		Max  time.Duration
+	}
+
+	// Request is an HTTP request whose body can be sent more than once
+	Request struct {
+		Method     string
+		URL        string
+		Header     http.Header
+		Body       []byte
+		Idempotent bool // retried even if it may have reached the server, so are GET and HEAD
+	}
+
+	// Response is a response whose body is read
+	Response struct {
+		Status int
+		Header http.Header
+		Body   []byte
+	}
+
+	// StatusError is a response whose status is not 2xx
+	StatusError struct {
+		Status int
+		Body   string
+	}
+)
+
+// sleep wait d or until ctx is done, it is replaced by tests
+var sleep = sleepTimer
+
+func sleepTimer(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, http.StatusText(e.Status), e.Body)
+}
+
+// Do send a request until it succeeds, it fails for good, it is not safe to
+// retry, the attempts run out, or ctx is done. a response of an error status
+// is returned with a StatusError.
+func (c *Client) Do(ctx context.Context, r *Request) (*Response, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, errors.Wrap(util.RedactError(err), util.FuncName())
+	}
+
+	for attempt := 1; ; attempt++ {
+		if c.Limiter != nil {
+			if err = c.Limiter.Wait(ctx, u.Host); err != nil {
+				return nil, errors.Wrap(err, util.FuncName())
+			}
+		}
+
+		start := time.Now()
+		resp, err := c.once(ctx, r)
+		if c.Observe != nil {
+			c.Observe(util.Endpoint(u.Path), time.Since(start), err)
+		}
+
+		if err == nil || attempt >= c.attempts() || ctx.Err() != nil || !retryable(r, resp, err) {
+			if err != nil {
+				return resp, errors.Wrap(err, util.FuncName())
+			}
+			return resp, nil
+		}
+
+		d := c.Backoff.Delay(attempt)
+		if resp != nil && resp.Status == http.StatusTooManyRequests {
+			if s, e := strconv.Atoi(resp.Header.Get("Retry-After")); e == nil && s > 0 {
+				d = time.Duration(s) * time.Second
+			}
+		}
+		if e := sleep(ctx, d); e != nil {
+			return resp, errors.Wrap(err, util.FuncName())
+		}
+	}
+}
+
+// once send a request once
+func (c *Client) once(ctx context.Context, r *Request) (*Response, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var body io.Reader
+	if r.Body != nil {
+		body = bytes.NewReader(r.Body)
+	}
+	req, err := http.NewRequest(r.Method, r.URL, body)
+	if err != nil {
+		return nil, errors.Wrap(util.RedactError(err), util.FuncName())
+	}
+	req = req.WithContext(ctx)
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// urls usually contain tokens
+		return nil, errors.Wrap(util.RedactError(err), util.FuncName())
+	}
+	defer resp.Body.Close()
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, util.FuncName())
+	}
+	res := &Response{Status: resp.StatusCode, Header: resp.Header, Body: bs}
+	if resp.StatusCode/100 != 2 {
+		err = &StatusError{Status: resp.StatusCode, Body: strings.TrimSpace(string(bs))}
+		return res, errors.Wrap(err, util.FuncName())
+	}
+	return res, nil
+}
+
+func (c *Client) attempts() int {
+	if c.Attempts < 1 {
+		return 1
+	}
+	return c.Attempts
+}
+
+// Delay return the backoff before the nth retry
+func (b Backoff) Delay(n int) time.Duration {
+	d := b.Base
+	for i := 1; i < n && (b.Max <= 0 || d < b.Max) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable return whether a failed request is safe to send again
+func retryable(r *Request, resp *Response, err error) bool {
+	safe := r.Idempotent || r.Method == http.MethodGet || r.Method == http.MethodHead
+	if resp != nil {
+		switch resp.Status {
+		case http.StatusTooManyRequests:
+			return true
+		case http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return safe
+		}
+		return false
+	}
+	if Unsent(err) {
+		return true
+	}
+	return safe && IsNetError(err)
+}
+
+// IsNetError return whether err is caused by network timeout, reset or an
+// unexpected EOF, in which case the request may or may not reach the server
+func IsNetError(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) || strings.Contains(err.Error(), "connection reset by peer")
+}
+
+// Unsent return whether a request failed before it was sent, e.g., the
+// connection is refused, so it never reaches the server
+func Unsent(err error) bool {
+	var op *net.OpError
+	if errors.As(err, &op) && op.Op == "dial" {
+		return true
+	}
+	var dns *net.DNSError
+	return errors.As(err, &dns)
+}
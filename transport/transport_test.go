@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDo(t *testing.T) {
+	Convey("should retry safe requests only", t, func(c C) {
+		var waits []time.Duration
+		sleep = func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return ctx.Err()
+		}
+		defer func() { sleep = sleepTimer }()
+
+		var n int32
+		var bodies []string
+		status := http.StatusServiceUnavailable
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bs, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(bs))
+			if atomic.AddInt32(&n, 1) < 3 {
+				w.Header().Set("Retry-After", "2")
+				w.WriteHeader(status)
+				w.Write([]byte("busy\n"))
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer srv.Close()
+
+		cl := &Client{Attempts: 3, Backoff: Backoff{Base: time.Millisecond * 100, Max: time.Second}}
+		var observed []string
+		cl.Observe = func(endpoint string, d time.Duration, err error) {
+			observed = append(observed, endpoint)
+		}
+		resp, err := cl.Do(context.Background(), &Request{Method: "GET", URL: srv.URL + "/v1/orders/12345"})
+		c.So(err, ShouldBeNil)
+		c.So(string(resp.Body), ShouldEqual, "ok")
+		c.So(len(waits), ShouldEqual, 2)
+		c.So(waits[0], ShouldBeBetweenOrEqual, time.Millisecond*50, time.Millisecond*100)
+		c.So(waits[1], ShouldBeBetweenOrEqual, time.Millisecond*100, time.Millisecond*200)
+		c.So(observed, ShouldResemble, []string{"/v1/orders/{id}", "/v1/orders/{id}", "/v1/orders/{id}"})
+
+		// a post may have reached the server
+		n, waits, bodies = 0, nil, nil
+		resp, err = cl.Do(context.Background(), &Request{Method: "POST", URL: srv.URL, Body: []byte("order")})
+		c.So(err, ShouldNotBeNil)
+		c.So(resp.Status, ShouldEqual, http.StatusServiceUnavailable)
+		var se *StatusError
+		c.So(errors.As(err, &se), ShouldBeTrue)
+		c.So(se.Status, ShouldEqual, http.StatusServiceUnavailable)
+		c.So(se.Body, ShouldEqual, "busy")
+		c.So(len(bodies), ShouldEqual, 1)
+
+		// unless it is rejected by rate limits, its body is sent again
+		n, waits, bodies = 0, nil, nil
+		status = http.StatusTooManyRequests
+		resp, err = cl.Do(context.Background(), &Request{Method: "POST", URL: srv.URL, Body: []byte("order")})
+		c.So(err, ShouldBeNil)
+		c.So(bodies, ShouldResemble, []string{"order", "order", "order"})
+		c.So(waits, ShouldResemble, []time.Duration{time.Second * 2, time.Second * 2})
+
+		// or it is idempotent
+		n, waits, bodies = 0, nil, nil
+		status = http.StatusBadGateway
+		_, err = cl.Do(context.Background(), &Request{Method: "POST", URL: srv.URL, Idempotent: true})
+		c.So(err, ShouldBeNil)
+		c.So(len(bodies), ShouldEqual, 3)
+
+		// stop at once if the context is done
+		n, waits, bodies = 0, nil, nil
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = cl.Do(ctx, &Request{Method: "GET", URL: srv.URL})
+		c.So(err, ShouldNotBeNil)
+		c.So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		c.So(len(bodies), ShouldEqual, 0)
+	})
+
+	Convey("should retry requests which are never sent", t, func(c C) {
+		var waits int
+		sleep = func(ctx context.Context, d time.Duration) error {
+			waits++
+			return nil
+		}
+		defer func() { sleep = sleepTimer }()
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		c.So(err, ShouldBeNil)
+		addr := l.Addr().String()
+		c.So(l.Close(), ShouldBeNil)
+
+		cl := &Client{Attempts: 2}
+		_, err = cl.Do(context.Background(), &Request{Method: "POST", URL: "http://" + addr})
+		c.So(err, ShouldNotBeNil)
+		c.So(Unsent(err), ShouldBeTrue)
+		c.So(waits, ShouldEqual, 1)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	Convey("should double the delay up to max", t, func(c C) {
+		b := Backoff{Base: time.Second, Max: time.Second * 5}
+		for i, v := range []time.Duration{1, 2, 4, 5, 5} {
+			d := b.Delay(i + 1)
+			c.So(d, ShouldBeBetweenOrEqual, v*time.Second/2, v*time.Second)
+		}
+		c.So(Backoff{}.Delay(3), ShouldEqual, 0)
+
+		// no cap
+		b = Backoff{Base: time.Second}
+		for i, v := range []time.Duration{1, 2, 4, 8, 16} {
+			d := b.Delay(i + 1)
+			c.So(d, ShouldBeBetweenOrEqual, v*time.Second/2, v*time.Second)
+		}
+		c.So(b.Delay(100), ShouldBeGreaterThan, 0)
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	Convey("should limit requests of every host", t, func(c C) {
+		now := time.Unix(0, 0)
+		l := NewLimiter(10, 2)
+		l.Now = func() time.Time { return now }
+
+		c.So(l.reserve("a"), ShouldEqual, 0)
+		c.So(l.reserve("a"), ShouldEqual, 0)
+		c.So(l.reserve("a"), ShouldEqual, time.Millisecond*100)
+		c.So(l.reserve("a"), ShouldEqual, time.Millisecond*200)
+		c.So(l.reserve("b"), ShouldEqual, 0)
+
+		now = now.Add(time.Second)
+		c.So(l.reserve("a"), ShouldEqual, 0)
+		c.So(NewLimiter(0, 0).reserve("a"), ShouldEqual, 0)
+	})
+
+	Convey("should return the token of a cancelled wait", t, func(c C) {
+		sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+		defer func() { sleep = sleepTimer }()
+
+		now := time.Unix(0, 0)
+		l := NewLimiter(10, 1)
+		l.Now = func() time.Time { return now }
+
+		c.So(l.Wait(context.Background(), "a"), ShouldBeNil)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c.So(l.Wait(ctx, "a"), ShouldNotBeNil)
+		c.So(l.Wait(ctx, "a"), ShouldNotBeNil)
+		// the cancelled waits take no tokens
+		c.So(l.reserve("a"), ShouldEqual, time.Millisecond*100)
+	})
+}
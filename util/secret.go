@@ -0,0 +1,84 @@
+package util
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets in logs and errors
+const Redacted = "******"
+
+type (
+	// redactedError hide secrets of an error, its cause is the original one
+	redactedError struct {
+		err error
+	}
+
+	// redactWriter hide secrets of everything written
+	redactWriter struct {
+		w io.Writer
+	}
+)
+
+var (
+	secrets   []string
+	secretsMu sync.RWMutex
+)
+
+// AddSecret register values which should never appear in logs and errors,
+// values shorter than 4 are ignored to avoid redacting everything
+func AddSecret(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	for _, v := range values {
+		if len(v) < 4 {
+			continue
+		}
+		dup := false
+		for _, s := range secrets {
+			dup = dup || s == v
+		}
+		if !dup {
+			secrets = append(secrets, v)
+		}
+	}
+}
+
+// Redact replace registered secrets in s
+func Redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+
+	for _, v := range secrets {
+		s = strings.Replace(s, v, Redacted, -1)
+	}
+	return s
+}
+
+// RedactError return an error whose message has no registered secrets,
+// errors.Cause of it is still err, and so is errors.Is and errors.As
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err}
+}
+
+func (e *redactedError) Error() string { return Redact(e.err.Error()) }
+func (e *redactedError) Cause() error  { return e.err }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// RedactWriter return a writer which replace registered secrets, it is
+// used as the output of log, e.g., log.SetOutput(util.RedactWriter(os.Stderr))
+func RedactWriter(w io.Writer) io.Writer {
+	return &redactWriter{w}
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
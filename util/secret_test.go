@@ -0,0 +1,32 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedact(t *testing.T) {
+	Convey("should hide registered secrets", t, func(c C) {
+		AddSecret("abc", "topsecret", "topsecret")
+		c.So(secrets, ShouldContain, "topsecret")
+		c.So(secrets, ShouldNotContain, "abc")
+
+		c.So(Redact("key=topsecret&abc"), ShouldEqual, "key=******&abc")
+
+		cause := errors.New("get https://x?token=topsecret: timeout")
+		err := RedactError(cause)
+		c.So(err.Error(), ShouldEqual, "get https://x?token=******: timeout")
+		c.So(err.(interface{ Cause() error }).Cause(), ShouldEqual, cause)
+		c.So(errors.Is(err, cause), ShouldBeTrue)
+		c.So(RedactError(nil), ShouldBeNil)
+
+		var b bytes.Buffer
+		n, err := RedactWriter(&b).Write([]byte("topsecret\n"))
+		c.So(err, ShouldBeNil)
+		c.So(n, ShouldEqual, 10)
+		c.So(b.String(), ShouldEqual, "******\n")
+	})
+}
@@ -3,6 +3,7 @@ package util
 import (
 	"path"
 	"runtime"
+	"strings"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
@@ -35,3 +36,15 @@ func Decode(m map[string]interface{}, i interface{}) error {
 	}
 	return nil
 }
+
+// Endpoint return a url path whose segments of ids, which are numbers of 3
+// digits or more, are {id}, e.g., /v1/order/orders/{id}/submitcancel
+func Endpoint(p string) string {
+	ss := strings.Split(p, "/")
+	for i, v := range ss {
+		if len(v) >= 3 && strings.Trim(v, "0123456789") == "" {
+			ss[i] = "{id}"
+		}
+	}
+	return strings.Join(ss, "/")
+}
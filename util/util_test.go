@@ -10,7 +10,17 @@ func TestFuncName(t *testing.T) {
 	name := FuncName()
 	Convey("should return func name correctly", t, func(c C) {
 		anonymity := FuncName()
-		So(name, ShouldEqual, "util.TestFuncName")
-		So(anonymity, ShouldEqual, "util.TestFuncName.func1")
+		c.So(name, ShouldEqual, "util.TestFuncName")
+		c.So(anonymity, ShouldEqual, "util.TestFuncName.func1")
+	})
+}
+
+func TestEndpoint(t *testing.T) {
+	Convey("should replace ids of a url path", t, func(c C) {
+		c.So(Endpoint("/v1/order/orders/123/submitcancel"), ShouldEqual, "/v1/order/orders/{id}/submitcancel")
+		c.So(Endpoint("/v1/margin/orders/4009/repay"), ShouldEqual, "/v1/margin/orders/{id}/repay")
+		c.So(Endpoint("/api2/1/tickers"), ShouldEqual, "/api2/1/tickers")
+		c.So(Endpoint("/market/history/kline"), ShouldEqual, "/market/history/kline")
+		c.So(Endpoint(""), ShouldEqual, "")
 	})
 }